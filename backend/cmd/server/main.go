@@ -4,9 +4,20 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
+	"frop/internal/codes"
+	"frop/internal/config"
+	"frop/internal/device"
+	"frop/internal/drop"
+	"frop/internal/janitor"
+	"frop/internal/ratelimit"
+	"frop/internal/room"
 	"frop/internal/routes"
+	"frop/internal/session"
+	"frop/internal/token"
+	"frop/internal/transfer"
 
 	"github.com/lmittmann/tint"
 )
@@ -14,21 +25,136 @@ import (
 func main() {
 	setupLogging(slog.LevelInfo)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	cfg := config.Load()
+	if err := setupStores(cfg); err != nil {
+		slog.Error("Failed to open stores", "error", err)
+		os.Exit(1)
 	}
 
+	if err := setupCodes(cfg); err != nil {
+		slog.Error("Invalid room code settings", "error", err)
+		os.Exit(1)
+	}
+	if err := setupRateLimits(cfg); err != nil {
+		slog.Error("Invalid rate limit settings", "error", err)
+		os.Exit(1)
+	}
+	if err := setupTokens(cfg); err != nil {
+		slog.Error("Invalid session token keys", "error", err)
+		os.Exit(1)
+	}
+	session.SetGrace(cfg.ReconnectGrace)
+	room.SetMaxCapacity(cfg.MaxRoomCapacity)
+	room.SetMaxTTL(cfg.MaxTTL)
+	drop.SetTTL(cfg.DropTTL)
+	drop.SetClaimToken(cfg.DropClaimToken)
+	room.SetReserved(drop.Reserved)
+	device.SetTTL(cfg.DeviceTTL)
+	transfer.SetResumeWindow(cfg.ResumeWindow)
+	transfer.SetOfferTimeout(cfg.OfferTimeout)
+	transfer.SetWindow(int64(cfg.FlowWindow))
+	transfer.SetMaxFrame(int64(cfg.MaxFrame))
+	janitor.SetExpiryWarning(cfg.ExpiryWarning)
+	janitor.New(cfg.SweepInterval).Start()
+
 	mux := http.NewServeMux()
+	routes.SetPublicURL(cfg.PublicURL)
 	routes.Setup(mux)
 	mux.Handle("/", http.FileServer(http.Dir("../frontend")))
 
-	slog.Info("Server starting", "port", port)
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
+	slog.Info("Server starting", "port", cfg.Port)
+	if err := http.ListenAndServe(":"+cfg.Port, mux); err != nil {
 		slog.Error("Server failed", "error", err)
 	}
 }
 
+// setupStores switches rooms and sessions to durable file-backed stores
+// when a data directory is configured; otherwise the in-memory defaults stay.
+func setupStores(cfg *config.Config) error {
+	if cfg.DataDir == "" {
+		slog.Info("No data directory configured, keeping rooms, sessions, drops and devices in memory")
+		return nil
+	}
+
+	rooms, err := room.OpenFileStore(filepath.Join(cfg.DataDir, "rooms.log"))
+	if err != nil {
+		return err
+	}
+	sessions, err := session.OpenFileStore(filepath.Join(cfg.DataDir, "sessions.log"))
+	if err != nil {
+		return err
+	}
+	drops, err := drop.OpenFileStore(filepath.Join(cfg.DataDir, "drops.log"))
+	if err != nil {
+		return err
+	}
+	devices, err := device.OpenFileStore(filepath.Join(cfg.DataDir, "devices.log"))
+	if err != nil {
+		return err
+	}
+	room.SetStore(rooms)
+	session.SetStore(sessions)
+	drop.SetStore(drops)
+	device.SetStore(devices)
+	slog.Info("Using durable stores", "dir", cfg.DataDir)
+	return nil
+}
+
+// setupCodes installs the configured room code generator
+func setupCodes(cfg *config.Config) error {
+	alphabet := cfg.CodeAlphabet
+	switch alphabet {
+	case "alphanumeric":
+		alphabet = codes.Alphanumeric
+	case "unambiguous":
+		alphabet = codes.Unambiguous
+	case "digits":
+		alphabet = codes.Digits
+	}
+
+	g, err := codes.New(codes.Mode(cfg.CodeMode), cfg.CodeLength, alphabet, cfg.CodeCheck)
+	if err != nil {
+		return err
+	}
+	room.SetCodeGenerator(g)
+	slog.Info("Room codes", "mode", g.Mode, "check", g.Check, "example", g.Generate())
+	return nil
+}
+
+// setupRateLimits installs the configured rate limits and ban policy
+func setupRateLimits(cfg *config.Config) error {
+	limits := ratelimit.Config{
+		Ban:        ratelimit.Ban{After: cfg.BanAfter, For: cfg.BanDuration},
+		TrustProxy: cfg.TrustProxy,
+	}
+	var err error
+	if limits.Create, err = ratelimit.ParseLimit(cfg.RateCreate); err != nil {
+		return err
+	}
+	if limits.Join, err = ratelimit.ParseLimit(cfg.RateJoin); err != nil {
+		return err
+	}
+	if limits.Reconnect, err = ratelimit.ParseLimit(cfg.RateReconnect); err != nil {
+		return err
+	}
+	ratelimit.Configure(limits)
+	return nil
+}
+
+// setupTokens installs the keyring for signed session tokens, if configured
+func setupTokens(cfg *config.Config) error {
+	if cfg.TokenKeys == "" {
+		return nil
+	}
+	keys, err := token.ParseKeyring(cfg.TokenKeys)
+	if err != nil {
+		return err
+	}
+	session.SetKeyring(keys)
+	slog.Info("Using signed session tokens")
+	return nil
+}
+
 // setupLogging configures colored logging with source info
 func setupLogging(level slog.Level) {
 	slog.SetDefault(slog.New(
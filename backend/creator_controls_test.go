@@ -0,0 +1,243 @@
+package main
+
+// Creator control tests - approving joiners, kicking, locking and closing.
+
+import (
+	"testing"
+	"time"
+
+	"frop/internal/room"
+	"frop/internal/session"
+
+	"github.com/gorilla/websocket"
+)
+
+// knock joins a room its creator is in and returns the request ID the
+// creator sees
+func knock(t *testing.T, creator, joiner *websocket.Conn, code string) string {
+	t.Helper()
+
+	joiner.WriteJSON(map[string]string{"type": "join", "code": code})
+	pending := readType(t, joiner, "pending")
+	req := readType(t, creator, "join_request")
+	if req["requestId"] != pending["requestId"] {
+		t.Fatalf("Creator and joiner disagree on the request: %v vs %v", req, pending)
+	}
+	return req["requestId"].(string)
+}
+
+// admit has joiner knock on room code and the creator let it in
+func admit(t *testing.T, creator, joiner *websocket.Conn, code string) {
+	t.Helper()
+
+	creator.WriteJSON(map[string]string{"type": "approve", "requestId": knock(t, creator, joiner, code)})
+}
+
+// joinFirst joins conn to room code as its creator, and waits until the
+// server has seated it so that later joiners knock
+func joinFirst(t *testing.T, conn *websocket.Conn, code string) {
+	t.Helper()
+
+	conn.WriteJSON(map[string]string{"type": "join", "code": code})
+	seated(t, code)
+}
+
+// seated waits until room code has a creator; a lone joiner hears nothing
+// back, so tests cannot wait on a message instead
+func seated(t *testing.T, code string) {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if r, err := room.GetRoom(code); err == nil && r.Creator() != nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Creator never took its seat in %s", code)
+		}
+	}
+}
+
+// =============================================================================
+// Approval
+// =============================================================================
+
+// TestApproveJoiner verifies a knocking peer only pairs once approved
+func TestApproveJoiner(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createGroupRoom(t, 2)
+
+	creator := ts.dialWS(t)
+	defer creator.Close()
+	joinFirst(t, creator, code)
+
+	joiner := ts.dialWS(t)
+	defer joiner.Close()
+	id := knock(t, creator, joiner, code)
+
+	creator.WriteJSON(map[string]string{"type": "approve", "requestId": id})
+	readType(t, creator, "connected")
+	msg := readType(t, joiner, "connected")
+	if msg["peerId"] != "p2" {
+		t.Errorf("Expected approved joiner to be p2, got %v", msg["peerId"])
+	}
+
+	t.Log("Approved joiner paired with the creator!")
+}
+
+// TestDenyJoiner verifies a denied peer is told and never pairs
+func TestDenyJoiner(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createGroupRoom(t, 2)
+
+	creator := ts.dialWS(t)
+	defer creator.Close()
+	joinFirst(t, creator, code)
+
+	joiner := ts.dialWS(t)
+	defer joiner.Close()
+	id := knock(t, creator, joiner, code)
+
+	creator.WriteJSON(map[string]string{"type": "deny", "requestId": id})
+	if msg := readType(t, joiner, "failed"); msg["error"] != "join denied" {
+		t.Errorf("Expected join denied, got %v", msg)
+	}
+
+	r, err := room.GetRoom(code)
+	if err != nil {
+		t.Fatalf("Room should still exist: %v", err)
+	}
+	if len(r.Peers()) != 1 {
+		t.Errorf("Expected only the creator in the room, got %d peers", len(r.Peers()))
+	}
+
+	t.Log("Denied joiner was turned away!")
+}
+
+// TestOnlyCreatorApproves verifies other members cannot answer requests
+func TestOnlyCreatorApproves(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createGroupRoom(t, 3)
+
+	creator := ts.dialWS(t)
+	defer creator.Close()
+	joinFirst(t, creator, code)
+
+	member := ts.dialWS(t)
+	defer member.Close()
+	admit(t, creator, member, code)
+	readType(t, creator, "connected")
+	readType(t, member, "connected")
+
+	joiner := ts.dialWS(t)
+	defer joiner.Close()
+	id := knock(t, creator, joiner, code)
+
+	member.WriteJSON(map[string]string{"type": "approve", "requestId": id})
+	if msg := readType(t, member, "failed"); msg["error"] != "not the room creator" {
+		t.Errorf("Expected not the room creator, got %v", msg)
+	}
+
+	t.Log("Only the creator can approve joiners!")
+}
+
+// =============================================================================
+// Kick, lock and close
+// =============================================================================
+
+// TestKickPeer verifies a kicked peer is disconnected and cannot reuse the
+// old session token
+func TestKickPeer(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createRoom(t)
+
+	peers := ts.joinGroup(t, code, 2)
+	creator, joiner := peers[0], peers[1]
+	defer creator.Close()
+	defer joiner.Close()
+	s, _ := session.ForRoom(code)
+	oldToken := s.Token()
+
+	creator.WriteJSON(map[string]string{"type": "kick", "to": "p2"})
+	readType(t, joiner, "kicked")
+	msg := readType(t, creator, "connected")
+	if msg["sessionToken"] == oldToken {
+		t.Error("Expected the session token to rotate after a kick")
+	}
+
+	again := ts.dialWS(t)
+	defer again.Close()
+	again.WriteJSON(map[string]any{"type": "reconnect", "sessionToken": oldToken})
+	if msg := readType(t, again, "failed"); msg["error"] != "session not found" {
+		t.Errorf("Expected the old token to be refused, got %v", msg)
+	}
+
+	t.Log("Kicked peer cannot reconnect with the old token!")
+}
+
+// TestLockRoom verifies a locked room refuses new joiners
+func TestLockRoom(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createGroupRoom(t, 3)
+
+	creator := ts.dialWS(t)
+	defer creator.Close()
+	creator.WriteJSON(map[string]string{"type": "join", "code": code})
+	creator.WriteJSON(map[string]string{"type": "lock"})
+	expectSilence(t, creator)
+
+	late := ts.dialWS(t)
+	defer late.Close()
+	if msg := joinRoom(t, late, code); msg["error"] != "room locked" {
+		t.Errorf("Expected room locked, got %v", msg)
+	}
+
+	t.Log("Locked room refused a joiner!")
+}
+
+// TestCloseRoom verifies closing ends the room and session for everyone
+func TestCloseRoom(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createRoom(t)
+
+	peers := ts.joinGroup(t, code, 2)
+	creator, joiner := peers[0], peers[1]
+	defer creator.Close()
+	defer joiner.Close()
+
+	creator.WriteJSON(map[string]string{"type": "close"})
+	readType(t, creator, "room_closed")
+	readType(t, joiner, "room_closed")
+
+	if _, err := room.GetRoom(code); err != room.ErrRoomNotFound {
+		t.Errorf("Expected room to be gone, got %v", err)
+	}
+	if _, exists := session.ForRoom(code); exists {
+		t.Error("Expected the session to be gone")
+	}
+
+	t.Log("Closed room disconnected everyone!")
+}
@@ -0,0 +1,158 @@
+package main
+
+// Per-peer credential tests - rotation on reconnect and detecting the reuse
+// of a leaked token.
+
+import (
+	"testing"
+	"time"
+
+	"frop/internal/session"
+
+	"github.com/gorilla/websocket"
+)
+
+// reconnectWith presents token on a new connection
+func (ts *testServer) reconnectWith(t *testing.T, token any) *websocket.Conn {
+	t.Helper()
+
+	conn := ts.dialWS(t)
+	conn.WriteJSON(map[string]any{"type": "reconnect", "sessionToken": token})
+	return conn
+}
+
+// =============================================================================
+// Per-peer credentials
+// =============================================================================
+
+// TestCredentialRotatesOnReconnect verifies a reconnect issues a new token
+// and the old one is then refused as stale, which the session's peers hear
+func TestCredentialRotatesOnReconnect(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	defer conns[1].Close()
+	oldToken := msgs[0]["sessionToken"]
+
+	conns[0].Close()
+	readType(t, conns[1], "peer_disconnected")
+
+	back := ts.reconnectWith(t, oldToken)
+	defer back.Close()
+	msg := readType(t, back, "connected")
+	if msg["sessionToken"] == oldToken {
+		t.Fatal("Expected a new token after reconnecting")
+	}
+	readType(t, conns[1], "connected")
+
+	// someone who copied the old token from the URL
+	thief := ts.reconnectWith(t, oldToken)
+	defer thief.Close()
+	if msg := readType(t, thief, "failed"); msg["error"] != session.ErrStaleCredential.Error() {
+		t.Errorf("Expected %q, got %v", session.ErrStaleCredential, msg["error"])
+	}
+	for _, conn := range []*websocket.Conn{back, conns[1]} {
+		if msg := readType(t, conn, "credential_reused"); msg["peerId"] != msgs[0]["peerId"] {
+			t.Errorf("Expected reuse of %v's token to be reported, got %v", msgs[0]["peerId"], msg)
+		}
+	}
+
+	t.Log("Credentials rotate and stale reuse is reported!")
+}
+
+// TestCredentialBoundToSlot verifies one peer's token cannot be used to take
+// the other peer's place while it is away
+func TestCredentialBoundToSlot(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	defer conns[0].Close()
+
+	// the second peer leaves; the first peer's token still only fits the
+	// first peer's slot, which is taken
+	conns[1].Close()
+	readType(t, conns[0], "peer_disconnected")
+
+	intruder := ts.reconnectWith(t, msgs[0]["sessionToken"])
+	defer intruder.Close()
+	if msg := readType(t, intruder, "failed"); msg["error"] != session.ErrSlotTaken.Error() {
+		t.Errorf("Expected %q, got %v", session.ErrSlotTaken, msg["error"])
+	}
+
+	back := ts.reconnectWith(t, msgs[1]["sessionToken"])
+	defer back.Close()
+	if msg := readType(t, back, "connected"); msg["peerId"] != msgs[1]["peerId"] {
+		t.Errorf("Expected to come back as %v, got %v", msgs[1]["peerId"], msg["peerId"])
+	}
+
+	t.Log("Credentials only open their own slot!")
+}
+
+// TestReuseReportedOnReturn verifies a peer that was away when its stale
+// token was presented is told once it is back
+func TestReuseReportedOnReturn(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	conns[1].Close()
+	oldToken := msgs[0]["sessionToken"]
+
+	// the first peer drops and comes back, then drops again
+	conns[0].Close()
+	time.Sleep(100 * time.Millisecond)
+	back := ts.reconnectWith(t, oldToken)
+	newToken := readType(t, back, "connected")["sessionToken"]
+	back.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	thief := ts.reconnectWith(t, oldToken)
+	defer thief.Close()
+	readType(t, thief, "failed")
+
+	again := ts.reconnectWith(t, newToken)
+	defer again.Close()
+	readType(t, again, "connected")
+	if msg := readType(t, again, "credential_reused"); msg["peerId"] != msgs[0]["peerId"] {
+		t.Errorf("Expected the returning peer to hear of the reuse, got %v", msg)
+	}
+
+	t.Log("Reuse is reported to the peer when it returns!")
+}
+
+// TestKickedPeerCredentialRefused verifies a kicked peer's own token stops
+// working
+func TestKickedPeerCredentialRefused(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	defer conns[0].Close()
+	defer conns[1].Close()
+
+	creator, kicked := 0, 1
+	if msgs[0]["peerId"] != "p1" {
+		creator, kicked = 1, 0
+	}
+	conns[creator].WriteJSON(map[string]any{"type": "kick", "to": msgs[kicked]["peerId"]})
+	readType(t, conns[kicked], "kicked")
+	readType(t, conns[creator], "connected")
+
+	again := ts.reconnectWith(t, msgs[kicked]["sessionToken"])
+	defer again.Close()
+	if msg := readType(t, again, "failed"); msg["error"] != session.ErrStaleCredential.Error() {
+		t.Errorf("Expected %q, got %v", session.ErrStaleCredential, msg["error"])
+	}
+
+	t.Log("Kicked peer's token is retired!")
+}
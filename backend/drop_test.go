@@ -0,0 +1,241 @@
+package main
+
+// Drop tests - claiming names, listening as the owner and routing visitors.
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"frop/internal/drop"
+	"frop/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// claimDrop claims name with secret and returns the response
+func (ts *testServer) claimDrop(t *testing.T, name, secret string) *http.Response {
+	t.Helper()
+
+	body, _ := json.Marshal(models.ClaimDropRequest{Name: name, Secret: secret})
+	resp, err := http.Post(ts.URL+"/api/drop", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to claim drop: %v", err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+// listen makes a new connection the owner's listening device for name
+func (ts *testServer) listen(t *testing.T, name, secret string) *websocket.Conn {
+	t.Helper()
+
+	owner := ts.dialWS(t)
+	owner.WriteJSON(map[string]string{"type": "listen", "code": name, "secret": secret})
+	readType(t, owner, "listening")
+	return owner
+}
+
+// =============================================================================
+// Claiming
+// =============================================================================
+
+// TestClaimDrop verifies a name can be claimed, renewed by its owner and
+// not taken by anyone else
+func TestClaimDrop(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	if resp := ts.claimDrop(t, "@Alice", "hunter2"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 claiming a free name, got %d", resp.StatusCode)
+	}
+	if resp := ts.claimDrop(t, "alice", "hunter2"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 renewing with the same secret, got %d", resp.StatusCode)
+	}
+	if resp := ts.claimDrop(t, "alice", "other"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409 claiming a taken name, got %d", resp.StatusCode)
+	}
+	if resp := ts.claimDrop(t, "a!", "hunter2"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid name, got %d", resp.StatusCode)
+	}
+
+	resp, err := http.Get(ts.URL + "/api/drop/alice")
+	if err != nil {
+		t.Fatalf("Failed to get drop: %v", err)
+	}
+	defer resp.Body.Close()
+	var status models.DropResponse
+	json.NewDecoder(resp.Body).Decode(&status)
+	if status.Name != "alice" || status.Online {
+		t.Errorf("Expected offline drop alice, got %+v", status)
+	}
+
+	t.Log("Names are claimed, renewed and protected!")
+}
+
+// TestReleaseDrop verifies only the claim secret releases a name
+func TestReleaseDrop(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	ts.claimDrop(t, "alice", "hunter2")
+
+	release := func(secret string) int {
+		body, _ := json.Marshal(models.ClaimDropRequest{Secret: secret})
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/drop/alice", bytes.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to release drop: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := release("wrong"); status != http.StatusForbidden {
+		t.Errorf("Expected 403 with the wrong secret, got %d", status)
+	}
+	if status := release("hunter2"); status != http.StatusNoContent {
+		t.Errorf("Expected 204 with the claim secret, got %d", status)
+	}
+	if resp := ts.claimDrop(t, "alice", "other"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected a released name to be free, got %d", resp.StatusCode)
+	}
+
+	t.Log("Only the owner releases a name!")
+}
+
+// TestClaimTokenRequired verifies an operator can restrict who claims names
+func TestClaimTokenRequired(t *testing.T) {
+	defer cleanup()
+	drop.SetClaimToken("s3cret")
+	defer drop.SetClaimToken("")
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	if resp := ts.claimDrop(t, "alice", "hunter2"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the claim token, got %d", resp.StatusCode)
+	}
+
+	body, _ := json.Marshal(models.ClaimDropRequest{Name: "alice", Secret: "hunter2"})
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/api/drop", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to claim drop: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 with the claim token, got %d", resp.StatusCode)
+	}
+
+	t.Log("Claim token gates claiming!")
+}
+
+// =============================================================================
+// Routing
+// =============================================================================
+
+// TestDropRoutesVisitor verifies a visitor joining a name is paired with
+// the owner's device through a fresh room, the owner as its creator
+func TestDropRoutesVisitor(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	ts.claimDrop(t, "alice", "hunter2")
+	owner := ts.listen(t, "alice", "hunter2")
+	defer owner.Close()
+
+	visitor := ts.dialWS(t)
+	defer visitor.Close()
+	visitor.WriteJSON(map[string]string{"type": "join", "code": "Alice"})
+	routed := readType(t, visitor, "routed")
+
+	request := readType(t, owner, "drop_request")
+	if request["code"] != routed["code"] || request["code"] == "" {
+		t.Fatalf("Owner and visitor disagree on the room: %v vs %v", request, routed)
+	}
+
+	// the creator's seat is kept for the owner
+	intruder := ts.dialWS(t)
+	defer intruder.Close()
+	intruder.WriteJSON(map[string]any{"type": "join", "code": request["code"]})
+	if msg := readType(t, intruder, "failed"); msg["error"] != "room full" {
+		t.Errorf("Expected room full without the host key, got %v", msg)
+	}
+
+	// the owner meets the visitor on a fresh connection
+	device := ts.dialWS(t)
+	defer device.Close()
+	device.WriteJSON(map[string]any{"type": "join", "code": request["code"], "secret": request["secret"]})
+	if msg := readType(t, device, "connected"); msg["peerId"] != "p1" {
+		t.Errorf("Expected the owner in the creator's seat, got %v", msg["peerId"])
+	}
+	if msg := readType(t, visitor, "connected"); msg["peerId"] != "p2" {
+		t.Errorf("Expected the visitor as p2, got %v", msg["peerId"])
+	}
+
+	// a second visitor gets a room of its own
+	other := ts.dialWS(t)
+	defer other.Close()
+	other.WriteJSON(map[string]string{"type": "join", "code": "alice"})
+	if again := readType(t, other, "routed"); again["code"] == routed["code"] {
+		t.Errorf("Expected a fresh room per visitor, both got %v", again["code"])
+	}
+
+	t.Log("Visitors are routed to the owner!")
+}
+
+// TestDropOwnerAway verifies visitors are refused while no device listens,
+// including after the listener disconnects
+func TestDropOwnerAway(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	ts.claimDrop(t, "alice", "hunter2")
+
+	visitor := ts.dialWS(t)
+	defer visitor.Close()
+	visitor.WriteJSON(map[string]string{"type": "join", "code": "alice"})
+	if msg := readType(t, visitor, "failed"); msg["error"] != drop.ErrOwnerAway.Error() {
+		t.Errorf("Expected %q, got %v", drop.ErrOwnerAway, msg["error"])
+	}
+
+	owner := ts.listen(t, "alice", "hunter2")
+	owner.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	visitor.WriteJSON(map[string]string{"type": "join", "code": "alice"})
+	readType(t, visitor, "failed")
+
+	t.Log("Visitors are refused while the owner is away!")
+}
+
+// TestListenWrongSecret verifies only the claim secret listens on a name
+func TestListenWrongSecret(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	ts.claimDrop(t, "alice", "hunter2")
+
+	conn := ts.dialWS(t)
+	defer conn.Close()
+	conn.WriteJSON(map[string]string{"type": "listen", "code": "alice", "secret": "guess"})
+	if msg := readType(t, conn, "failed"); msg["error"] != drop.ErrWrongSecret.Error() {
+		t.Errorf("Expected %q, got %v", drop.ErrWrongSecret, msg["error"])
+	}
+
+	t.Log("Wrong secret cannot listen!")
+}
@@ -58,8 +58,8 @@ func TestRoomExpirationKeepsActive(t *testing.T) {
 	defer peer1.Close()
 	defer peer2.Close()
 
-	peer1.WriteJSON(map[string]string{"type": "join", "code": code})
-	peer2.WriteJSON(map[string]string{"type": "join", "code": code})
+	joinFirst(t, peer1, code)
+	admit(t, peer1, peer2, code)
 
 	// Read connected messages
 	peer1.SetReadDeadline(time.Now().Add(2 * time.Second))
@@ -102,8 +102,8 @@ func TestSessionExpiration(t *testing.T) {
 	peer1 := ts.dialWS(t)
 	peer2 := ts.dialWS(t)
 
-	peer1.WriteJSON(map[string]string{"type": "join", "code": code})
-	peer2.WriteJSON(map[string]string{"type": "join", "code": code})
+	joinFirst(t, peer1, code)
+	admit(t, peer1, peer2, code)
 
 	// Get session token
 	peer1.SetReadDeadline(time.Now().Add(2 * time.Second))
@@ -153,8 +153,8 @@ func TestSessionLastSeenUpdated(t *testing.T) {
 	defer peer1.Close()
 	defer peer2.Close()
 
-	peer1.WriteJSON(map[string]string{"type": "join", "code": code})
-	peer2.WriteJSON(map[string]string{"type": "join", "code": code})
+	joinFirst(t, peer1, code)
+	admit(t, peer1, peer2, code)
 
 	// Get session
 	peer1.SetReadDeadline(time.Now().Add(2 * time.Second))
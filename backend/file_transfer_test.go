@@ -3,6 +3,8 @@ package main
 // File transfer tests - tests binary relay between peers.
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +13,7 @@ import (
 	"time"
 
 	"frop/internal/room"
+	"frop/internal/transfer"
 	"frop/internal/ws"
 	"frop/models"
 
@@ -406,6 +409,762 @@ func TestFileCancelByReceiver(t *testing.T) {
 	t.Log("Receiver cancel relay successful!")
 }
 
+// TestTransferAfterCancel verifies a cancel stops only its own transfer: the
+// next one on the same connection is relayed normally
+func TestTransferAfterCancel(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "name": "first.bin", "size": 100})
+	peer1.WriteMessage(websocket.BinaryMessage, make([]byte, 10))
+	peer1.WriteJSON(map[string]any{"type": "file_cancel", "name": "first.bin", "reason": "user_cancelled"})
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "name": "second.txt", "size": 5})
+	peer1.WriteMessage(websocket.BinaryMessage, []byte("hello"))
+	peer1.WriteJSON(map[string]any{"type": "file_end", "name": "second.txt"})
+
+	msg := readReport(t, peer1)
+	expectReport(t, msg, "file_complete", 5, "")
+	if msg["name"] != "second.txt" {
+		t.Errorf("Expected second.txt to complete, got %v", msg)
+	}
+
+	// the peer sees the first transfer start and stop before the second
+	for _, want := range []int{websocket.TextMessage, websocket.BinaryMessage, websocket.TextMessage} {
+		if msgType, data := nextTransferFrame(t, peer2); msgType != want {
+			t.Fatalf("Expected message type %d, got %d %q", want, msgType, data)
+		}
+	}
+	if data := receiveFile(t, peer2, "second.txt"); string(data) != "hello" {
+		t.Errorf("Expected \"hello\", got %q", data)
+	}
+
+	t.Log("Transfer after a cancel relayed!")
+}
+
+// =============================================================================
+// TRANSFER STATE TESTS
+// =============================================================================
+//
+// The server tracks each transfer: data must follow a file_start, may not
+// exceed its declared size, and file_end is answered with a server-authored
+// file_complete or file_error carrying the bytes actually relayed.
+
+// readReport reads the next file_complete, file_error, file_verified or
+// file_corrupt, skipping relayed frames
+func readReport(t *testing.T, conn *websocket.Conn) map[string]any {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected a transfer report, got error: %v", err)
+		}
+		var msg map[string]any
+		if msgType != websocket.TextMessage || json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		switch msg["type"] {
+		case "file_complete", "file_error", "file_verified", "file_corrupt":
+			return msg
+		}
+	}
+}
+
+// expectReport checks a report's type, relayed byte count and error
+func expectReport(t *testing.T, msg map[string]any, msgType string, relayed int, errText string) {
+	t.Helper()
+
+	if msg["type"] != msgType || msg["relayed"] != float64(relayed) || (errText != "" && msg["error"] != errText) {
+		t.Errorf("Expected %s with relayed=%d %q, got %v", msgType, relayed, errText, msg)
+	}
+}
+
+// TestFileCompleteReportsBytes verifies both sides are told what was relayed
+func TestFileCompleteReportsBytes(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "name": "a.bin", "size": 300})
+	peer1.WriteMessage(websocket.BinaryMessage, make([]byte, 100))
+	peer1.WriteMessage(websocket.BinaryMessage, make([]byte, 200))
+	peer1.WriteJSON(map[string]any{"type": "file_end", "name": "a.bin"})
+
+	expectReport(t, readReport(t, peer1), "file_complete", 300, "")
+	expectReport(t, readReport(t, peer2), "file_complete", 300, "")
+
+	t.Log("file_complete reported the relayed bytes!")
+}
+
+// TestBinaryOutsideTransferRefused verifies data without a file_start is
+// not relayed
+func TestBinaryOutsideTransferRefused(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteMessage(websocket.BinaryMessage, []byte("stray"))
+	msg := readReport(t, peer1)
+	if msg["type"] != "file_error" || msg["error"] != transfer.ErrNoTransfer.Error() {
+		t.Errorf("Expected file_error %q, got %v", transfer.ErrNoTransfer, msg)
+	}
+
+	peer2.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, data, err := peer2.ReadMessage(); err == nil {
+		t.Errorf("Expected nothing to reach the peer, got %q", data)
+	}
+
+	t.Log("Stray binary frame refused!")
+}
+
+// TestTransferOverrunFails verifies a frame past the declared size is not
+// relayed and fails the transfer for both sides
+func TestTransferOverrunFails(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "name": "a.bin", "size": 10})
+	peer1.WriteMessage(websocket.BinaryMessage, make([]byte, 8))
+	peer1.WriteMessage(websocket.BinaryMessage, make([]byte, 8))
+
+	expectReport(t, readReport(t, peer1), "file_error", 8, transfer.ErrOverrun.Error())
+	expectReport(t, readReport(t, peer2), "file_error", 8, transfer.ErrOverrun.Error())
+
+	// the transfer is over: its file_end is refused
+	peer1.WriteJSON(map[string]any{"type": "file_end", "name": "a.bin"})
+	if msg := readReport(t, peer1); msg["type"] != "file_error" || msg["error"] != transfer.ErrNoTransfer.Error() {
+		t.Errorf("Expected file_error %q, got %v", transfer.ErrNoTransfer, msg)
+	}
+
+	t.Log("Overrun stopped the transfer!")
+}
+
+// TestTransferShortFails verifies a file_end before the declared size is
+// answered with file_error instead of being relayed
+func TestTransferShortFails(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "name": "a.bin", "size": 100})
+	peer1.WriteMessage(websocket.BinaryMessage, make([]byte, 50))
+	peer1.WriteJSON(map[string]any{"type": "file_end", "name": "a.bin"})
+
+	expectReport(t, readReport(t, peer1), "file_error", 50, transfer.ErrIncomplete.Error())
+
+	// the peer sees the start, the data and the error, but no file_end
+	peer2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var types []any
+	for range 3 {
+		msgType, data, err := peer2.ReadMessage()
+		if err != nil {
+			t.Fatalf("Peer2 failed to read: %v", err)
+		}
+		var msg map[string]any
+		if msgType == websocket.BinaryMessage || json.Unmarshal(data, &msg) != nil {
+			types = append(types, "binary")
+			continue
+		}
+		types = append(types, msg["type"])
+	}
+	if types[0] != "file_start" || types[1] != "binary" || types[2] != "file_error" {
+		t.Errorf("Expected file_start, binary, file_error, got %v", types)
+	}
+
+	t.Log("Short transfer reported as an error!")
+}
+
+// TestSecondStartRefused verifies a sender finishes one transfer before
+// starting the next, and that sizes are 64-bit
+func TestSecondStartRefused(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	const big = int64(5) << 32 // 20 GiB
+	peer1.WriteJSON(map[string]any{"type": "file_start", "name": "big.iso", "size": big})
+	peer2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var startMsg map[string]any
+	peer2.ReadJSON(&startMsg)
+	if startMsg["size"] != float64(big) {
+		t.Errorf("Expected size=%d, got %v", big, startMsg["size"])
+	}
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "name": "b.txt", "size": 1})
+	msg := readReport(t, peer1)
+	if msg["type"] != "file_error" || msg["name"] != "b.txt" || msg["error"] != transfer.ErrTransferOpen.Error() {
+		t.Errorf("Expected file_error %q for b.txt, got %v", transfer.ErrTransferOpen, msg)
+	}
+
+	t.Log("Overlapping transfer refused!")
+}
+
+// TestFileVerified verifies a matching digest is relayed with file_end and
+// answered with file_verified carrying the server's own digest
+func TestFileVerified(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	content := []byte("checked all the way")
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "name": "c.txt", "size": len(content)})
+	peer1.WriteMessage(websocket.BinaryMessage, content[:7])
+	peer1.WriteMessage(websocket.BinaryMessage, content[7:])
+	peer1.WriteJSON(map[string]any{"type": "file_end", "name": "c.txt", "sha256": strings.ToUpper(digest)})
+
+	for _, peer := range []*websocket.Conn{peer1, peer2} {
+		msg := readReport(t, peer)
+		expectReport(t, msg, "file_verified", len(content), "")
+		if msg["sha256"] != digest {
+			t.Errorf("Expected sha256=%s, got %v", digest, msg["sha256"])
+		}
+	}
+
+	t.Log("Digest verified!")
+}
+
+// TestFileCorrupt verifies a mismatched digest fails the transfer for both
+// sides and keeps file_end from the receiver
+func TestFileCorrupt(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	sum := sha256.Sum256([]byte("what was sent"))
+	peer1.WriteJSON(map[string]any{"type": "file_start", "name": "c.txt", "size": 13})
+	peer1.WriteMessage(websocket.BinaryMessage, []byte("what was lost"))
+	peer1.WriteJSON(map[string]any{"type": "file_end", "name": "c.txt", "sha256": hex.EncodeToString(sum[:])})
+
+	expectReport(t, readReport(t, peer1), "file_corrupt", 13, transfer.ErrCorrupt.Error())
+
+	peer2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		msgType, data, err := peer2.ReadMessage()
+		if err != nil {
+			t.Fatalf("Peer2 failed to read: %v", err)
+		}
+		var msg map[string]any
+		if msgType == websocket.BinaryMessage || json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		if msg["type"] == "file_end" {
+			t.Fatalf("Expected file_end to be withheld, got %v", msg)
+		}
+		if msg["type"] == "file_corrupt" {
+			break
+		}
+	}
+
+	t.Log("Corrupt transfer caught!")
+}
+
+// =============================================================================
+// OFFER TESTS
+// =============================================================================
+//
+// A file_offer asks the recipient first: its data is refused until the
+// answer is file_accept, and an offer nobody answers times out.
+
+// TestOfferAccept verifies data is refused before the recipient accepts and
+// relayed after
+func TestOfferAccept(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_offer", "transferId": 4, "name": "a.txt", "size": 5})
+	if msg := readType(t, peer2, "file_offer"); msg["name"] != "a.txt" || msg["size"] != float64(5) {
+		t.Errorf("Expected the offer of a.txt, got %v", msg)
+	}
+
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(4, 0, []byte("early")))
+	if msg := readType(t, peer1, "file_error"); msg["error"] != transfer.ErrNotAccepted.Error() {
+		t.Errorf("Expected %q, got %v", transfer.ErrNotAccepted, msg)
+	}
+
+	peer2.WriteJSON(map[string]any{"type": "file_accept", "transferId": 4})
+	if msg := readType(t, peer1, "file_accept"); msg["name"] != "a.txt" || msg["transferId"] != float64(4) {
+		t.Errorf("Expected a.txt accepted, got %v", msg)
+	}
+
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(4, 0, []byte("hello")))
+	peer1.WriteJSON(map[string]any{"type": "file_end", "transferId": 4, "name": "a.txt"})
+	if _, frame := nextTransferFrame(t, peer2); !strings.HasSuffix(string(frame), "hello") {
+		t.Errorf("Expected the accepted data, got %q", frame)
+	}
+	readType(t, peer2, "file_end")
+	expectReport(t, readReport(t, peer1), "file_complete", 5, "")
+
+	t.Log("Offer accepted before any data flowed!")
+}
+
+// TestOfferReject verifies a rejected offer is relayed to the sender, its
+// data refused, and its ID free for the next offer
+func TestOfferReject(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_offer", "transferId": 4, "name": "huge.iso", "size": 1 << 30})
+	readType(t, peer2, "file_offer")
+	peer2.WriteJSON(map[string]any{"type": "file_reject", "transferId": 4, "reason": "user_rejected"})
+
+	if msg := readType(t, peer1, "file_reject"); msg["name"] != "huge.iso" || msg["reason"] != "user_rejected" {
+		t.Errorf("Expected huge.iso rejected, got %v", msg)
+	}
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(4, 0, []byte("anyway")))
+	if msg := readType(t, peer1, "file_error"); msg["error"] != transfer.ErrRejected.Error() {
+		t.Errorf("Expected %q, got %v", transfer.ErrRejected, msg)
+	}
+
+	peer1.WriteJSON(map[string]any{"type": "file_offer", "transferId": 4, "name": "small.txt", "size": 1})
+	if msg := readType(t, peer2, "file_offer"); msg["name"] != "small.txt" {
+		t.Errorf("Expected the next offer, got %v", msg)
+	}
+
+	t.Log("Offer rejected!")
+}
+
+// TestOfferExpires verifies both sides are told when nobody answers, and a
+// late answer is refused
+func TestOfferExpires(t *testing.T) {
+	defer cleanup()
+	transfer.SetOfferTimeout(200 * time.Millisecond)
+	defer transfer.SetOfferTimeout(time.Minute)
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_offer", "transferId": 4, "name": "a.txt", "size": 5})
+	readType(t, peer2, "file_offer")
+
+	for _, peer := range []*websocket.Conn{peer1, peer2} {
+		if msg := readType(t, peer, "file_error"); msg["error"] != transfer.ErrOfferExpired.Error() || msg["name"] != "a.txt" {
+			t.Errorf("Expected %q for a.txt, got %v", transfer.ErrOfferExpired, msg)
+		}
+	}
+
+	peer2.WriteJSON(map[string]any{"type": "file_accept", "transferId": 4})
+	if msg := readType(t, peer2, "file_error"); msg["error"] != transfer.ErrNoOffer.Error() {
+		t.Errorf("Expected %q, got %v", transfer.ErrNoOffer, msg)
+	}
+
+	t.Log("Unanswered offer timed out!")
+}
+
+// TestOfferPerRecipient verifies that in a group, data only reaches the
+// members that accepted: one that declined hears nothing more, and the
+// sender only hears of a rejection once everyone has declined
+func TestOfferPerRecipient(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createGroupRoom(t, 4)
+	peers := ts.joinGroup(t, code, 4)
+	for _, p := range peers {
+		defer p.Close()
+	}
+	sender, taker, decliner, late := peers[0], peers[1], peers[2], peers[3]
+
+	sender.WriteJSON(map[string]any{"type": "file_offer", "transferId": 4, "name": "a.txt", "size": 5})
+	for _, p := range peers[1:] {
+		readType(t, p, "file_offer")
+	}
+
+	decliner.WriteJSON(map[string]any{"type": "file_reject", "transferId": 4, "reason": "user_rejected"})
+	taker.WriteJSON(map[string]any{"type": "file_accept", "transferId": 4})
+	if msg := readType(t, sender, "file_accept"); msg["from"] != "p2" {
+		t.Errorf("Expected p2's acceptance alone, got %v", msg)
+	}
+
+	sender.WriteMessage(websocket.BinaryMessage, transfer.Frame(4, 0, []byte("hello")))
+	sender.WriteJSON(map[string]any{"type": "file_end", "transferId": 4, "name": "a.txt"})
+	if _, frame := nextTransferFrame(t, taker); !strings.HasSuffix(string(frame), "hello") {
+		t.Errorf("Expected the accepted data, got %q", frame)
+	}
+	readType(t, taker, "file_end")
+	expectReport(t, readReport(t, sender), "file_complete", 5, "")
+	expectReport(t, readReport(t, taker), "file_complete", 5, "")
+
+	// too late to accept once the data has flowed
+	late.WriteJSON(map[string]any{"type": "file_accept", "transferId": 4})
+	if msg := readType(t, late, "file_error"); msg["error"] != transfer.ErrNoOffer.Error() {
+		t.Errorf("Expected %q, got %v", transfer.ErrNoOffer, msg)
+	}
+
+	// a file everyone declines is rejected, and the sender told once. The
+	// next the first decliner hears is this offer: nothing of a.txt reached it.
+	sender.WriteJSON(map[string]any{"type": "file_offer", "transferId": 5, "name": "b.txt", "size": 5})
+	for _, p := range peers[1:] {
+		if msg := readType(t, p, "file_offer"); msg["name"] != "b.txt" {
+			t.Errorf("Expected the offer of b.txt, got %v", msg)
+		}
+		p.WriteJSON(map[string]any{"type": "file_reject", "transferId": 5, "reason": "user_rejected"})
+	}
+	if msg := readType(t, sender, "file_reject"); msg["name"] != "b.txt" {
+		t.Errorf("Expected b.txt rejected, got %v", msg)
+	}
+	expectSilence(t, sender)
+
+	t.Log("Offer answered member by member!")
+}
+
+// =============================================================================
+// FLOW CONTROL TESTS
+// =============================================================================
+//
+// A sender is told to pause when a recipient stops taking its frame, and to
+// resume once it has. One that starts with "flow" is also granted credit as
+// its frames are relayed, and may not send past it.
+
+// TestFlowCredit verifies credit is granted up front and again as frames
+// reach the recipient
+func TestFlowCredit(t *testing.T) {
+	defer cleanup()
+	transfer.SetWindow(8)
+	defer transfer.SetWindow(16 << 20)
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "transferId": 3, "name": "a.bin", "size": 12, "flow": true})
+	if msg := readType(t, peer1, "credit"); msg["credit"] != float64(8) || msg["transferId"] != float64(3) {
+		t.Errorf("Expected the window as credit, got %v", msg)
+	}
+	nextTransferFrame(t, peer2)
+
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(3, 0, make([]byte, 8)))
+	readChunk(t, peer2, 3)
+	if msg := readType(t, peer1, "credit"); msg["credit"] != float64(8) {
+		t.Errorf("Expected the relayed frame back as credit, got %v", msg)
+	}
+
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(3, 1, make([]byte, 4)))
+	readChunk(t, peer2, 3)
+	if msg := readType(t, peer1, "credit"); msg["credit"] != float64(4) {
+		t.Errorf("Expected 4 bytes of credit, got %v", msg)
+	}
+
+	peer1.WriteJSON(map[string]any{"type": "file_end", "transferId": 3, "name": "a.bin"})
+	expectReport(t, readReport(t, peer1), "file_complete", 12, "")
+
+	t.Log("Credit granted as the data drained!")
+}
+
+// TestFlowCreditExceeded verifies a frame past the sender's credit fails
+// its transfer
+func TestFlowCreditExceeded(t *testing.T) {
+	defer cleanup()
+	transfer.SetWindow(8)
+	defer transfer.SetWindow(16 << 20)
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "transferId": 3, "name": "a.bin", "size": 20, "flow": true})
+	readType(t, peer1, "credit")
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(3, 0, make([]byte, 12)))
+
+	expectReport(t, readReport(t, peer1), "file_error", 0, transfer.ErrNoCredit.Error())
+
+	t.Log("Sending past the credit failed the transfer!")
+}
+
+// TestPauseSlowRecipient verifies a sender is paused while a recipient
+// does not read its frames, and resumed once it does
+func TestPauseSlowRecipient(t *testing.T) {
+	defer cleanup()
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	const frames, size = 8, 4 << 20
+	peer1.WriteJSON(map[string]any{"type": "file_start", "transferId": 3, "name": "a.bin", "size": frames * size})
+	nextTransferFrame(t, peer2)
+
+	// more than the sockets in between can hold, so peer2 holds them up
+	go func() {
+		for i := range frames {
+			peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(3, uint32(i), make([]byte, size)))
+		}
+	}()
+	peer1.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg map[string]any
+	if err := peer1.ReadJSON(&msg); err != nil || msg["type"] != "pause" {
+		t.Fatalf("Expected pause, got %v %v", msg, err)
+	}
+
+	for range frames {
+		readChunk(t, peer2, 3)
+	}
+	readType(t, peer1, "resume")
+
+	t.Log("Sender paused for a slow recipient and resumed!")
+}
+
+// =============================================================================
+// STREAMING TESTS
+// =============================================================================
+//
+// Frames stream from the sender to its recipients a piece at a time, and
+// may carry no more than the configured maximum.
+
+// TestStreamLargeFrame verifies a frame spanning many pieces arrives whole
+// and verifies against its digest
+func TestStreamLargeFrame(t *testing.T) {
+	defer cleanup()
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	content := []byte(strings.Repeat("frop", 25000))
+	peer1.WriteJSON(map[string]any{"type": "file_start", "transferId": 3, "name": "a.bin", "size": len(content)})
+	nextTransferFrame(t, peer2)
+
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(3, 0, content))
+	if data := readChunk(t, peer2, 3); string(data) != string(content) {
+		t.Fatalf("Expected %d bytes intact, got %d", len(content), len(data))
+	}
+
+	sum := sha256.Sum256(content)
+	peer1.WriteJSON(map[string]any{"type": "file_end", "transferId": 3, "name": "a.bin", "sha256": hex.EncodeToString(sum[:])})
+	expectReport(t, readReport(t, peer1), "file_verified", len(content), "")
+
+	t.Log("Large frame streamed through intact!")
+}
+
+// TestStreamMaxFrame verifies a frame past the maximum closes the sender's
+// connection before any of it is relayed
+func TestStreamMaxFrame(t *testing.T) {
+	defer cleanup()
+	transfer.SetMaxFrame(1024)
+	defer transfer.SetMaxFrame(8 << 20)
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "transferId": 3, "name": "a.bin", "size": 4096})
+	nextTransferFrame(t, peer2)
+
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(3, 0, make([]byte, 2048)))
+	peer1.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := peer1.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+				t.Errorf("Expected close 1009, got %v", err)
+			}
+			break
+		}
+	}
+	readType(t, peer2, "file_interrupted")
+
+	t.Log("Oversized frame closed the sender's connection!")
+}
+
+// =============================================================================
+// CONCURRENT TRANSFER TESTS
+// =============================================================================
+//
+// Transfers with a transferId carry a frame header (see transfer.Frame), so
+// one sender can interleave several of them on one socket.
+
+// TestConcurrentTransfers verifies two interleaved transfers arrive intact
+// and are reported separately
+func TestConcurrentTransfers(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "transferId": 7, "name": "a.txt", "size": 6})
+	peer1.WriteJSON(map[string]any{"type": "file_start", "transferId": 9, "name": "b.txt", "size": 6})
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(7, 0, []byte("aaa")))
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(9, 0, []byte("bbb")))
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(9, 1, []byte("BBB")))
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(7, 1, []byte("AAA")))
+	peer1.WriteJSON(map[string]any{"type": "file_end", "transferId": 9, "name": "b.txt"})
+	peer1.WriteJSON(map[string]any{"type": "file_end", "transferId": 7, "name": "a.txt"})
+
+	got := map[uint32][]byte{}
+	ended := map[any]bool{}
+	peer2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(ended) < 2 {
+		msgType, data, err := peer2.ReadMessage()
+		if err != nil {
+			t.Fatalf("Peer2 failed to read: %v", err)
+		}
+		if msgType == websocket.BinaryMessage {
+			h, chunk, err := transfer.ParseFrame(data)
+			if err != nil {
+				t.Fatalf("Relayed frame lost its header: %v", err)
+			}
+			got[h.ID] = append(got[h.ID], chunk...)
+			continue
+		}
+		var msg map[string]any
+		json.Unmarshal(data, &msg)
+		if msg["type"] == "file_complete" {
+			ended[msg["transferId"]] = true
+		}
+	}
+	if string(got[7]) != "aaaAAA" || string(got[9]) != "bbbBBB" {
+		t.Errorf("Expected aaaAAA and bbbBBB, got %q and %q", got[7], got[9])
+	}
+
+	t.Log("Interleaved transfers arrived intact!")
+}
+
+// TestFrameOutOfOrderFails verifies a skipped sequence number fails only
+// the transfer it belongs to
+func TestFrameOutOfOrderFails(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "transferId": 1, "name": "a.txt", "size": 6})
+	peer1.WriteJSON(map[string]any{"type": "file_start", "transferId": 2, "name": "b.txt", "size": 3})
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(1, 1, []byte("aaa")))
+
+	msg := readReport(t, peer1)
+	expectReport(t, msg, "file_error", 0, transfer.ErrOutOfOrder.Error())
+	if msg["transferId"] != float64(1) {
+		t.Errorf("Expected the error for transfer 1, got %v", msg)
+	}
+
+	// the other transfer carries on
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(2, 0, []byte("bbb")))
+	peer1.WriteJSON(map[string]any{"type": "file_end", "transferId": 2, "name": "b.txt"})
+	msg = readReport(t, peer1)
+	expectReport(t, msg, "file_complete", 3, "")
+	if msg["transferId"] != float64(2) {
+		t.Errorf("Expected transfer 2 to complete, got %v", msg)
+	}
+
+	t.Log("Out-of-order frame failed its transfer only!")
+}
+
+// TestBadFrameRefused verifies frames without a valid header are refused
+// while transfers with an ID are open, and that a bare transfer cannot
+// share the connection
+func TestBadFrameRefused(t *testing.T) {
+	defer cleanup()
+
+	server, wsURL := setupTestServer()
+	defer server.Close()
+
+	peer1, peer2, _ := establishSession(t, server, wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "transferId": 1, "name": "a.txt", "size": 3})
+	peer1.WriteMessage(websocket.BinaryMessage, []byte("abc"))
+	if msg := readReport(t, peer1); msg["error"] != transfer.ErrBadFrame.Error() {
+		t.Errorf("Expected file_error %q, got %v", transfer.ErrBadFrame, msg)
+	}
+
+	peer1.WriteMessage(websocket.BinaryMessage, transfer.Frame(5, 0, []byte("abc")))
+	if msg := readReport(t, peer1); msg["error"] != transfer.ErrNoTransfer.Error() || msg["transferId"] != float64(5) {
+		t.Errorf("Expected file_error %q for transfer 5, got %v", transfer.ErrNoTransfer, msg)
+	}
+
+	peer1.WriteJSON(map[string]any{"type": "file_start", "name": "bare.txt", "size": 3})
+	if msg := readReport(t, peer1); msg["error"] != transfer.ErrTransferOpen.Error() {
+		t.Errorf("Expected file_error %q, got %v", transfer.ErrTransferOpen, msg)
+	}
+
+	t.Log("Bad frames refused!")
+}
+
 // =============================================================================
 // HELPER FUNCTIONS
 // =============================================================================
@@ -450,9 +1209,9 @@ func establishSession(t *testing.T, server *httptest.Server, wsURL string) (*web
 		t.Fatalf("Peer2 failed to connect: %v", err)
 	}
 
-	// Both join
-	peer1.WriteJSON(map[string]string{"type": "join", "code": code})
-	peer2.WriteJSON(map[string]string{"type": "join", "code": code})
+	// peer1 creates, and lets peer2 in
+	joinFirst(t, peer1, code)
+	admit(t, peer1, peer2, code)
 
 	// Read connected messages
 	peer1.SetReadDeadline(time.Now().Add(2 * time.Second))
@@ -475,17 +1234,16 @@ func establishSession(t *testing.T, server *httptest.Server, wsURL string) (*web
 	return peer1, peer2, sessionToken
 }
 
-// receiveFile reads file_start, binary data, and file_end, returning the data
+// receiveFile reads file_start, binary data, and file_end, returning the data.
+// Reports on the connection's own transfers, which may arrive in between,
+// are skipped.
 func receiveFile(t *testing.T, conn *websocket.Conn, expectedName string) []byte {
 	t.Helper()
 
 	// Read file_start
 	var startMsg map[string]any
-	if err := conn.ReadJSON(&startMsg); err != nil {
-		t.Fatalf("Failed to read file_start: %v", err)
-	}
-	if startMsg["type"] != "file_start" {
-		t.Fatalf("Expected file_start, got %v", startMsg)
+	if _, data := nextTransferFrame(t, conn); json.Unmarshal(data, &startMsg) != nil || startMsg["type"] != "file_start" {
+		t.Fatalf("Expected file_start, got %s", data)
 	}
 	if startMsg["name"] != expectedName {
 		t.Fatalf("Expected name=%s, got %v", expectedName, startMsg["name"])
@@ -494,10 +1252,7 @@ func receiveFile(t *testing.T, conn *websocket.Conn, expectedName string) []byte
 	expectedSize := int(startMsg["size"].(float64))
 
 	// Read binary data
-	msgType, data, err := conn.ReadMessage()
-	if err != nil {
-		t.Fatalf("Failed to read binary data: %v", err)
-	}
+	msgType, data := nextTransferFrame(t, conn)
 	if msgType != websocket.BinaryMessage {
 		t.Fatalf("Expected binary message, got type %d", msgType)
 	}
@@ -507,12 +1262,26 @@ func receiveFile(t *testing.T, conn *websocket.Conn, expectedName string) []byte
 
 	// Read file_end
 	var endMsg map[string]any
-	if err := conn.ReadJSON(&endMsg); err != nil {
-		t.Fatalf("Failed to read file_end: %v", err)
-	}
-	if endMsg["type"] != "file_end" {
-		t.Fatalf("Expected file_end, got %v", endMsg)
+	if _, raw := nextTransferFrame(t, conn); json.Unmarshal(raw, &endMsg) != nil || endMsg["type"] != "file_end" {
+		t.Fatalf("Expected file_end, got %s", raw)
 	}
 
 	return data
 }
+
+// nextTransferFrame reads the next frame that is not a file_complete
+func nextTransferFrame(t *testing.T, conn *websocket.Conn) (int, []byte) {
+	t.Helper()
+
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read transfer frame: %v", err)
+		}
+		var msg map[string]any
+		if msgType == websocket.TextMessage && json.Unmarshal(data, &msg) == nil && msg["type"] == "file_complete" {
+			continue
+		}
+		return msgType, data
+	}
+}
@@ -1,6 +1,6 @@
 module frop
 
-go 1.22
+go 1.24
 
 require github.com/gorilla/websocket v1.5.1
 
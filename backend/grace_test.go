@@ -0,0 +1,87 @@
+package main
+
+// Disconnect grace tests - holding a dropped peer's slot, buffering small
+// messages for it, and reporting it gone once the window closes.
+
+import (
+	"testing"
+	"time"
+
+	"frop/internal/session"
+)
+
+// useGrace sets the reconnect grace window until the returned function is
+// called
+func useGrace(d time.Duration) func() {
+	session.SetGrace(d)
+	return func() { session.SetGrace(0) }
+}
+
+// =============================================================================
+// Grace window
+// =============================================================================
+
+// TestGraceHoldsClipboard verifies a peer that drops and comes back within
+// the window gets the clipboard messages sent meanwhile
+func TestGraceHoldsClipboard(t *testing.T) {
+	defer cleanup()
+	defer useGrace(2 * time.Second)()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	defer conns[1].Close()
+
+	conns[0].Close()
+	if msg := readType(t, conns[1], "peer_reconnecting"); msg["peerId"] != msgs[0]["peerId"] {
+		t.Errorf("Expected %v to be reconnecting, got %v", msgs[0]["peerId"], msg)
+	}
+
+	conns[1].WriteJSON(map[string]string{"type": "clipboard", "content": "while you were away"})
+
+	back := ts.reconnectWith(t, msgs[0]["sessionToken"])
+	defer back.Close()
+	readType(t, back, "connected")
+	if msg := readType(t, back, "clipboard"); msg["content"] != "while you were away" || msg["from"] != msgs[1]["peerId"] {
+		t.Errorf("Expected the held clipboard, got %v", msg)
+	}
+	readType(t, conns[1], "connected")
+
+	t.Log("Clipboard held through a reconnect!")
+}
+
+// TestGraceExpires verifies the remaining peer is told the other is gone
+// only once the window closes
+func TestGraceExpires(t *testing.T) {
+	defer cleanup()
+	defer useGrace(300 * time.Millisecond)()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, _ := ts.pairWithTokens(t)
+	defer conns[1].Close()
+
+	start := time.Now()
+	conns[0].Close()
+	readType(t, conns[1], "peer_reconnecting")
+
+	// file transfers cannot wait for the peer
+	conns[1].WriteJSON(map[string]any{"type": "file_start", "name": "a.txt", "size": 1})
+	if msg := readType(t, conns[1], "failed"); msg["error"] != session.ErrPeerReconnecting.Error() {
+		t.Errorf("Expected %q, got %v", session.ErrPeerReconnecting, msg["error"])
+	}
+
+	readType(t, conns[1], "peer_disconnected")
+	if waited := time.Since(start); waited < 300*time.Millisecond {
+		t.Errorf("Expected peer_disconnected after the grace window, got it after %v", waited)
+	}
+
+	conns[1].WriteJSON(map[string]string{"type": "clipboard", "content": "too late"})
+	if msg := readType(t, conns[1], "failed"); msg["error"] != session.ErrPeerDisconnected.Error() {
+		t.Errorf("Expected %q, got %v", session.ErrPeerDisconnected, msg["error"])
+	}
+
+	t.Log("Drop reported once the grace window closed!")
+}
@@ -0,0 +1,202 @@
+package main
+
+// Group room tests - rooms with more than two peers, roster updates, and
+// targeted vs broadcast relay.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"frop/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// createGroupRoom creates a room for capacity peers via the API
+func (ts *testServer) createGroupRoom(t *testing.T, capacity int) string {
+	t.Helper()
+
+	body, _ := json.Marshal(models.CreateRoomRequest{Capacity: capacity})
+	resp, err := http.Post(ts.URL+"/api/room", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result models.RoomResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	if result.Capacity != capacity {
+		t.Fatalf("Expected capacity %d, got %+v", capacity, result)
+	}
+	return result.Code
+}
+
+// joinGroup fills a group room with n peers, one at a time, the first
+// approving the rest, consuming the connected/roster messages each join
+// produces
+func (ts *testServer) joinGroup(t *testing.T, code string, n int) []*websocket.Conn {
+	t.Helper()
+
+	var peers []*websocket.Conn
+	for i := range n {
+		conn := ts.dialWS(t)
+		if i == 0 {
+			joinFirst(t, conn, code)
+		} else {
+			admit(t, peers[0], conn, code)
+		}
+		peers = append(peers, conn)
+
+		switch {
+		case i == 1:
+			// The second peer completes the pair: both get connected
+			readType(t, peers[0], "connected")
+			readType(t, peers[1], "connected")
+		case i > 1:
+			msg := readType(t, conn, "connected")
+			if msg["peerId"] != fmt.Sprintf("p%d", i+1) {
+				t.Fatalf("Expected peer %d to get ID p%d, got %v", i, i+1, msg["peerId"])
+			}
+			for _, existing := range peers[:i] {
+				roster := readType(t, existing, "roster")
+				if len(roster["peers"].([]any)) != i+1 {
+					t.Fatalf("Expected roster of %d, got %v", i+1, roster["peers"])
+				}
+			}
+		}
+	}
+	return peers
+}
+
+// TestGroupRoomJoin verifies a capacity-3 room accepts three peers, assigns
+// IDs in join order, and rejects a fourth
+func TestGroupRoomJoin(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createGroupRoom(t, 3)
+	peers := ts.joinGroup(t, code, 3)
+	for _, p := range peers {
+		defer p.Close()
+	}
+
+	extra := ts.dialWS(t)
+	defer extra.Close()
+	msg := joinRoom(t, extra, code)
+	if msg["type"] != "failed" || msg["error"] != "room full" {
+		t.Errorf("Expected 4th peer rejected with room full, got %v", msg)
+	}
+
+	t.Log("Group room filled to capacity!")
+}
+
+// TestGroupClipboardBroadcast verifies an untargeted message reaches every
+// other member, stamped with the sender's ID
+func TestGroupClipboardBroadcast(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createGroupRoom(t, 3)
+	peers := ts.joinGroup(t, code, 3)
+	for _, p := range peers {
+		defer p.Close()
+	}
+
+	peers[0].WriteJSON(map[string]string{"type": "clipboard", "content": "to everyone"})
+
+	for _, p := range peers[1:] {
+		msg := readType(t, p, "clipboard")
+		if msg["content"] != "to everyone" || msg["from"] != "p1" {
+			t.Errorf("Expected broadcast from p1, got %v", msg)
+		}
+	}
+	expectSilence(t, peers[0])
+
+	t.Log("Clipboard broadcast to all members!")
+}
+
+// TestGroupTargetedFile verifies a file_start with a target routes its
+// binary frames and file_end only to that peer
+func TestGroupTargetedFile(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createGroupRoom(t, 3)
+	peers := ts.joinGroup(t, code, 3)
+	for _, p := range peers {
+		defer p.Close()
+	}
+
+	data := []byte("only for p3")
+	peers[0].WriteJSON(map[string]any{"type": "file_start", "name": "a.txt", "size": len(data), "to": "p3"})
+	peers[0].WriteMessage(websocket.BinaryMessage, data)
+	peers[0].WriteJSON(map[string]any{"type": "file_end", "name": "a.txt"})
+
+	peers[2].SetReadDeadline(time.Now().Add(2 * time.Second))
+	if got := receiveFile(t, peers[2], "a.txt"); string(got) != string(data) {
+		t.Errorf("p3 received wrong data: %q", got)
+	}
+	expectSilence(t, peers[1])
+
+	t.Log("Targeted file reached only its recipient!")
+}
+
+// TestGroupBroadcastFile verifies binary frames of an untargeted transfer
+// reach every other member
+func TestGroupBroadcastFile(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createGroupRoom(t, 3)
+	peers := ts.joinGroup(t, code, 3)
+	for _, p := range peers {
+		defer p.Close()
+	}
+
+	data := []byte("artifact for everyone")
+	peers[1].WriteJSON(map[string]any{"type": "file_start", "name": "build.zip", "size": len(data)})
+	peers[1].WriteMessage(websocket.BinaryMessage, data)
+	peers[1].WriteJSON(map[string]any{"type": "file_end", "name": "build.zip"})
+
+	for _, p := range []*websocket.Conn{peers[0], peers[2]} {
+		p.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if got := receiveFile(t, p, "build.zip"); string(got) != string(data) {
+			t.Errorf("Received wrong data: %q", got)
+		}
+	}
+
+	t.Log("Broadcast file reached every member!")
+}
+
+// TestGroupCapacityLimit verifies the API rejects capacities above the cap
+func TestGroupCapacityLimit(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/room", "application/json", strings.NewReader(`{"capacity": 1000}`))
+	if err != nil {
+		t.Fatalf("Failed to POST: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for oversized room, got %d", resp.StatusCode)
+	}
+
+	t.Log("Oversized room rejected!")
+}
@@ -0,0 +1,191 @@
+package codes
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Alphabets for Random mode
+const (
+	Alphanumeric = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	Unambiguous  = "ABCDEFGHJKMNPQRSTUVWXYZ23456789" // no 0/O, 1/I/L
+	Digits       = "0123456789"                      // for TV remotes and keypads
+)
+
+const (
+	letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	// wordChars are the characters a word code is checksummed over
+	wordChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+var (
+	ErrMalformed = errors.New("malformed code")
+	ErrChecksum  = errors.New("code check character mismatch")
+)
+
+type Mode string
+
+const (
+	Classic Mode = "classic" // ABC123: three letters, three digits
+	Random  Mode = "random"  // Length characters drawn from Alphabet
+	Words   Mode = "words"   // purple-tiger-42
+)
+
+// Generator produces room codes. With Check set, every code carries a
+// trailing Luhn mod N check character, so Validate can reject a mistyped
+// code instead of letting it match someone else's room.
+type Generator struct {
+	Mode     Mode
+	Length   int    // Random mode only, excluding the check character
+	Alphabet string // Random mode only
+	Check    bool
+}
+
+// Default returns the generator for the original ABC123-style codes
+func Default() *Generator {
+	return &Generator{Mode: Classic}
+}
+
+// New builds a generator, filling in defaults and rejecting settings that
+// cannot produce codes
+func New(mode Mode, length int, alphabet string, check bool) (*Generator, error) {
+	g := &Generator{Mode: mode, Length: length, Alphabet: alphabet, Check: check}
+	switch mode {
+	case Classic, Words:
+	case Random:
+		if g.Alphabet == "" {
+			g.Alphabet = Unambiguous
+		}
+		if g.Length == 0 {
+			g.Length = 6
+		}
+		if len(g.Alphabet) < 2 || g.Length < 4 {
+			return nil, fmt.Errorf("random codes need at least 2 symbols and 4 characters")
+		}
+		g.Alphabet = strings.ToUpper(g.Alphabet)
+	default:
+		return nil, fmt.Errorf("unknown code mode %q", mode)
+	}
+	return g, nil
+}
+
+// Generate returns a new random code
+func (g *Generator) Generate() string {
+	var code string
+	switch g.Mode {
+	case Random:
+		code = randomString(g.Alphabet, g.Length)
+	case Words:
+		code = fmt.Sprintf("%s-%s-%02d", pick(adjectives), pick(nouns), randomInt(100))
+	default:
+		code = randomString(letters, 3) + randomString(Digits, 3)
+	}
+
+	if g.Check {
+		code += string(checkChar(code, g.checkAlphabet()))
+	}
+	return code
+}
+
+// Normalize maps what a person typed onto the canonical form of a code:
+// letter codes are upper case without separators, word codes are lower case
+// with dashes.
+func (g *Generator) Normalize(code string) string {
+	code = strings.TrimSpace(code)
+	if g.Mode == Words {
+		code = strings.ToLower(code)
+		return strings.Join(strings.FieldsFunc(code, func(r rune) bool {
+			return r == '-' || r == ' ' || r == '_'
+		}), "-")
+	}
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// Validate checks a normalized code's check character. Without Check there
+// is nothing to verify: a mistyped code simply matches no room.
+func (g *Generator) Validate(code string) error {
+	if !g.Check {
+		return nil
+	}
+	if len(code) < 2 {
+		return ErrMalformed
+	}
+
+	body, check := code[:len(code)-1], code[len(code)-1]
+	alphabet := g.checkAlphabet()
+	for _, c := range body {
+		if c != '-' && !strings.ContainsRune(alphabet, c) {
+			return ErrMalformed
+		}
+	}
+	if checkChar(body, alphabet) != check {
+		return ErrChecksum
+	}
+	return nil
+}
+
+func (g *Generator) checkAlphabet() string {
+	switch g.Mode {
+	case Random:
+		return g.Alphabet
+	case Words:
+		return wordChars
+	default:
+		return Alphanumeric
+	}
+}
+
+// checkChar computes the check character of s over alphabet. Characters
+// outside the alphabet (word separators) are skipped. It catches every
+// single-character substitution and adjacent transposition for odd-sized
+// alphabets, and all substitutions plus most transpositions for even ones.
+//
+// Even-sized alphabets use Luhn mod N. That scheme relies on doubling being
+// a permutation once the base-N digits are summed, which fails for odd N;
+// there, plain alternating weights of 2 and 1 work because both are
+// invertible mod N and so is their difference.
+func checkChar(s, alphabet string) byte {
+	n := len(alphabet)
+	factor := 2
+	sum := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		idx := strings.IndexByte(alphabet, s[i])
+		if idx < 0 {
+			continue
+		}
+		addend := factor * idx
+		if n%2 == 0 {
+			addend = addend/n + addend%n
+		}
+		sum += addend
+		factor = 3 - factor // alternate 2, 1
+	}
+	return alphabet[(n-sum%n)%n]
+}
+
+func randomString(alphabet string, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[randomInt(len(alphabet))]
+	}
+	return string(b)
+}
+
+func pick(words []string) string {
+	return words[randomInt(len(words))]
+}
+
+// randomInt returns a uniform int in [0, n) from crypto/rand: room codes are
+// the only thing standing between a stranger and a room.
+func randomInt(n int) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return int(v.Int64())
+}
@@ -0,0 +1,110 @@
+package codes
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGenerateClassicCode(t *testing.T) {
+	code := Default().Generate()
+	t.Logf("Generated code: %s", code)
+	if len(code) != 6 {
+		t.Fatalf("Expected 6 characters, got %q", code)
+	}
+	for i := range 3 {
+		if !isLetter(code[i]) {
+			t.Errorf("Expected %c at index %d to be A-Z", code[i], i)
+		}
+	}
+	for i := 3; i < 6; i++ {
+		if !isDigit(code[i]) {
+			t.Errorf("Expected %c at index %d to be 0-9", code[i], i)
+		}
+	}
+}
+
+func TestGenerateRandomCode(t *testing.T) {
+	g, err := New(Random, 8, Digits, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := g.Generate()
+	if len(code) != 8 {
+		t.Fatalf("Expected 8 digits, got %q", code)
+	}
+	for i := range code {
+		if !isDigit(code[i]) {
+			t.Errorf("Expected digit at index %d, got %c", i, code[i])
+		}
+	}
+
+	g, _ = New(Random, 0, "", false)
+	for _, c := range g.Generate() {
+		if strings.ContainsRune("0O1IL", c) {
+			t.Errorf("Default alphabet should avoid ambiguous %c", c)
+		}
+	}
+}
+
+func TestGenerateWordCode(t *testing.T) {
+	g, _ := New(Words, 0, "", false)
+	code := g.Generate()
+	t.Logf("Generated code: %s", code)
+
+	parts := strings.Split(code, "-")
+	if len(parts) != 3 {
+		t.Fatalf("Expected adjective-noun-NN, got %q", code)
+	}
+	if !slices.Contains(adjectives, parts[0]) || !slices.Contains(nouns, parts[1]) {
+		t.Errorf("Expected words from the lists, got %q", code)
+	}
+	if n, err := strconv.Atoi(parts[2]); err != nil || n < 0 || n > 99 {
+		t.Errorf("Expected two-digit suffix, got %q", parts[2])
+	}
+	if g.Normalize(" Purple Tiger 42 ") != "purple-tiger-42" {
+		t.Errorf("Typed word code should normalize, got %q", g.Normalize(" Purple Tiger 42 "))
+	}
+}
+
+func TestCheckCharacterCatchesTypos(t *testing.T) {
+	for _, mode := range []Mode{Classic, Random, Words} {
+		g, _ := New(mode, 0, "", true)
+		code := g.Generate()
+		if err := g.Validate(code); err != nil {
+			t.Fatalf("%s: generated code %q failed validation: %v", mode, code, err)
+		}
+
+		// Every single-character substitution must be caught
+		alphabet := g.checkAlphabet()
+		for i := range code {
+			if code[i] == '-' {
+				continue
+			}
+			for j := range len(alphabet) {
+				if alphabet[j] == code[i] {
+					continue
+				}
+				typo := code[:i] + string(alphabet[j]) + code[i+1:]
+				if g.Validate(typo) == nil {
+					t.Errorf("%s: typo %q of %q passed validation", mode, typo, code)
+				}
+			}
+		}
+	}
+}
+
+func TestValidateWithoutCheck(t *testing.T) {
+	if err := Default().Validate("FAKE99"); err != nil {
+		t.Errorf("Without a check character nothing should be rejected, got %v", err)
+	}
+}
+
+func isLetter(char byte) bool {
+	return char >= 'A' && char <= 'Z'
+}
+
+func isDigit(char byte) bool {
+	return char >= '0' && char <= '9'
+}
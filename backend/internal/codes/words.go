@@ -0,0 +1,26 @@
+package codes
+
+// adjectives and nouns make up word codes such as "purple-tiger-42". Both
+// lists avoid homophones and words that are easy to misspell, so a code
+// read aloud survives being typed.
+var adjectives = []string{
+	"amber", "bold", "brave", "bright", "brisk", "calm", "clever", "cosmic",
+	"crisp", "curly", "dusty", "eager", "early", "fancy", "fast", "fluffy",
+	"frosty", "fuzzy", "gentle", "giant", "glad", "golden", "grand", "green",
+	"happy", "hidden", "honest", "jolly", "kind", "lazy", "lively", "lucky",
+	"mellow", "merry", "mighty", "misty", "modern", "noble", "orange", "polite",
+	"proud", "purple", "quick", "quiet", "rapid", "rosy", "rusty", "shiny",
+	"silent", "silver", "simple", "sleepy", "smooth", "snowy", "solar", "spicy",
+	"steady", "sunny", "swift", "tidy", "tiny", "velvet", "witty", "zesty",
+}
+
+var nouns = []string{
+	"anchor", "apple", "badger", "banjo", "beacon", "bison", "cactus", "canyon",
+	"castle", "cedar", "cloud", "comet", "coral", "cricket", "dolphin", "dragon",
+	"falcon", "fern", "forest", "fox", "galaxy", "garden", "gecko", "glacier",
+	"harbor", "hippo", "island", "jungle", "kettle", "koala", "lantern", "lemon",
+	"lizard", "llama", "magnet", "mango", "meadow", "meteor", "moose", "nebula",
+	"ocean", "otter", "panda", "parrot", "pebble", "pepper", "piano", "planet",
+	"pumpkin", "rabbit", "river", "rocket", "saddle", "salmon", "spruce", "summit",
+	"tiger", "tornado", "tulip", "turtle", "valley", "violin", "walrus", "zebra",
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds server settings, read from the environment
+type Config struct {
+	Port string // PORT, defaults to 8080
+
+	// PublicURL is the externally visible base URL that join links and QR
+	// codes point at (FROP_PUBLIC_URL). Empty uses the request's host.
+	PublicURL string
+
+	// DataDir is where durable stores keep their logs (FROP_DATA_DIR).
+	// Empty keeps rooms and sessions in memory only.
+	DataDir string
+
+	// SweepInterval is how often expired rooms and sessions are evicted
+	// (FROP_SWEEP_INTERVAL, a Go duration such as "30s")
+	SweepInterval time.Duration
+
+	// MaxRoomCapacity caps how many peers a group room may be created
+	// for (FROP_MAX_ROOM_CAPACITY)
+	MaxRoomCapacity int
+
+	// MaxTTL caps the lifetime a room or session may be given on request
+	// (FROP_MAX_TTL). ExpiryWarning is how long before a session expires
+	// its peers are sent "expiring_soon" (FROP_EXPIRY_WARNING).
+	MaxTTL        time.Duration
+	ExpiryWarning time.Duration
+
+	// ReconnectGrace is how long a dropped peer has to come back before
+	// the others get "peer_disconnected" (FROP_RECONNECT_GRACE). Meanwhile
+	// they see "peer_reconnecting" and clipboard messages are held for it.
+	// "0s" reports drops at once.
+	ReconnectGrace time.Duration
+
+	// TokenKeys switches to signed session tokens (FROP_TOKEN_KEYS), as
+	// comma separated "id:base64secret" keys; the first signs, all verify.
+	// Empty issues random tokens only this instance can check.
+	TokenKeys string
+
+	// Drops are reserved names routed to their owner's device. DropTTL is
+	// how long a reservation lasts unused (FROP_DROP_TTL); a non-empty
+	// DropClaimToken (FROP_DROP_CLAIM_TOKEN) must be presented as a bearer
+	// token to claim a name.
+	DropTTL        time.Duration
+	DropClaimToken string
+
+	// DeviceTTL is how long a trusted device is remembered without being
+	// used (FROP_DEVICE_TTL)
+	DeviceTTL time.Duration
+
+	// ResumeWindow is how long a transfer cut off by a dropped peer can
+	// be resumed from where it stopped (FROP_RESUME_WINDOW)
+	ResumeWindow time.Duration
+
+	// OfferTimeout is how long a file_offer waits for its recipient to
+	// accept or reject it (FROP_OFFER_TIMEOUT)
+	OfferTimeout time.Duration
+
+	// FlowWindow is the credit a sender asking for flow control starts
+	// with (FROP_FLOW_WINDOW)
+	FlowWindow int
+
+	// MaxFrame is the most file data one binary frame may carry; larger
+	// frames close the sender's connection (FROP_MAX_FRAME)
+	MaxFrame int
+
+	// Room code format: FROP_CODE_MODE is classic (ABC123), random or
+	// words (purple-tiger-42). Random codes are FROP_CODE_LENGTH characters
+	// from FROP_CODE_ALPHABET: alphanumeric, unambiguous, digits, or a
+	// literal set of characters. FROP_CODE_CHECK appends a check character.
+	CodeMode     string
+	CodeLength   int
+	CodeAlphabet string
+	CodeCheck    bool
+
+	// Rate limits, each written as "burst/period" (e.g. "10/1m") or "off":
+	// FROP_RATE_CREATE for room creation per IP, FROP_RATE_JOIN for join
+	// attempts and FROP_RATE_RECONNECT for failed reconnects, both per IP
+	// and per connection. A client refused FROP_BAN_AFTER times in a row
+	// is banned for FROP_BAN_DURATION. FROP_TRUST_PROXY takes the client IP
+	// from the last X-Forwarded-For entry, the one the proxy appends.
+	RateCreate    string
+	RateJoin      string
+	RateReconnect string
+	BanAfter      int
+	BanDuration   time.Duration
+	TrustProxy    bool
+}
+
+// Load reads the configuration from the environment, applying defaults
+func Load() *Config {
+	return &Config{
+		Port:      getEnv("PORT", "8080"),
+		PublicURL: os.Getenv("FROP_PUBLIC_URL"),
+		DataDir:   os.Getenv("FROP_DATA_DIR"),
+
+		SweepInterval: getDuration("FROP_SWEEP_INTERVAL", time.Minute),
+
+		MaxRoomCapacity: getInt("FROP_MAX_ROOM_CAPACITY", 8),
+
+		MaxTTL:        getDuration("FROP_MAX_TTL", 24*time.Hour),
+		ExpiryWarning: getDuration("FROP_EXPIRY_WARNING", 2*time.Minute),
+
+		ReconnectGrace: getDurationOrZero("FROP_RECONNECT_GRACE", 10*time.Second),
+		TokenKeys:      os.Getenv("FROP_TOKEN_KEYS"),
+
+		DropTTL:        getDuration("FROP_DROP_TTL", 30*24*time.Hour),
+		DropClaimToken: os.Getenv("FROP_DROP_CLAIM_TOKEN"),
+		DeviceTTL:      getDuration("FROP_DEVICE_TTL", 180*24*time.Hour),
+		ResumeWindow:   getDuration("FROP_RESUME_WINDOW", time.Hour),
+		OfferTimeout:   getDuration("FROP_OFFER_TIMEOUT", time.Minute),
+		FlowWindow:     getInt("FROP_FLOW_WINDOW", 16<<20),
+		MaxFrame:       getInt("FROP_MAX_FRAME", 8<<20),
+
+		CodeMode:     getEnv("FROP_CODE_MODE", "classic"),
+		CodeLength:   getInt("FROP_CODE_LENGTH", 6),
+		CodeAlphabet: getEnv("FROP_CODE_ALPHABET", "unambiguous"),
+		CodeCheck:    getBool("FROP_CODE_CHECK", false),
+
+		RateCreate:    getEnv("FROP_RATE_CREATE", "10/1m"),
+		RateJoin:      getEnv("FROP_RATE_JOIN", "20/1m"),
+		RateReconnect: getEnv("FROP_RATE_RECONNECT", "5/1m"),
+		BanAfter:      getInt("FROP_BAN_AFTER", 10),
+		BanDuration:   getDuration("FROP_BAN_DURATION", 10*time.Minute),
+		TrustProxy:    getBool("FROP_TRUST_PROXY", false),
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		slog.Warn("Ignoring invalid duration", "key", key, "value", v)
+		return fallback
+	}
+	return d
+}
+
+// getDurationOrZero is getDuration for settings that 0 turns off
+func getDurationOrZero(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d == 0 {
+		return 0
+	}
+	return getDuration(key, fallback)
+}
+
+func getInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		slog.Warn("Ignoring invalid integer", "key", key, "value", v)
+		return fallback
+	}
+	return n
+}
+
+func getBool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		slog.Warn("Ignoring invalid boolean", "key", key, "value", v)
+		return fallback
+	}
+	return b
+}
@@ -0,0 +1,200 @@
+// Package device remembers devices that chose to trust each other, so a
+// pair can connect again later with a credential instead of a room code.
+package device
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"frop/internal/room"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// DefaultTTL is how long a device is remembered without being used
+const DefaultTTL = 180 * 24 * time.Hour
+
+var ttl = DefaultTTL
+
+// SetTTL changes how long an unused device is remembered
+func SetTTL(d time.Duration) {
+	ttl = d
+}
+
+// maxNameLen caps the label a device is listed under, in bytes
+const maxNameLen = 64
+
+// Device is one side of one or more pairings. It proves itself with a
+// credential issued the first time it trusted another device.
+type Device struct {
+	ID        string
+	CreatedAt time.Time
+
+	secret   *room.Secret
+	lastSeen atomic.Int64 // unix nanos of the last use of the credential
+
+	mu      sync.Mutex
+	name    string
+	trusted map[string]time.Time // device ID -> when the pairing was made
+}
+
+// Trusted is an entry in a device's list of trusted devices
+type Trusted struct {
+	ID       string
+	Name     string
+	Since    time.Time
+	LastSeen time.Time
+}
+
+// newDevice creates a device and the credential it is known by, which is
+// handed out once and only kept hashed
+// newKey returns a random credential, too long to guess
+func newKey() string {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+func newDevice(name string, now time.Time) (*Device, string) {
+	plain := newKey()
+
+	d := &Device{
+		ID:        uuid.NewString(),
+		CreatedAt: now,
+		secret:    room.NewKeySecret(plain),
+		name:      name,
+		trusted:   make(map[string]time.Time),
+	}
+	d.lastSeen.Store(now.UnixNano())
+	return d, d.ID + "." + plain
+}
+
+// normalizeName trims a label and checks it is short printable text
+func normalizeName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) > maxNameLen || !utf8.ValidString(name) {
+		return "", ErrInvalidName
+	}
+	for _, c := range name {
+		if !unicode.IsPrint(c) {
+			return "", ErrInvalidName
+		}
+	}
+	return name, nil
+}
+
+// Authenticate returns the device a credential belongs to
+func Authenticate(credential string, now time.Time) (*Device, error) {
+	id, plain, ok := strings.Cut(credential, ".")
+	if !ok {
+		return nil, ErrBadCredential
+	}
+	d, err := loadDevice(id, now)
+	if err != nil {
+		return nil, ErrBadCredential
+	}
+	if !d.secret.Matches(plain) {
+		return nil, ErrBadCredential
+	}
+	d.touch(now)
+	return d, nil
+}
+
+// Name is the label the device is listed under by its trusted devices
+func (d *Device) Name() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.name
+}
+
+func (d *Device) rename(name string) {
+	d.mu.Lock()
+	d.name = name
+	d.mu.Unlock()
+}
+
+// Trusts reports whether d is paired with the device id
+func (d *Device) Trusts(id string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.trusted[id]
+	return ok
+}
+
+// Trusted lists the devices d is paired with, oldest pairing first. Devices
+// that have since lapsed are left out.
+func (d *Device) Trusted() []Trusted {
+	d.mu.Lock()
+	since := maps.Clone(d.trusted)
+	d.mu.Unlock()
+
+	list := make([]Trusted, 0, len(since))
+	for id, t := range since {
+		other, err := loadDevice(id, time.Now())
+		if err != nil {
+			continue
+		}
+		list = append(list, Trusted{ID: id, Name: other.Name(), Since: t, LastSeen: other.LastSeen()})
+	}
+	slices.SortFunc(list, func(a, b Trusted) int { return a.Since.Compare(b.Since) })
+	return list
+}
+
+// Revoke ends the pairing of d with the device id, for both of them
+func Revoke(d *Device, id string) error {
+	if !d.Trusts(id) {
+		return ErrNotTrusted
+	}
+	d.forget(id)
+	if other, err := loadDevice(id, time.Now()); err == nil {
+		other.forget(d.ID)
+	}
+	slog.Info("Revoked trusted device", "device", d.ID, "peer", id)
+	return nil
+}
+
+// link pairs two devices, both ways
+func link(a, b *Device, now time.Time) {
+	for _, pair := range [][2]*Device{{a, b}, {b, a}} {
+		d, other := pair[0], pair[1]
+		d.mu.Lock()
+		d.trusted[other.ID] = now
+		d.mu.Unlock()
+		d.save()
+	}
+}
+
+func (d *Device) forget(id string) {
+	d.mu.Lock()
+	delete(d.trusted, id)
+	d.mu.Unlock()
+	d.save()
+}
+
+func (d *Device) touch(now time.Time) {
+	d.lastSeen.Store(now.UnixNano())
+	d.save()
+}
+
+func (d *Device) save() {
+	if err := devices().Save(d); err != nil {
+		slog.Error("Failed to save device", "device", d.ID, "error", err)
+	}
+}
+
+func (d *Device) LastSeen() time.Time {
+	return time.Unix(0, d.lastSeen.Load())
+}
+
+// Expired reports whether the device has gone unused for the TTL at now
+func (d *Device) Expired(now time.Time) bool {
+	return !now.Before(d.LastSeen().Add(ttl))
+}
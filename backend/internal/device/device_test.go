@@ -0,0 +1,132 @@
+package device
+
+import (
+	"frop/internal/room"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pair makes two fresh devices trust each other through session code
+func pair(t *testing.T, code string, now time.Time) (*Side, *Side) {
+	t.Helper()
+
+	if mine, _, err := Offer(code, Side{PeerID: "p1", Name: "Laptop"}, "p2", now); err != nil || mine != nil {
+		t.Fatalf("Expected the first offer to wait, got %v, %v", mine, err)
+	}
+	phone, laptop, err := Offer(code, Side{PeerID: "p2", Name: "Phone"}, "p1", now)
+	if err != nil || phone == nil {
+		t.Fatalf("Expected the second offer to pair, got %v, %v", phone, err)
+	}
+	return laptop, phone
+}
+
+func TestNormalizeName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"": true, "  Work laptop ": true, "Téléphone": true,
+		"tab\there": false, "\xff": false, strings.Repeat("x", 65): false,
+	} {
+		if _, err := normalizeName(name); (err == nil) != want {
+			t.Errorf("normalizeName(%q) = %v, want ok=%v", name, err, want)
+		}
+	}
+}
+
+func TestOfferPairsBothSides(t *testing.T) {
+	defer Reset()
+
+	now := time.Now()
+	laptop, phone := pair(t, "ABC123", now)
+	if !laptop.Device.Trusts(phone.Device.ID) || !phone.Device.Trusts(laptop.Device.ID) {
+		t.Fatal("Expected the devices to trust each other")
+	}
+	if d, err := Authenticate(laptop.Token, now); err != nil || d != laptop.Device {
+		t.Errorf("Expected the laptop's credential to work, got %v", err)
+	}
+	if _, err := Authenticate(laptop.Device.ID+".guess", now); err != ErrBadCredential {
+		t.Errorf("Expected ErrBadCredential, got %v", err)
+	}
+
+	// a device that already has a credential keeps it and its ID
+	later := now.Add(time.Minute)
+	Offer("XYZ789", Side{PeerID: "p1", Token: laptop.Token}, "p2", later)
+	mine, tablet, err := Offer("XYZ789", Side{PeerID: "p2", Name: "Tablet"}, "p1", later)
+	if err != nil {
+		t.Fatalf("Offer: %v", err)
+	}
+	if tablet.Device != laptop.Device || tablet.Token != laptop.Token {
+		t.Errorf("Expected the laptop to keep its credential")
+	}
+	if got := laptop.Device.Trusted(); len(got) != 2 || got[1].ID != mine.Device.ID || got[1].Name != "Tablet" {
+		t.Errorf("Expected the phone, then the tablet, got %+v", got)
+	}
+}
+
+func TestOfferLapses(t *testing.T) {
+	defer Reset()
+
+	now := time.Now()
+	Offer("ABC123", Side{PeerID: "p1"}, "p2", now)
+	if mine, _, _ := Offer("ABC123", Side{PeerID: "p2"}, "p1", now.Add(offerTTL)); mine != nil {
+		t.Error("Expected a lapsed offer not to pair")
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	defer Reset()
+
+	laptop, phone := pair(t, "ABC123", time.Now())
+	if err := Revoke(phone.Device, laptop.Device.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if laptop.Device.Trusts(phone.Device.ID) {
+		t.Error("Expected the revocation to apply to both sides")
+	}
+	if err := Revoke(laptop.Device, phone.Device.ID); err != ErrNotTrusted {
+		t.Errorf("Expected ErrNotTrusted, got %v", err)
+	}
+}
+
+func TestMeet(t *testing.T) {
+	defer Reset()
+	defer room.Reset()
+
+	laptop, phone := pair(t, "ABC123", time.Now())
+
+	first, _, err := Meet(laptop.Device, phone.Device.ID)
+	if err != nil {
+		t.Fatalf("Meet: %v", err)
+	}
+	// waiting again, e.g. from a new tab, replaces the room
+	second, host, _ := Meet(laptop.Device, phone.Device.ID)
+	if _, err := room.GetRoom(first); err == nil || second == first {
+		t.Error("Expected the first room to be closed and replaced")
+	}
+	code, guest, _ := Meet(phone.Device, laptop.Device.ID)
+	if code != second {
+		t.Errorf("Expected the phone to join %s, got %s", second, code)
+	}
+	if host == "" || guest == "" || host == guest {
+		t.Errorf("Expected each device its own key, got %q and %q", host, guest)
+	}
+
+	stranger, _ := newDevice("", time.Now())
+	if _, _, err := Meet(stranger, laptop.Device.ID); err != ErrNotTrusted {
+		t.Errorf("Expected ErrNotTrusted, got %v", err)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	defer Reset()
+
+	now := time.Now()
+	laptop, phone := pair(t, "ABC123", now)
+	Authenticate(phone.Token, now.Add(ttl/2))
+
+	if ids := Sweep(now.Add(ttl)); len(ids) != 1 || ids[0] != laptop.Device.ID {
+		t.Errorf("Expected only the unused laptop to lapse, swept %v", ids)
+	}
+	if got := phone.Device.Trusted(); len(got) != 0 {
+		t.Errorf("Expected a lapsed device to be left out, got %+v", got)
+	}
+}
@@ -0,0 +1,12 @@
+package device
+
+import "errors"
+
+var (
+	ErrDeviceNotFound = errors.New("device not found")
+	ErrBadCredential  = errors.New("invalid device credential")
+	ErrNotTrusted     = errors.New("device not trusted")
+	ErrInvalidName    = errors.New("invalid device name")
+	ErrSameDevice     = errors.New("device cannot trust itself")
+	ErrNotPaired      = errors.New("trust needs exactly one other peer")
+)
@@ -0,0 +1,85 @@
+package device
+
+import (
+	"frop/internal/room"
+	"frop/internal/store"
+	"maps"
+	"time"
+)
+
+// record is the persisted form of a Device
+type record struct {
+	ID        string               `json:"id"`
+	Name      string               `json:"name,omitempty"`
+	CreatedAt time.Time            `json:"createdAt"`
+	LastSeen  time.Time            `json:"lastSeen"`
+	Secret    *room.Secret         `json:"secret"`
+	Trusted   map[string]time.Time `json:"trusted,omitempty"`
+}
+
+// FileStore keeps devices in memory and writes them through to an
+// append-only log, so pairings survive a restart.
+type FileStore struct {
+	*MemoryStore
+	log *store.File[record]
+}
+
+// OpenFileStore opens the log at path and restores the devices recorded in it
+func OpenFileStore(path string) (*FileStore, error) {
+	log, err := store.OpenFile[record](path)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		log:         log,
+	}
+	log.Range(func(_ string, rec record) bool {
+		fs.MemoryStore.Save(rec.device())
+		return true
+	})
+	return fs, nil
+}
+
+func (fs *FileStore) Save(d *Device) error {
+	fs.MemoryStore.Save(d)
+	return fs.log.Put(d.ID, d.record())
+}
+
+func (fs *FileStore) Delete(id string) error {
+	fs.MemoryStore.Delete(id)
+	return fs.log.Delete(id)
+}
+
+func (fs *FileStore) Close() error {
+	return fs.log.Close()
+}
+
+func (d *Device) record() record {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return record{
+		ID:        d.ID,
+		Name:      d.name,
+		CreatedAt: d.CreatedAt,
+		LastSeen:  d.LastSeen(),
+		Secret:    d.secret,
+		Trusted:   maps.Clone(d.trusted),
+	}
+}
+
+func (rec record) device() *Device {
+	d := &Device{
+		ID:        rec.ID,
+		CreatedAt: rec.CreatedAt,
+		name:      rec.Name,
+		secret:    rec.Secret,
+		trusted:   rec.Trusted,
+	}
+	if d.trusted == nil {
+		d.trusted = make(map[string]time.Time)
+	}
+	d.lastSeen.Store(rec.LastSeen.UnixNano())
+	return d
+}
@@ -0,0 +1,141 @@
+package device
+
+import (
+	"frop/internal/room"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// offerTTL is how long a request to trust waits for the other peer to agree
+const offerTTL = 2 * time.Minute
+
+// Side is one peer's half of a request to trust the other peer of a session
+type Side struct {
+	PeerID string
+	Token  string  // the device's credential: presented with the offer, or issued once paired
+	Name   string  // label the other device lists this one under
+	Device *Device // known once paired, or on offer when Token was presented
+
+	to string // peer ID the offer is made to
+	at time.Time
+}
+
+func (s *Side) lapsed(now time.Time) bool {
+	return now.Sub(s.at) >= offerTTL
+}
+
+var (
+	offersMu sync.Mutex
+	offers   = make(map[string]*Side) // room code + " " + peer ID -> offer
+)
+
+// Offer records that side, a peer of the session created from room code,
+// wants to trust peer to. Once to has offered the same, the two devices are
+// paired, one without a credential is issued one, and both sides are
+// returned. Until then Offer returns nil sides.
+func Offer(code string, side Side, to string, now time.Time) (mine, theirs *Side, err error) {
+	if side.Name, err = normalizeName(side.Name); err != nil {
+		return nil, nil, err
+	}
+	if side.Token != "" {
+		if side.Device, err = Authenticate(side.Token, now); err != nil {
+			return nil, nil, err
+		}
+	}
+	side.to, side.at = to, now
+
+	offersMu.Lock()
+	other, ok := offers[code+" "+to]
+	if !ok || other.to != side.PeerID || other.lapsed(now) {
+		offers[code+" "+side.PeerID] = &side
+		offersMu.Unlock()
+		return nil, nil, nil
+	}
+	delete(offers, code+" "+to)
+	offersMu.Unlock()
+
+	mine, theirs = &side, other
+	if mine.Device != nil && theirs.Device != nil && mine.Device.ID == theirs.Device.ID {
+		return nil, nil, ErrSameDevice
+	}
+	for _, s := range []*Side{mine, theirs} {
+		if s.Device == nil {
+			s.Device, s.Token = newDevice(s.Name, now)
+		} else if s.Name != "" {
+			s.Device.rename(s.Name)
+		}
+	}
+	link(mine.Device, theirs.Device, now)
+	slog.Info("Trusted devices paired", "code", code, "devices", []string{mine.Device.ID, theirs.Device.ID})
+	return mine, theirs, nil
+}
+
+// meeting is the room one device of a pair waits in for the other
+type meeting struct {
+	code  string
+	by    string // ID of the waiting device
+	guest string // key the other device joins with
+}
+
+var (
+	meetMu   sync.Mutex
+	meetings = make(map[string]meeting) // pairKey -> meeting
+)
+
+func pairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + " " + b
+}
+
+// Meet returns the room d should join to meet its trusted device id, and
+// the key that keeps d's seat in it: the room that device waits in, or a
+// fresh one for d to wait in. Only the two devices hold a key, so nobody
+// else gets a seat.
+func Meet(d *Device, id string) (code, key string, err error) {
+	if !d.Trusts(id) {
+		return "", "", ErrNotTrusted
+	}
+	pair := pairKey(d.ID, id)
+
+	meetMu.Lock()
+	defer meetMu.Unlock()
+
+	if m, ok := meetings[pair]; ok {
+		delete(meetings, pair)
+		if m.by != d.ID {
+			if _, err := room.GetRoom(m.code); err == nil {
+				return m.code, m.guest, nil
+			}
+		} else {
+			// d waits again from a new connection
+			room.Close(m.code, "closed")
+		}
+	}
+
+	// the devices trust each other, so neither knocks
+	host, guest := newKey(), newKey()
+	r, err := room.CreateRoomWithOptions(room.Options{Host: host, Guest: guest})
+	if err != nil {
+		return "", "", err
+	}
+	meetings[pair] = meeting{code: r.Code, by: d.ID, guest: guest}
+	slog.Info("Waiting for trusted device", "code", r.Code, "device", d.ID, "peer", id)
+	return r.Code, host, nil
+}
+
+// Abandon closes the room a device waited in, when it goes away before the
+// other device came
+func Abandon(code string) {
+	meetMu.Lock()
+	defer meetMu.Unlock()
+
+	for key, m := range meetings {
+		if m.code == code {
+			delete(meetings, key)
+			room.Close(code, "closed")
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package device
+
+import (
+	"frop/internal/room"
+	"sync"
+	"time"
+)
+
+// Store holds trusted devices by ID. Implementations must be safe for
+// concurrent use.
+//
+// Offers and meetings are never persisted: a durable store only keeps the
+// devices and whom they trust.
+type Store interface {
+	Load(id string) (*Device, bool)
+	Save(d *Device) error
+	Delete(id string) error
+	Range(fn func(d *Device) bool)
+}
+
+var (
+	storeMu     sync.RWMutex
+	deviceStore Store = NewMemoryStore()
+)
+
+// SetStore replaces the backing store. Call it before serving requests.
+func SetStore(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	deviceStore = s
+}
+
+// devices returns the backing store, taking storeMu for reading
+func devices() Store {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return deviceStore
+}
+
+// MemoryStore keeps devices in process memory only
+type MemoryStore struct {
+	devices sync.Map // map[string]*Device
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (m *MemoryStore) Load(id string) (*Device, bool) {
+	v, exists := m.devices.Load(id)
+	if !exists {
+		return nil, false
+	}
+	return v.(*Device), true
+}
+
+func (m *MemoryStore) Save(d *Device) error {
+	m.devices.Store(d.ID, d)
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.devices.Delete(id)
+	return nil
+}
+
+func (m *MemoryStore) Range(fn func(d *Device) bool) {
+	m.devices.Range(func(_, v any) bool {
+		return fn(v.(*Device))
+	})
+}
+
+// loadDevice is the single lookup path for devices, evicting lapsed ones
+func loadDevice(id string, now time.Time) (*Device, error) {
+	d, exists := devices().Load(id)
+	if !exists {
+		return nil, ErrDeviceNotFound
+	}
+	if d.Expired(now) {
+		devices().Delete(id)
+		return nil, ErrDeviceNotFound
+	}
+	return d, nil
+}
+
+// Sweep evicts every device unused for the TTL, along with unanswered
+// offers and meetings whose room is gone, and returns the devices' IDs
+func Sweep(now time.Time) []string {
+	var expired []string
+	devices().Range(func(d *Device) bool {
+		if d.Expired(now) {
+			devices().Delete(d.ID)
+			expired = append(expired, d.ID)
+		}
+		return true
+	})
+
+	offersMu.Lock()
+	for key, o := range offers {
+		if o.lapsed(now) {
+			delete(offers, key)
+		}
+	}
+	offersMu.Unlock()
+
+	meetMu.Lock()
+	for key, m := range meetings {
+		if _, err := room.GetRoom(m.code); err != nil {
+			delete(meetings, key)
+		}
+	}
+	meetMu.Unlock()
+	return expired
+}
+
+// Reset clears the store, offers and meetings (used for testing)
+func Reset() {
+	devices().Range(func(d *Device) bool {
+		devices().Delete(d.ID)
+		return true
+	})
+
+	offersMu.Lock()
+	clear(offers)
+	offersMu.Unlock()
+	meetMu.Lock()
+	clear(meetings)
+	meetMu.Unlock()
+}
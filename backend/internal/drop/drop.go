@@ -0,0 +1,219 @@
+// Package drop reserves long-lived names, such as a person's handle, that
+// route whoever joins them into a fresh room with the name's owner.
+package drop
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"frop/internal/room"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTTL is how long a reservation lasts without its owner claiming it
+// again or listening on it
+const DefaultTTL = 30 * 24 * time.Hour
+
+var ttl = DefaultTTL
+
+// SetTTL changes how long an unused reservation is kept
+func SetTTL(d time.Duration) {
+	ttl = d
+}
+
+// claimToken, when set, must be presented to claim a name, so an operator
+// can decide who gets one
+var claimToken string
+
+// SetClaimToken restricts claiming to holders of token. "" lets anyone claim
+// a free name.
+func SetClaimToken(token string) {
+	claimToken = token
+}
+
+// Authorize checks the token a claim was made with
+func Authorize(token string) error {
+	if claimToken == "" {
+		return nil
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(claimToken)) != 1 {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// Drop is a reserved name. Its owner proves ownership with the claim secret
+// and, while listening, is paired with everyone who joins the name.
+type Drop struct {
+	Name      string
+	CreatedAt time.Time
+
+	secret   *room.Secret
+	lastSeen atomic.Int64 // unix nanos of the last claim or listen
+	owner    atomic.Pointer[room.Peer]
+}
+
+func newDrop(name, secret string, now time.Time) *Drop {
+	d := &Drop{
+		Name:      name,
+		CreatedAt: now,
+		secret:    room.NewSecret(secret),
+	}
+	d.lastSeen.Store(now.UnixNano())
+	return d
+}
+
+// Normalize returns the canonical form of a typed name: lower case, without
+// a leading "@"
+func Normalize(name string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "@")
+}
+
+// validName accepts 3 to 32 lower case letters, digits and inner dashes
+func validName(name string) bool {
+	if len(name) < 3 || len(name) > 32 || name[0] == '-' || name[len(name)-1] == '-' {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// Claim reserves name for whoever knows secret. Claiming a name again with
+// the same secret renews the reservation; any other secret finds it taken.
+func Claim(name, secret string, now time.Time) (*Drop, error) {
+	name = Normalize(name)
+	if !validName(name) {
+		return nil, ErrInvalidName
+	}
+	if secret == "" {
+		return nil, ErrSecretRequired
+	}
+
+	if d, err := loadDrop(name, now); err == nil {
+		if !d.secret.Matches(secret) {
+			return nil, ErrNameTaken
+		}
+		d.touch(now)
+		return d, nil
+	}
+	// a room reached by the same code would become unreachable
+	if _, err := room.GetRoom(name); err == nil {
+		return nil, ErrNameTaken
+	}
+
+	d := newDrop(name, secret, now)
+	if err := drops().Add(d); err != nil {
+		return nil, err
+	}
+	slog.Info("Claimed drop", "name", name)
+	return d, nil
+}
+
+// Release gives a name up
+func Release(name, secret string) error {
+	d, err := loadDrop(Normalize(name), time.Now())
+	if err != nil {
+		return err
+	}
+	if !d.secret.Matches(secret) {
+		return ErrWrongSecret
+	}
+	slog.Info("Released drop", "name", d.Name)
+	return drops().Delete(d.Name)
+}
+
+// Get returns the drop reserved under name
+func Get(name string) (*Drop, error) {
+	return loadDrop(Normalize(name), time.Now())
+}
+
+// Exists reports whether name is reserved, so joins can tell a name from a
+// room code
+func Exists(name string) bool {
+	_, err := Get(name)
+	return err == nil
+}
+
+// Listen makes peer the owner's device that visitors are paired with,
+// replacing any earlier one, and renews the reservation
+func Listen(name, secret string, peer *room.Peer, now time.Time) (*Drop, error) {
+	d, err := loadDrop(Normalize(name), now)
+	if err != nil {
+		return nil, err
+	}
+	if !d.secret.Matches(secret) {
+		return nil, ErrWrongSecret
+	}
+	d.owner.Store(peer)
+	d.touch(now)
+	return d, nil
+}
+
+// Unlisten detaches peer when its connection goes away. A newer listener is
+// left in place.
+func Unlisten(name string, peer *room.Peer) {
+	d, err := loadDrop(name, time.Now())
+	if err != nil {
+		return
+	}
+	if d.owner.CompareAndSwap(peer, nil) {
+		d.touch(time.Now())
+	}
+}
+
+// Route creates a fresh room for a visitor to name, with the creator's seat
+// kept for the owner. The caller joins the visitor and asks the returned
+// owner to join the same room with the returned host key.
+func Route(name string) (*room.Room, *room.Peer, string, error) {
+	d, err := Get(name)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	owner := d.Owner()
+	if owner == nil {
+		return nil, nil, "", ErrOwnerAway
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+	host := base64.RawURLEncoding.EncodeToString(key)
+	r, err := room.CreateRoomWithOptions(room.Options{Host: host})
+	if err != nil {
+		return nil, nil, "", err
+	}
+	slog.Info("Routed visitor", "name", d.Name, "code", r.Code)
+	return r, owner, host, nil
+}
+
+// Owner returns the listening device, nil when the owner is away
+func (d *Drop) Owner() *room.Peer {
+	return d.owner.Load()
+}
+
+func (d *Drop) touch(now time.Time) {
+	d.lastSeen.Store(now.UnixNano())
+	if err := drops().Save(d); err != nil {
+		slog.Error("Failed to save drop", "name", d.Name, "error", err)
+	}
+}
+
+func (d *Drop) LastSeen() time.Time {
+	return time.Unix(0, d.lastSeen.Load())
+}
+
+// ExpiresAt is when the reservation lapses unless it is used again
+func (d *Drop) ExpiresAt() time.Time {
+	return d.LastSeen().Add(ttl)
+}
+
+// Expired reports whether the reservation has lapsed at now. A drop whose
+// owner is listening never lapses.
+func (d *Drop) Expired(now time.Time) bool {
+	return d.Owner() == nil && !now.Before(d.ExpiresAt())
+}
@@ -0,0 +1,45 @@
+package drop
+
+import (
+	"frop/internal/room"
+	"testing"
+	"time"
+)
+
+func TestValidName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"alice": true, "team-42": true, "ab": false, "-alice": false,
+		"alice-": false, "Alice": false, "al ice": false, "a23456789012345678901234567890123": false,
+	} {
+		if got := validName(name); got != want {
+			t.Errorf("validName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestReservationLapses(t *testing.T) {
+	defer Reset()
+
+	now := time.Now()
+	if _, err := Claim("alice", "hunter2", now); err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+
+	// a listening owner keeps the name however long it stays connected
+	peer := &room.Peer{}
+	if _, err := Listen("alice", "hunter2", peer, now); err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	if names := Sweep(now.Add(2 * ttl)); len(names) != 0 {
+		t.Errorf("Expected a listened-on name to be kept, swept %v", names)
+	}
+
+	d, _ := Get("alice")
+	d.owner.Store(nil)
+	if names := Sweep(now.Add(2 * ttl)); len(names) != 1 || names[0] != "alice" {
+		t.Errorf("Expected alice to lapse, swept %v", names)
+	}
+	if Reserved("ALICE") {
+		t.Error("Expected a lapsed name to be free")
+	}
+}
@@ -0,0 +1,14 @@
+package drop
+
+import "errors"
+
+var (
+	ErrDropNotFound = errors.New("drop not found")
+	ErrInvalidName  = errors.New("invalid drop name")
+	ErrNameTaken    = errors.New("drop name taken")
+	ErrWrongSecret  = errors.New("wrong claim secret")
+
+	ErrSecretRequired = errors.New("claim secret required")
+	ErrUnauthorized   = errors.New("claim token required")
+	ErrOwnerAway      = errors.New("owner not connected")
+)
@@ -0,0 +1,80 @@
+package drop
+
+import (
+	"frop/internal/room"
+	"frop/internal/store"
+	"time"
+)
+
+// record is the persisted form of a Drop
+type record struct {
+	Name      string       `json:"name"`
+	CreatedAt time.Time    `json:"createdAt"`
+	LastSeen  time.Time    `json:"lastSeen"`
+	Secret    *room.Secret `json:"secret"`
+}
+
+// FileStore keeps drops in memory and writes them through to an append-only
+// log, so reservations survive a restart.
+type FileStore struct {
+	*MemoryStore
+	log *store.File[record]
+}
+
+// OpenFileStore opens the log at path and restores the drops recorded in it
+func OpenFileStore(path string) (*FileStore, error) {
+	log, err := store.OpenFile[record](path)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		log:         log,
+	}
+	log.Range(func(_ string, rec record) bool {
+		fs.MemoryStore.Save(rec.drop())
+		return true
+	})
+	return fs, nil
+}
+
+func (fs *FileStore) Add(d *Drop) error {
+	if err := fs.MemoryStore.Add(d); err != nil {
+		return err
+	}
+	return fs.log.Put(d.Name, d.record())
+}
+
+func (fs *FileStore) Save(d *Drop) error {
+	fs.MemoryStore.Save(d)
+	return fs.log.Put(d.Name, d.record())
+}
+
+func (fs *FileStore) Delete(name string) error {
+	fs.MemoryStore.Delete(name)
+	return fs.log.Delete(name)
+}
+
+func (fs *FileStore) Close() error {
+	return fs.log.Close()
+}
+
+func (d *Drop) record() record {
+	return record{
+		Name:      d.Name,
+		CreatedAt: d.CreatedAt,
+		LastSeen:  d.LastSeen(),
+		Secret:    d.secret,
+	}
+}
+
+func (rec record) drop() *Drop {
+	d := &Drop{
+		Name:      rec.Name,
+		CreatedAt: rec.CreatedAt,
+		secret:    rec.Secret,
+	}
+	d.lastSeen.Store(rec.LastSeen.UnixNano())
+	return d
+}
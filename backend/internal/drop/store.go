@@ -0,0 +1,118 @@
+package drop
+
+import (
+	"sync"
+	"time"
+)
+
+// Store holds drops by name. Implementations must be safe for concurrent use.
+//
+// Owners' connections are never persisted: a durable store only keeps the
+// reservation itself.
+type Store interface {
+	Load(name string) (*Drop, bool)
+	// Add stores a new drop, failing with ErrNameTaken if the name is in use
+	Add(d *Drop) error
+	Save(d *Drop) error
+	Delete(name string) error
+	Range(fn func(d *Drop) bool)
+}
+
+var (
+	storeMu   sync.RWMutex
+	dropStore Store = NewMemoryStore()
+)
+
+// SetStore replaces the backing store. Call it before serving requests.
+func SetStore(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	dropStore = s
+}
+
+// drops returns the backing store, which SetStore may be swapping
+func drops() Store {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return dropStore
+}
+
+// MemoryStore keeps drops in process memory only
+type MemoryStore struct {
+	drops sync.Map // map[string]*Drop
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (m *MemoryStore) Load(name string) (*Drop, bool) {
+	v, exists := m.drops.Load(name)
+	if !exists {
+		return nil, false
+	}
+	return v.(*Drop), true
+}
+
+func (m *MemoryStore) Add(d *Drop) error {
+	if _, loaded := m.drops.LoadOrStore(d.Name, d); loaded {
+		return ErrNameTaken
+	}
+	return nil
+}
+
+func (m *MemoryStore) Save(d *Drop) error {
+	m.drops.Store(d.Name, d)
+	return nil
+}
+
+func (m *MemoryStore) Delete(name string) error {
+	m.drops.Delete(name)
+	return nil
+}
+
+func (m *MemoryStore) Range(fn func(d *Drop) bool) {
+	m.drops.Range(func(_, v any) bool {
+		return fn(v.(*Drop))
+	})
+}
+
+// loadDrop is the single lookup path for drops, evicting lapsed ones
+func loadDrop(name string, now time.Time) (*Drop, error) {
+	d, exists := drops().Load(name)
+	if !exists {
+		return nil, ErrDropNotFound
+	}
+	if d.Expired(now) {
+		drops().Delete(name)
+		return nil, ErrDropNotFound
+	}
+	return d, nil
+}
+
+// Sweep evicts every lapsed reservation and returns the names
+func Sweep(now time.Time) []string {
+	var expired []string
+	drops().Range(func(d *Drop) bool {
+		if d.Expired(now) {
+			drops().Delete(d.Name)
+			expired = append(expired, d.Name)
+		}
+		return true
+	})
+	return expired
+}
+
+// Reserved reports whether a generated room code would shadow a drop
+func Reserved(code string) bool {
+	_, exists := drops().Load(Normalize(code))
+	return exists
+}
+
+// Reset clears the store (used for testing)
+func Reset() {
+	drops().Range(func(d *Drop) bool {
+		drops().Delete(d.Name)
+		return true
+	})
+}
@@ -0,0 +1,102 @@
+// Package events fans out room and session lifecycle changes to anyone
+// watching a room, such as the SSE endpoint. It sits below room and session
+// so both can publish without importing each other.
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	PeerJoined Type = "peer_joined"
+	PeerLeft   Type = "peer_left"
+	Paired     Type = "paired"   // the room's session was created
+	Expiring   Type = "expiring" // the session expires soon
+	Closed     Type = "closed"   // the room or its session is gone; no events follow
+)
+
+// Event is one change to a room, identified by its code
+type Event struct {
+	Type      Type       `json:"type"`
+	Code      string     `json:"code"`
+	PeerID    string     `json:"peerId,omitempty"` // the peer that joined or left
+	Peers     []string   `json:"peers,omitempty"`  // roster after the change
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Reason    string     `json:"reason,omitempty"` // why a peer left or the room closed
+	Time      time.Time  `json:"time"`
+}
+
+// buffer is how many events a slow subscriber may fall behind before
+// events are dropped for it
+const buffer = 32
+
+var (
+	mu   sync.Mutex
+	subs = make(map[string]map[chan Event]struct{}) // room code -> subscribers
+)
+
+// Subscribe returns a channel of events for room code and a function that
+// ends the subscription. The channel is closed after a Closed event or
+// when cancel is called.
+func Subscribe(code string) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+
+	mu.Lock()
+	if subs[code] == nil {
+		subs[code] = make(map[chan Event]struct{})
+	}
+	subs[code][ch] = struct{}{}
+	mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, exists := subs[code][ch]; exists {
+				delete(subs[code], ch)
+				if len(subs[code]) == 0 {
+					delete(subs, code)
+				}
+				close(ch)
+			}
+		})
+	}
+	return ch, cancel
+}
+
+// Publish sends e to every subscriber of its room without blocking. A
+// Closed event ends every subscription to the room.
+func Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for ch := range subs[e.Code] {
+		select {
+		case ch <- e:
+		default:
+			slog.Warn("Dropping event for slow subscriber", "code", e.Code, "type", e.Type)
+		}
+		if e.Type == Closed {
+			close(ch)
+		}
+	}
+	if e.Type == Closed {
+		delete(subs, e.Code)
+	}
+}
+
+// Subscribers returns how many subscriptions room code has
+func Subscribers(code string) int {
+	mu.Lock()
+	defer mu.Unlock()
+	return len(subs[code])
+}
@@ -0,0 +1,141 @@
+package janitor
+
+import (
+	"frop/internal/device"
+	"frop/internal/drop"
+	"frop/internal/ratelimit"
+	"frop/internal/room"
+	"frop/internal/session"
+	"frop/internal/transfer"
+	"frop/models"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Report describes what a single sweep removed
+type Report struct {
+	Rooms    []string // codes of evicted rooms
+	Sessions int      // number of evicted sessions
+	Conns    int      // connections notified and closed
+	Warned   int      // sessions whose peers were warned of upcoming expiry
+	Drops    []string // names of lapsed drop reservations
+	Devices  []string // IDs of trusted devices unused for too long
+	Resumes  int      // interrupted transfers no longer resumable
+}
+
+func (r Report) Empty() bool {
+	return len(r.Rooms) == 0 && r.Sessions == 0 && r.Conns == 0 && r.Warned == 0 && len(r.Drops) == 0 && len(r.Devices) == 0 && r.Resumes == 0
+}
+
+// warnBefore is how long ahead of a session's expiry its peers get
+// "expiring_soon"
+var warnBefore = 2 * time.Minute
+
+// SetExpiryWarning changes how long ahead of expiry peers are warned. The
+// warning is only sent by a sweep, so it should exceed the sweep interval.
+func SetExpiryWarning(d time.Duration) {
+	warnBefore = d
+}
+
+// Janitor periodically evicts expired rooms and sessions. Lazy expiry in the
+// lookup paths only catches entries someone asks for again; the janitor
+// catches the rest.
+type Janitor struct {
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func New(interval time.Duration) *Janitor {
+	return &Janitor{
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start runs sweeps in the background until Stop is called
+func (j *Janitor) Start() {
+	go j.run()
+}
+
+// Stop halts the background sweeps and waits for the current one to finish
+func (j *Janitor) Stop() {
+	j.once.Do(func() { close(j.stop) })
+	<-j.done
+}
+
+func (j *Janitor) run() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		case now := <-ticker.C:
+			report := Sweep(now)
+			if !report.Empty() {
+				slog.Info("Janitor sweep", "rooms", report.Rooms, "sessions", report.Sessions, "conns", report.Conns, "warned", report.Warned, "drops", report.Drops, "devices", report.Devices, "resumes", report.Resumes)
+			}
+		}
+	}
+}
+
+// Sweep evicts everything that has expired at now. Peers still attached to
+// an evicted session, or still waiting alone or for approval in an evicted
+// room, are told why and disconnected. Peers of sessions about to expire are warned.
+func Sweep(now time.Time) Report {
+	var report Report
+	closed := make(map[*room.Peer]bool)
+
+	for _, s := range session.ExpiringSoon(now, warnBefore) {
+		report.Warned++
+		expiresAt := s.ExpiresAt()
+		for _, peer := range s.Peers() {
+			peer.SendResponse(&models.WsResponse{Type: models.ExpiringSoon, ExpiresAt: &expiresAt})
+		}
+	}
+
+	for _, s := range session.Sweep(now) {
+		report.Sessions++
+		for _, peer := range s.Peers() {
+			closed[peer] = true
+		}
+		report.Conns += closePeers(s.Peers(), models.SessionExpired)
+	}
+
+	for _, r := range room.Sweep(now) {
+		report.Rooms = append(report.Rooms, r.Code)
+
+		// Peers that made it into a session are governed by the session's
+		// lifespan, not the room's
+		var waiting []*room.Peer
+		for _, peer := range r.Peers() {
+			if !closed[peer] && !session.HasConn(peer.Conn) {
+				waiting = append(waiting, peer)
+			}
+		}
+		waiting = append(waiting, r.Pending()...)
+		report.Conns += closePeers(waiting, models.RoomExpired)
+	}
+
+	report.Drops = drop.Sweep(now)
+	report.Devices = device.Sweep(now)
+	report.Resumes = transfer.Sweep(now)
+	ratelimit.Sweep(now)
+
+	return report
+}
+
+func closePeers(peers []*room.Peer, reason models.Type) int {
+	for _, peer := range peers {
+		peer.SendResponse(&models.WsResponse{Type: reason})
+		peer.Close()
+	}
+	return len(peers)
+}
@@ -0,0 +1,71 @@
+package qr
+
+// finderLike is the 1:1:3:1:1 pattern, with four light modules on one side,
+// that readers could mistake for a finder
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty scores the symbol as it stands; the mask with the lowest score
+// is the easiest to read
+func (c *Code) penalty() int {
+	score := 0
+	dark := 0
+
+	for i := range c.Size {
+		score += c.linePenalty(func(j int) bool { return c.modules[i][j] })
+		score += c.linePenalty(func(j int) bool { return c.modules[j][i] })
+	}
+
+	for y := range c.Size {
+		for x := range c.Size {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.Size && y+1 < c.Size {
+				v := c.modules[y][x]
+				if c.modules[y][x+1] == v && c.modules[y+1][x] == v && c.modules[y+1][x+1] == v {
+					score += 3
+				}
+			}
+		}
+	}
+
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return score + k*10
+}
+
+// linePenalty scores one row or column, read through at
+func (c *Code) linePenalty(at func(int) bool) int {
+	score := 0
+
+	run := 1
+	for j := 1; j <= c.Size; j++ {
+		if j < c.Size && at(j) == at(j-1) {
+			run++
+			continue
+		}
+		if run >= 5 {
+			score += 3 + run - 5
+		}
+		run = 1
+	}
+
+	for j := 0; j+11 <= c.Size; j++ {
+		for _, pattern := range finderLike {
+			match := true
+			for k, v := range pattern {
+				if at(j+k) != v {
+					match = false
+					break
+				}
+			}
+			if match {
+				score += 40
+			}
+		}
+	}
+	return score
+}
@@ -0,0 +1,202 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// "HELLO WORLD" at 1-M, from the worked example in ISO/IEC 18004
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("Expected ECC %v, got %v", want, got)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	for mask, want := range map[int]int{0: 0b101010000010010, 1: 0b101000100100101, 2: 0b101111001111100} {
+		if got := formatBits(mask); got != want {
+			t.Errorf("Mask %d: expected format %015b, got %015b", mask, want, got)
+		}
+	}
+	if got := versionBits(7); got != 0b000111110010010100 {
+		t.Errorf("Expected version 7 bits 000111110010010100, got %018b", got)
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	for version, want := range map[int][]int{2: {6, 18}, 7: {6, 22, 38}, 32: {6, 34, 60, 86, 112, 138}} {
+		got := alignmentPositions(version, 17+4*version)
+		if len(got) != len(want) {
+			t.Fatalf("Version %d: expected %v, got %v", version, want, got)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Version %d: expected %v, got %v", version, want, got)
+				break
+			}
+		}
+	}
+}
+
+// TestRoundTrip reads encoded symbols back the way a scanner would: format
+// bits, unmasking, zigzag order, de-interleaving and the RS check
+func TestRoundTrip(t *testing.T) {
+	inputs := []string{
+		"https://frop.example/j/ABC123",
+		"https://frop.example/j/purple-tiger-42",
+		strings.Repeat("x", 200), // several blocks of two sizes
+		strings.Repeat("y", 400), // past version 7, so with version information
+	}
+	for _, in := range inputs {
+		c, err := Encode([]byte(in))
+		if err != nil {
+			t.Fatalf("Encode(%d bytes): %v", len(in), err)
+		}
+		if got := readBack(t, c); got != in {
+			t.Errorf("Version %d: read back %q, want %q", c.Version, got, in)
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(make([]byte, 3000)); err != ErrTooLong {
+		t.Errorf("Expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestImages(t *testing.T) {
+	c, _ := Encode([]byte("https://frop.example/j/ABC123"))
+
+	data, err := c.PNG(4)
+	if err != nil {
+		t.Fatalf("PNG: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("PNG does not decode: %v", err)
+	}
+	if side := (c.Size + 8) * 4; img.Bounds().Dx() != side {
+		t.Errorf("Expected %dpx wide, got %d", side, img.Bounds().Dx())
+	}
+
+	if svg := string(c.SVG()); !strings.HasPrefix(svg, "<svg") || !strings.HasSuffix(svg, "</svg>") {
+		t.Errorf("Unexpected SVG: %.80s", svg)
+	}
+}
+
+// readBack decodes c without using any state from the encoder other than
+// the modules themselves
+func readBack(t *testing.T, c *Code) string {
+	t.Helper()
+
+	// format bits from around the top-left finder
+	var bits int
+	for i := 0; i <= 5; i++ {
+		bits |= b2i(c.Dark(8, i)) << i
+	}
+	bits |= b2i(c.Dark(8, 7))<<6 | b2i(c.Dark(8, 8))<<7 | b2i(c.Dark(7, 8))<<8
+	for i := 9; i < 15; i++ {
+		bits |= b2i(c.Dark(14-i, 8)) << i
+	}
+	mask := -1
+	for m := range 8 {
+		if formatBits(m) == bits {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("Unreadable format bits %015b", bits)
+	}
+
+	// rebuild the function pattern map on a blank symbol of the same size
+	blank := newCode(c.Version)
+	blank.drawFunctionPatterns()
+
+	var raw []byte
+	var cur byte
+	n := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := range c.Size {
+			for j := range 2 {
+				x, y := right-j, vert
+				if upward {
+					y = c.Size - 1 - vert
+				}
+				if blank.isFunc[y][x] {
+					continue
+				}
+				cur = cur<<1 | byte(b2i(c.Dark(x, y) != maskBit(mask, x, y)))
+				if n++; n%8 == 0 {
+					raw = append(raw, cur)
+				}
+			}
+		}
+	}
+
+	if n != rawModules(c.Version) {
+		t.Fatalf("Version %d: found %d data modules, want %d", c.Version, n, rawModules(c.Version))
+	}
+
+	// de-interleave and check every block
+	numBlocks, eccLen := numBlocksM[c.Version], eccPerBlockM[c.Version]
+	total := rawModules(c.Version) / 8
+	numShort := numBlocks - total%numBlocks
+	shortLen := total / numBlocks
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range shortLen + 1 {
+		for j := range blocks {
+			if i == shortLen-eccLen && j < numShort {
+				continue
+			}
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+	var data []byte
+	for _, block := range blocks {
+		n := len(block) - eccLen
+		if ecc := rsRemainder(block[:n], rsDivisor(eccLen)); !bytes.Equal(ecc, block[n:]) {
+			t.Fatalf("Block fails the RS check")
+		}
+		data = append(data, block[:n]...)
+	}
+
+	// byte mode segment
+	var stream bitBuffer
+	for _, b := range data {
+		stream.append(uint(b), 8)
+	}
+	read := func(n int) int {
+		v := 0
+		for _, bit := range stream[:n] {
+			v = v<<1 | b2i(bit)
+		}
+		stream = stream[n:]
+		return v
+	}
+	if mode := read(4); mode != 0b0100 {
+		t.Fatalf("Expected byte mode, got %04b", mode)
+	}
+	out := make([]byte, read(countBits(c.Version)))
+	for i := range out {
+		out[i] = byte(read(8))
+	}
+	return string(out)
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Config holds the limits for each guarded operation
+type Config struct {
+	Create    Limit // POST /api/room, per client IP
+	Join      Limit // join attempts, per client IP and per connection
+	Reconnect Limit // failed reconnects, per client IP and per connection
+	Ban       Ban   // applies to all three
+
+	// TrustProxy takes the client IP from the last X-Forwarded-For entry,
+	// the one a reverse proxy appends. Without a proxy the header can be
+	// forged.
+	TrustProxy bool
+}
+
+// Defaults are the limits in force until Configure is called
+var Defaults = Config{
+	Create:    Limit{Burst: 10, Per: time.Minute},
+	Join:      Limit{Burst: 20, Per: time.Minute},
+	Reconnect: Limit{Burst: 5, Per: time.Minute},
+	Ban:       Ban{After: 10, For: 10 * time.Minute},
+}
+
+var (
+	Create    = New(Defaults.Create, Defaults.Ban)
+	Join      = New(Defaults.Join, Defaults.Ban)
+	Reconnect = New(Defaults.Reconnect, Defaults.Ban)
+
+	trustProxy atomic.Bool
+)
+
+// Configure changes the limits in place, dropping all buckets
+func Configure(cfg Config) {
+	Create.reset(cfg.Create, cfg.Ban)
+	Join.reset(cfg.Join, cfg.Ban)
+	Reconnect.reset(cfg.Reconnect, cfg.Ban)
+	trustProxy.Store(cfg.TrustProxy)
+}
+
+// Sweep drops idle buckets from every limiter
+func Sweep(now time.Time) {
+	for _, l := range []*Limiter{Create, Join, Reconnect} {
+		l.Sweep(now)
+	}
+}
+
+// ParseLimit reads a limit written as "burst/period", e.g. "10/1m". "off"
+// disables the limit.
+func ParseLimit(s string) (Limit, error) {
+	if s == "off" {
+		return Limit{}, nil
+	}
+	burst, per, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q is not burst/period", s)
+	}
+	n, err := strconv.Atoi(burst)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("limit %q has an invalid burst", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("limit %q has an invalid period", s)
+	}
+	return Limit{Burst: n, Per: d}, nil
+}
+
+// ClientIP returns the key for the client that sent r
+func ClientIP(r *http.Request) string {
+	if trustProxy.Load() {
+		// Entries before the proxy's own come from the client, which can
+		// put anything there
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			last := fwd[len(fwd)-1]
+			if i := strings.LastIndex(last, ","); i >= 0 {
+				last = last[i+1:]
+			}
+			if ip := strings.TrimSpace(last); ip != "" {
+				return "ip:" + ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,193 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRateLimited = errors.New("rate limited")
+	ErrBanned      = errors.New("temporarily banned")
+)
+
+// Limit allows Burst requests at once, refilling at Burst per Per. The zero
+// Limit allows everything.
+type Limit struct {
+	Burst int
+	Per   time.Duration
+}
+
+func (l Limit) unlimited() bool {
+	return l.Burst <= 0 || l.Per <= 0
+}
+
+// rate is the refill rate in tokens per second
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Per.Seconds()
+}
+
+// Ban shuts a key out for For once it has been refused After times in a row.
+// The zero Ban never bans.
+type Ban struct {
+	After int
+	For   time.Duration
+}
+
+// Limiter is a set of token buckets, one per key. Keys are opaque strings
+// such as a client IP or a connection; a request may be charged to several.
+type Limiter struct {
+	mu      sync.Mutex
+	limit   Limit
+	ban     Ban
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens      float64
+	last        time.Time // when tokens was last refilled
+	strikes     int       // refusals since the last allowed request
+	bannedUntil time.Time
+}
+
+func New(limit Limit, ban Ban) *Limiter {
+	return &Limiter{
+		limit:   limit,
+		ban:     ban,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *Limiter) reset(limit Limit, ban Ban) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+	l.ban = ban
+	l.buckets = make(map[string]*bucket)
+}
+
+// Allow takes a token from the bucket of every key, or from none if any of
+// them is empty or banned. On refusal it returns how long to wait before
+// trying again.
+func (l *Limiter) Allow(now time.Time, keys ...string) (time.Duration, error) {
+	return l.take(now, true, keys)
+}
+
+// Check reports whether a request would be allowed without taking a token.
+// A refusal still counts towards a ban. Pair it with Charge for limits that
+// only count failures.
+func (l *Limiter) Check(now time.Time, keys ...string) (time.Duration, error) {
+	return l.take(now, false, keys)
+}
+
+// Charge takes a token from the bucket of every key, however many are left
+func (l *Limiter) Charge(now time.Time, keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit.unlimited() {
+		return
+	}
+	for _, key := range keys {
+		b := l.bucket(key, now)
+		b.tokens = max(b.tokens-1, 0)
+	}
+}
+
+// Forget drops the bucket of key, e.g. when its connection closes
+func (l *Limiter) Forget(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buckets, key)
+}
+
+// Sweep drops buckets that are full again and not banned, which are
+// indistinguishable from new ones
+func (l *Limiter) Sweep(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.limit.Burst) && now.After(b.bannedUntil) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *Limiter) take(now time.Time, consume bool, keys []string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit.unlimited() {
+		return 0, nil
+	}
+
+	buckets := make([]*bucket, len(keys))
+	for i, key := range keys {
+		buckets[i] = l.bucket(key, now)
+	}
+
+	for _, b := range buckets {
+		if now.Before(b.bannedUntil) {
+			return b.bannedUntil.Sub(now), ErrBanned
+		}
+	}
+
+	var wait time.Duration
+	for _, b := range buckets {
+		if b.tokens < 1 {
+			wait = max(wait, time.Duration(math.Ceil((1-b.tokens)/l.limit.rate()*float64(time.Second))))
+		}
+	}
+	if wait > 0 {
+		banned := false
+		for _, b := range buckets {
+			if b.tokens < 1 && l.strike(b, now) {
+				banned = true
+			}
+		}
+		if banned {
+			return l.ban.For, ErrBanned
+		}
+		return wait, ErrRateLimited
+	}
+
+	for _, b := range buckets {
+		b.strikes = 0
+		if consume {
+			b.tokens--
+		}
+	}
+	return 0, nil
+}
+
+// strike records a refusal against b and bans it once it has too many
+func (l *Limiter) strike(b *bucket, now time.Time) bool {
+	b.strikes++
+	if l.ban.After <= 0 || b.strikes < l.ban.After {
+		return false
+	}
+	b.strikes = 0
+	b.bannedUntil = now.Add(l.ban.For)
+	return true
+}
+
+func (l *Limiter) bucket(key string, now time.Time) *bucket {
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+		return b
+	}
+	l.refill(b, now)
+	return b
+}
+
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed.Seconds()*l.limit.rate(), float64(l.limit.Burst))
+		b.last = now
+	}
+}
@@ -0,0 +1,142 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	l := New(Limit{Burst: 3, Per: 3 * time.Second}, Ban{})
+	now := time.Now()
+
+	for i := range 3 {
+		if _, err := l.Allow(now, "a"); err != nil {
+			t.Fatalf("Request %d within burst refused: %v", i+1, err)
+		}
+	}
+	wait, err := l.Allow(now, "a")
+	if err != ErrRateLimited {
+		t.Fatalf("Expected ErrRateLimited past the burst, got %v", err)
+	}
+	if wait != time.Second {
+		t.Errorf("Expected to wait 1s for a token, got %v", wait)
+	}
+	if _, err := l.Allow(now, "b"); err != nil {
+		t.Errorf("Other keys should have their own bucket, got %v", err)
+	}
+
+	if _, err := l.Allow(now.Add(time.Second), "a"); err != nil {
+		t.Errorf("Expected a token after refilling, got %v", err)
+	}
+}
+
+func TestLimiterChargesAllKeysOrNone(t *testing.T) {
+	l := New(Limit{Burst: 1, Per: time.Minute}, Ban{})
+	now := time.Now()
+
+	l.Allow(now, "ip")
+	if _, err := l.Allow(now, "ip", "conn"); err != ErrRateLimited {
+		t.Fatalf("Expected refusal while one key is empty, got %v", err)
+	}
+	if _, err := l.Allow(now, "conn"); err != nil {
+		t.Errorf("A refused request should not charge the other keys, got %v", err)
+	}
+}
+
+func TestLimiterCheckAndCharge(t *testing.T) {
+	l := New(Limit{Burst: 2, Per: time.Minute}, Ban{})
+	now := time.Now()
+
+	for range 5 {
+		if _, err := l.Check(now, "a"); err != nil {
+			t.Fatalf("Check should not take tokens, got %v", err)
+		}
+	}
+	l.Charge(now, "a")
+	l.Charge(now, "a")
+	if _, err := l.Check(now, "a"); err != ErrRateLimited {
+		t.Errorf("Expected refusal after charging the burst, got %v", err)
+	}
+}
+
+func TestLimiterBan(t *testing.T) {
+	l := New(Limit{Burst: 1, Per: time.Minute}, Ban{After: 3, For: time.Hour})
+	now := time.Now()
+
+	l.Allow(now, "a")
+	l.Allow(now, "a")
+	l.Allow(now, "a")
+	if _, err := l.Allow(now, "a"); err != ErrBanned {
+		t.Fatalf("Expected a ban on the 3rd refusal, got %v", err)
+	}
+
+	later := now.Add(30 * time.Minute)
+	if wait, err := l.Allow(later, "a"); err != ErrBanned || wait != 30*time.Minute {
+		t.Errorf("Expected the ban to hold for another 30m, got %v %v", wait, err)
+	}
+	if _, err := l.Allow(now.Add(time.Hour+time.Second), "a"); err != nil {
+		t.Errorf("Expected the ban to lift, got %v", err)
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := New(Limit{Burst: 1, Per: time.Minute}, Ban{})
+	now := time.Now()
+
+	l.Allow(now, "a")
+	l.Sweep(now)
+	if len(l.buckets) != 1 {
+		t.Fatalf("Sweep should keep a bucket that is still refilling")
+	}
+	l.Sweep(now.Add(time.Minute))
+	if len(l.buckets) != 0 {
+		t.Errorf("Sweep should drop a bucket that is full again")
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	if l, err := ParseLimit("10/1m"); err != nil || l != (Limit{Burst: 10, Per: time.Minute}) {
+		t.Errorf("Expected 10 per minute, got %+v %v", l, err)
+	}
+	if l, err := ParseLimit("off"); err != nil || !l.unlimited() {
+		t.Errorf("Expected off to disable the limit, got %+v %v", l, err)
+	}
+	for _, bad := range []string{"10", "x/1m", "10/soon", "0/1m"} {
+		if _, err := ParseLimit(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestClientIPIgnoresForgedForwardedFor(t *testing.T) {
+	defer Configure(Defaults)
+
+	request := func(forwarded ...string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "10.0.0.1:4321"
+		for _, f := range forwarded {
+			r.Header.Add("X-Forwarded-For", f)
+		}
+		return r
+	}
+
+	Configure(Config{TrustProxy: true})
+	for _, forged := range []string{"6.6.6.6", "7.7.7.7, 8.8.8.8"} {
+		if ip := ClientIP(request(forged + ", 203.0.113.9")); ip != "ip:203.0.113.9" {
+			t.Errorf("Expected the proxy's entry after %q, got %s", forged, ip)
+		}
+	}
+	if ip := ClientIP(request("6.6.6.6", "203.0.113.9")); ip != "ip:203.0.113.9" {
+		t.Errorf("Expected the proxy's header, got %s", ip)
+	}
+	if ip := ClientIP(request()); ip != "ip:10.0.0.1" {
+		t.Errorf("Expected the remote address without the header, got %s", ip)
+	}
+
+	Configure(Config{})
+	if ip := ClientIP(request("6.6.6.6")); ip != "ip:10.0.0.1" {
+		t.Errorf("Expected the header ignored without a proxy, got %s", ip)
+	}
+}
@@ -0,0 +1,72 @@
+package room
+
+import (
+	"log/slog"
+	"strconv"
+)
+
+// Creator returns the peer holding the first slot of the room
+func (r *Room) Creator() *Peer {
+	return r.slots[0].Load()
+}
+
+// Knock parks peer in room code until the creator answers, returning the
+// request ID the creator approves or denies
+func Knock(code string, peer *Peer) (string, error) {
+	room, err := GetRoom(code)
+	if err != nil {
+		return "", err
+	}
+	id := "r" + strconv.FormatInt(room.nextRequest.Add(1), 10)
+	room.pending.Store(id, peer)
+	slog.Info("Peer waiting for approval", "code", room.Code, "request", id)
+	return id, nil
+}
+
+// Approve lets a parked peer in, claiming a slot for it exactly as JoinRoom
+// would. It returns the admitted peer and, as with JoinRoom, the room's
+// members once there are at least two.
+func Approve(code, requestID string) (*Peer, []*Peer, error) {
+	room, peer, err := takePending(code, requestID)
+	if err != nil {
+		return nil, nil, err
+	}
+	members, err := room.claimSlot(peer)
+	if err != nil {
+		return peer, nil, err
+	}
+	return peer, members, nil
+}
+
+// Deny removes a parked peer and returns it so the caller can tell it
+func Deny(code, requestID string) (*Peer, error) {
+	_, peer, err := takePending(code, requestID)
+	return peer, err
+}
+
+// Withdraw forgets a parked peer whose connection went away
+func Withdraw(code, requestID string) {
+	takePending(code, requestID)
+}
+
+// Pending returns the peers still waiting for the creator's answer
+func (r *Room) Pending() []*Peer {
+	var peers []*Peer
+	r.pending.Range(func(_, v any) bool {
+		peers = append(peers, v.(*Peer))
+		return true
+	})
+	return peers
+}
+
+func takePending(code, requestID string) (*Room, *Peer, error) {
+	room, err := GetRoom(code)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, exists := room.pending.LoadAndDelete(requestID)
+	if !exists {
+		return room, nil, ErrRequestNotFound
+	}
+	return room, v.(*Peer), nil
+}
@@ -6,4 +6,18 @@ var (
 	ErrRoomNotFound = errors.New("room not found")
 	ErrRoomFull     = errors.New("room full")
 	ErrRoomExpired  = errors.New("room expired")
+
+	ErrInvalidCapacity = errors.New("invalid room capacity")
+	ErrInvalidTTL      = errors.New("invalid room ttl")
+	ErrInvalidCode     = errors.New("invalid room code")
+	ErrCodeTaken       = errors.New("room code taken")
+	ErrNoCodeAvailable = errors.New("no room code available")
+
+	ErrSecretRequired = errors.New("secret required")
+	ErrWrongSecret    = errors.New("wrong secret")
+	ErrRoomLocked     = errors.New("room locked")
+
+	ErrAwaitingApproval = errors.New("awaiting approval")
+	ErrRequestNotFound  = errors.New("join request not found")
+	ErrNotCreator       = errors.New("not the room creator")
 )
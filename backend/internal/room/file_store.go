@@ -0,0 +1,92 @@
+package room
+
+import (
+	"frop/internal/store"
+	"time"
+)
+
+// record is the persisted form of a Room
+type record struct {
+	Code      string        `json:"code"`
+	Capacity  int           `json:"capacity"`
+	CreatedAt time.Time     `json:"createdAt"`
+	TTL       time.Duration `json:"ttl,omitempty"`
+	Secret    *Secret       `json:"secret,omitempty"`
+	Host      *Secret       `json:"host,omitempty"`
+	Guest     *Secret       `json:"guest,omitempty"`
+	Locked    bool          `json:"locked,omitempty"`
+}
+
+// FileStore keeps live rooms in memory and writes their metadata through to
+// an append-only log, so room codes survive a restart.
+type FileStore struct {
+	*MemoryStore
+	log *store.File[record]
+}
+
+// OpenFileStore opens the log at path and restores the rooms recorded in it
+func OpenFileStore(path string) (*FileStore, error) {
+	log, err := store.OpenFile[record](path)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		log:         log,
+	}
+	log.Range(func(_ string, rec record) bool {
+		fs.MemoryStore.Save(rec.room())
+		return true
+	})
+	return fs, nil
+}
+
+func (fs *FileStore) Add(room *Room) error {
+	if err := fs.MemoryStore.Add(room); err != nil {
+		return err
+	}
+	return fs.log.Put(room.Code, room.record())
+}
+
+func (fs *FileStore) Save(room *Room) error {
+	fs.MemoryStore.Save(room)
+	return fs.log.Put(room.Code, room.record())
+}
+
+func (fs *FileStore) Delete(code string) error {
+	fs.MemoryStore.Delete(code)
+	return fs.log.Delete(code)
+}
+
+func (fs *FileStore) Close() error {
+	return fs.log.Close()
+}
+
+func (r *Room) record() record {
+	return record{
+		Code:      r.Code,
+		Capacity:  r.Capacity,
+		CreatedAt: r.CreatedAt(),
+		TTL:       r.TTL,
+		Secret:    r.secret,
+		Host:      r.host,
+		Guest:     r.guest,
+		Locked:    r.Locked(),
+	}
+}
+
+func (rec record) room() *Room {
+	// Logs written before group rooms existed have no capacity
+	capacity := rec.Capacity
+	if capacity == 0 {
+		capacity = DefaultCapacity
+	}
+	r := newRoom(rec.Code, capacity, rec.CreatedAt)
+	r.TTL = rec.TTL
+	r.secret = rec.Secret
+	r.host = rec.Host
+	r.guest = rec.Guest
+	r.locked.Store(rec.Locked)
+	return r
+}
@@ -2,6 +2,8 @@ package room
 
 import (
 	"frop/models"
+	"io"
+	"strconv"
 	"sync"
 	"time"
 
@@ -12,14 +14,31 @@ import (
 const writeWait = 10 * time.Second
 
 type Peer struct {
-	Conn *websocket.Conn
-	mu   sync.Mutex
+	Conn  *websocket.Conn
+	Slot  int        // index of the room/session slot this peer holds
+	frame sync.Mutex // held for the whole of a message, see ChunkWriter
+	mu    sync.Mutex // held for each write to the connection
+
+	// responses waiting to be written, see Notify
+	noticeMu  sync.Mutex
+	notices   []*models.WsResponse
+	notifying bool // a goroutine is writing them
 }
 
 func (p *Peer) Is(conn *websocket.Conn) bool {
 	return p.Conn == conn
 }
 
+// ID is the peer's address within its room, derived from its slot: p1, p2, ...
+func (p *Peer) ID() string {
+	return PeerID(p.Slot)
+}
+
+// PeerID returns the ID of the peer holding slot
+func PeerID(slot int) string {
+	return "p" + strconv.Itoa(slot+1)
+}
+
 func (p *Peer) SendRequest(req *models.WsRequest) error {
 	return p.send(req)
 }
@@ -28,23 +47,97 @@ func (p *Peer) SendResponse(res *models.WsResponse) error {
 	return p.send(res)
 }
 
-func (p *Peer) SendChunk(chunk []byte) error {
+// Notify sends res from a goroutine of its own, after any responses
+// notified before it, so a relay can tell its sender about the flow of a
+// transfer without waiting on the sender's connection.
+func (p *Peer) Notify(res *models.WsResponse) {
+	p.noticeMu.Lock()
+	defer p.noticeMu.Unlock()
+	p.notices = append(p.notices, res)
+	if !p.notifying {
+		p.notifying = true
+		go p.notify()
+	}
+}
+
+// notify writes notified responses until none are left
+func (p *Peer) notify() {
+	for {
+		p.noticeMu.Lock()
+		if len(p.notices) == 0 {
+			p.notifying = false
+			p.noticeMu.Unlock()
+			return
+		}
+		res := p.notices[0]
+		p.notices = p.notices[1:]
+		p.noticeMu.Unlock()
+
+		p.send(res)
+	}
+}
+
+// ChunkWriter starts a binary message to the peer, which no other message
+// may interrupt until the writer is closed. The connection is only locked
+// for each write, so while the caller waits on the data, pings still reach
+// the peer. Each write gets its own deadline, so a slow reader only times
+// out once it stops reading altogether.
+func (p *Peer) ChunkWriter() (io.WriteCloser, error) {
+	p.frame.Lock()
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-	return p.Conn.WriteMessage(websocket.BinaryMessage, chunk)
+	w, err := p.Conn.NextWriter(websocket.BinaryMessage)
+	p.mu.Unlock()
+	if err != nil {
+		p.frame.Unlock()
+		return nil, err
+	}
+	return &chunkWriter{p: p, w: w}, nil
+}
+
+type chunkWriter struct {
+	p *Peer
+	w io.WriteCloser
+}
+
+func (c *chunkWriter) Write(b []byte) (int, error) {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	c.p.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.w.Write(b)
+}
+
+func (c *chunkWriter) Close() error {
+	defer c.p.frame.Unlock()
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	c.p.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.w.Close()
 }
 
 func (p *Peer) send(msg any) error {
+	p.frame.Lock()
+	defer p.frame.Unlock()
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	p.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 	return p.Conn.WriteJSON(msg)
 }
 
+// SendPing pings the peer. A control message may go between the pieces of
+// another, so it waits for neither lock.
 func (p *Peer) SendPing() error {
+	return p.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+}
+
+// Close asks the remote end to close the connection. The ws read loop then
+// sees the close and runs its usual disconnect path; a peer that never
+// answers is dropped once its read deadline passes.
+func (p *Peer) Close() error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-	return p.Conn.WriteMessage(websocket.PingMessage, nil)
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := p.Conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait)); err != nil {
+		return p.Conn.Close()
+	}
+	return p.Conn.SetReadDeadline(time.Now().Add(writeWait))
 }
@@ -1,86 +1,345 @@
 package room
 
 import (
-	"fmt"
+	"frop/internal/codes"
+	"frop/internal/events"
 	"log/slog"
-	"math/rand/v2"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
-const lifespan = 30 * time.Minute
-const alphabets = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+// DefaultTTL is how long a room lives when its creator asks for nothing else
+const DefaultTTL = 30 * time.Minute
+
+// maxTTL caps the lifetime a creator may ask for
+var maxTTL = 24 * time.Hour
+
+// SetMaxTTL changes the longest lifetime a room or session may be given
+func SetMaxTTL(d time.Duration) {
+	maxTTL = max(d, DefaultTTL)
+}
+
+// MaxTTL returns the longest lifetime a room or session may be given
+func MaxTTL() time.Duration {
+	return maxTTL
+}
+
+// ClampTTL checks a requested lifetime. Anything longer than the server
+// allows is cut down to the maximum rather than refused.
+func ClampTTL(d time.Duration) (time.Duration, error) {
+	if d < 0 {
+		return 0, ErrInvalidTTL
+	}
+	return min(d, maxTTL), nil
+}
+
+// TTLFromSeconds checks a lifetime requested in whole seconds, as clients
+// send it. It is bounded before becoming a Duration, which a huge count of
+// seconds would overflow.
+func TTLFromSeconds(secs int) (time.Duration, error) {
+	if secs < 0 {
+		return 0, ErrInvalidTTL
+	}
+	return time.Duration(min(int64(secs), int64(maxTTL/time.Second))) * time.Second, nil
+}
+
+// maxCodeAttempts bounds how many codes CreateRoom tries before giving up on
+// a crowded code space
+const maxCodeAttempts = 10
+
+// generator produces room codes, and normalizes and validates typed ones
+var generator = codes.Default()
+
+// SetCodeGenerator changes how room codes look. Call it before serving
+// requests; rooms created under another generator may fail validation.
+func SetCodeGenerator(g *codes.Generator) {
+	generator = g
+}
+
+// reserved reports codes that are spoken for outside the room store, such as
+// drop names, and must not be generated
+var reserved = func(code string) bool { return false }
+
+// SetReserved installs the check for codes CreateRoomWithOptions must skip
+func SetReserved(fn func(code string) bool) {
+	reserved = fn
+}
+
+// DefaultCapacity is the size of a room created without options: one
+// sender, one receiver.
+const DefaultCapacity = 2
+
+// maxCapacity caps how many peers a group room may hold
+var maxCapacity = 8
+
+// SetMaxCapacity changes the largest capacity CreateRoomWithOptions accepts
+func SetMaxCapacity(n int) {
+	maxCapacity = max(n, DefaultCapacity)
+}
+
+// Options configure a new room. The zero value gives a two-peer room.
+type Options struct {
+	Capacity int    // how many peers may join, 0 means DefaultCapacity
+	Secret   string // passphrase or PIN every joiner must present, "" for none
+	Host     string // key the creator's seat is kept for, "" when the first joiner takes it
+	Guest    string // key the second seat is kept for, "" when approved joiners take it
+
+	// TTL is how long the room, and the session made from it, may live.
+	// 0 means DefaultTTL; longer than the server maximum is capped.
+	TTL time.Duration
+}
 
 type Room struct {
-	peerA     atomic.Pointer[Peer]
-	peerB     atomic.Pointer[Peer]
+	slots     []atomic.Pointer[Peer] // one per member, len == Capacity
 	Code      string
-	CreatedAt time.Time
+	Capacity  int
+	createdAt atomic.Int64  // unix nanoseconds
+	TTL       time.Duration // requested lifetime, 0 for DefaultTTL
+
+	secret         *Secret // nil when the room is open
+	host           *Secret // holds slot 0 for whoever presents it, see Options.Host
+	guest          *Secret // holds slot 1 the same way, see Options.Guest
+	failedAttempts atomic.Int32
+	locked         atomic.Bool
+
+	pending     sync.Map // map[string]*Peer, request ID -> peer waiting for approval
+	nextRequest atomic.Int64
+}
+
+func newRoom(code string, capacity int, createdAt time.Time) *Room {
+	r := &Room{
+		slots:    make([]atomic.Pointer[Peer], capacity),
+		Code:     code,
+		Capacity: capacity,
+	}
+	r.createdAt.Store(createdAt.UnixNano())
+	return r
 }
 
-// CreateRoom creates a new empty room, stores it, and returns the code
+// CreateRoom creates a new empty two-peer room, stores it, and returns the
+// code. It returns "" if no free code could be found or the room could not
+// be saved.
 func CreateRoom() string {
-	code := generateRandomCode()
-	room := &Room{
-		Code:      code,
-		CreatedAt: time.Now(),
+	room, err := CreateRoomWithOptions(Options{})
+	if err != nil {
+		return ""
 	}
-	roomStore.Store(code, room)
-	slog.Info("Created new room", "code", code)
-	return code
+	return room.Code
 }
 
-func GetRoom(code string) (*Room, error) {
-	v, exists := roomStore.Load(code)
-	if !exists {
-		return nil, ErrRoomNotFound
+// CreateRoomWithOptions creates a new empty room, stores it, and returns it
+func CreateRoomWithOptions(opts Options) (*Room, error) {
+	capacity := opts.Capacity
+	if capacity == 0 {
+		capacity = DefaultCapacity
 	}
-	room := v.(*Room)
-	if time.Since(room.CreatedAt) > lifespan {
-		deleteRoom(code)
-		return nil, ErrRoomExpired
+	if capacity < DefaultCapacity || capacity > maxCapacity {
+		return nil, ErrInvalidCapacity
 	}
-	return room, nil
+	ttl, err := ClampTTL(opts.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	for range maxCodeAttempts {
+		room := newRoom(generator.Generate(), capacity, time.Now())
+		if reserved(room.Code) {
+			continue
+		}
+		if opts.Secret != "" {
+			room.secret = NewSecret(opts.Secret)
+		}
+		if opts.Host != "" {
+			room.host = NewKeySecret(opts.Host)
+		}
+		if opts.Guest != "" {
+			room.guest = NewKeySecret(opts.Guest)
+		}
+		room.TTL = ttl
+		err := rooms().Add(room)
+		if err == ErrCodeTaken {
+			slog.Warn("Room code collision, retrying", "code", room.Code)
+			continue
+		}
+		if err != nil {
+			slog.Error("Failed to save room", "code", room.Code, "error", err)
+			return nil, err
+		}
+		slog.Info("Created new room", "code", room.Code, "capacity", capacity, "ttl", room.Lifetime())
+		return room, nil
+	}
+	return nil, ErrNoCodeAvailable
 }
 
-// JoinRoom adds a peer to the room using atomic CAS.
-// Returns (peers, nil) when this peer completes the pair.
+func GetRoom(code string) (*Room, error) {
+	return loadRoom(code, time.Now())
+}
+
+// JoinRoom claims the first free slot for peer using atomic CAS and assigns
+// the peer its ID. A protected room needs the matching secret.
+// Returns (members, nil) once the room holds at least two peers; members
+// includes the new peer.
 // Returns (nil, nil) when this is the first peer.
-func JoinRoom(code string, peer *Peer) ([]*Peer, error) {
-	v, exists := roomStore.Load(code)
-	if !exists {
-		slog.Error("No room found", "code", code)
-		return nil, ErrRoomNotFound
+// Returns ErrAwaitingApproval when the creator has to let this peer in; the
+// caller then parks it with Knock. In a room with a host or a guest, secret
+// may be the host or guest key instead, which takes the seat kept for it.
+func JoinRoom(code, secret string, peer *Peer) ([]*Peer, error) {
+	room, err := loadRoom(code, time.Now())
+	if err != nil {
+		slog.Error("Cannot join room", "code", code, "error", err)
+		return nil, err
+	}
+	if room.Locked() {
+		return nil, ErrRoomLocked
+	}
+	if room.host != nil && secret != "" && room.host.Matches(secret) {
+		return room.claimKept(0, peer)
 	}
-	room := v.(*Room)
+	if room.guest != nil && secret != "" && room.guest.Matches(secret) {
+		return room.claimKept(1, peer)
+	}
+	if err := room.checkSecret(secret); err != nil {
+		slog.Warn("Rejected join", "code", code, "error", err)
+		return nil, err
+	}
+	if len(room.Peers()) >= room.Capacity || room.kept() >= room.Capacity {
+		return nil, ErrRoomFull
+	}
+	if room.Creator() != nil {
+		return nil, ErrAwaitingApproval
+	}
+
+	return room.claimSlot(peer)
+}
 
-	// Try to claim first slot
-	if room.peerA.CompareAndSwap(nil, peer) {
-		slog.Info("Successfully joined room", "code", code)
-		return nil, nil
+// kept returns how many seats, from the first, are kept for a key
+func (r *Room) kept() int {
+	switch {
+	case r.guest != nil:
+		return 2
+	case r.host != nil:
+		return 1
 	}
+	return 0
+}
+
+// claimKept puts peer in the seat kept for the key it presented: the
+// creator's for the host, the second for the guest
+func (r *Room) claimKept(slot int, peer *Peer) ([]*Peer, error) {
+	peer.Slot = slot
+	if !r.slots[slot].CompareAndSwap(nil, peer) {
+		return nil, ErrRoomFull
+	}
+	slog.Info("Peer took its kept seat", "code", r.Code, "peer", peer.ID(), "slot", slot)
+	events.Publish(events.Event{Type: events.PeerJoined, Code: r.Code, PeerID: peer.ID(), Peers: r.Roster()})
+	return r.members(), nil
+}
 
-	// Try to claim second slot
-	if room.peerB.CompareAndSwap(nil, peer) {
-		slog.Info("Successfully joined room", "code", code)
-		// Return both peers - peerA is guaranteed to be set
-		return []*Peer{room.peerA.Load(), peer}, nil
+// claimSlot puts peer in the first free slot after the seats kept for a key
+func (r *Room) claimSlot(peer *Peer) ([]*Peer, error) {
+	for i := r.kept(); i < len(r.slots); i++ {
+		// The peer is not visible to anyone else until the CAS succeeds
+		peer.Slot = i
+		if !r.slots[i].CompareAndSwap(nil, peer) {
+			continue
+		}
+
+		slog.Info("Successfully joined room", "code", r.Code, "peer", peer.ID())
+		events.Publish(events.Event{Type: events.PeerJoined, Code: r.Code, PeerID: peer.ID(), Peers: r.Roster()})
+		return r.members(), nil
 	}
 
 	return nil, ErrRoomFull
 }
 
-func (r *Room) SetCreatedAt(t time.Time) {
-	r.CreatedAt = t
+// members returns the room's peers once there are at least two
+func (r *Room) members() []*Peer {
+	members := r.Peers()
+	if len(members) < 2 {
+		return nil
+	}
+	return members
 }
 
-// generateRandomCode generates a random six digit alpha-numeric code, eg: ABC123
-func generateRandomCode() string {
-	prefix := make([]byte, 3)
-	for i := range 3 {
-		idx := rand.IntN(len(alphabets))
-		prefix[i] = alphabets[idx]
+// Lifetime returns how long the room lives after it is created
+func (r *Room) Lifetime() time.Duration {
+	if r.TTL == 0 {
+		return DefaultTTL
 	}
-	suffix := rand.IntN(1000)
-	return fmt.Sprintf("%s%03d", prefix, suffix)
+	return r.TTL
+}
+
+// CreatedAt returns when the room was created
+func (r *Room) CreatedAt() time.Time {
+	return time.Unix(0, r.createdAt.Load())
+}
+
+// ExpiresAt returns when the room expires
+func (r *Room) ExpiresAt() time.Time {
+	return r.CreatedAt().Add(r.Lifetime())
+}
+
+// Expired reports whether the room has outlived its lifetime at now
+func (r *Room) Expired(now time.Time) bool {
+	return now.After(r.ExpiresAt())
+}
+
+// Peers returns the peers currently holding a slot in the room, in slot order
+func (r *Room) Peers() []*Peer {
+	var peers []*Peer
+	for i := range r.slots {
+		if peer := r.slots[i].Load(); peer != nil {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+// Roster returns the IDs of the peers holding a slot, in slot order
+func (r *Room) Roster() []string {
+	var ids []string
+	for _, peer := range r.Peers() {
+		ids = append(ids, peer.ID())
+	}
+	return ids
+}
+
+// Release frees slot so the room can take another peer in it
+func (r *Room) Release(slot int) {
+	if slot >= 0 && slot < len(r.slots) {
+		r.slots[slot].Store(nil)
+	}
+}
+
+// SetLocked locks the room against new joins, or unlocks it. Unlocking also
+// forgives earlier wrong secrets.
+func (r *Room) SetLocked(locked bool) {
+	if locked {
+		r.lock()
+		return
+	}
+	r.failedAttempts.Store(0)
+	if r.locked.CompareAndSwap(true, false) {
+		if err := rooms().Save(r); err != nil {
+			slog.Error("Failed to save room", "code", r.Code, "error", err)
+		}
+	}
+}
+
+// Close removes the room immediately, telling its watchers why, and returns
+// it so the caller can disconnect whoever is still in it
+func Close(code, reason string) (*Room, error) {
+	room, err := GetRoom(code)
+	if err != nil {
+		return nil, err
+	}
+	deleteRoom(room.Code, reason)
+	slog.Info("Room closed", "code", room.Code)
+	return room, nil
+}
+
+// SetCreatedAt is for testing - allows back-dating a room
+func (r *Room) SetCreatedAt(t time.Time) {
+	r.createdAt.Store(t.UnixNano())
 }
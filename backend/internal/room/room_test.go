@@ -1,29 +1,98 @@
 package room
 
 import (
-	"fmt"
+	"frop/internal/codes"
 	"testing"
+	"time"
 )
 
-func TestGenerateRandomCode(t *testing.T) {
-	code := generateRandomCode()
-	fmt.Printf("Generated code: %s", code)
-	for i := range 3 {
-		if !isLetter(code[i]) {
-			t.Errorf("Expected %b at index %d to be A-Z", code[i], i)
+func TestCreateRoomRetriesOnCollision(t *testing.T) {
+	defer SetCodeGenerator(codes.Default())
+	defer Reset()
+
+	// Two symbols, four characters: only 16 possible codes
+	g, err := codes.New(codes.Random, 4, "AB", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCodeGenerator(g)
+
+	// Occupy all but one code, so creation must retry until it finds it
+	free := "BBBB"
+	for _, code := range allCodes("AB", 4) {
+		if code != free {
+			rooms().Add(newRoom(code, DefaultCapacity, time.Now()))
 		}
 	}
-	for i := 3; i < 6; i++ {
-		if !isDigit(code[i]) {
-			t.Errorf("Expected %b at index %d to be 0-9", code[i], i)
+
+	var created *Room
+	for range 20 {
+		created, err = CreateRoomWithOptions(Options{})
+		if err == nil {
+			break
 		}
 	}
+	if err != nil {
+		t.Fatalf("Expected the free code to be found eventually, got %v", err)
+	}
+	if created.Code != free {
+		t.Errorf("Expected the only free code %s, got %s", free, created.Code)
+	}
+
+	// Now every code is taken: creation must fail rather than overwrite
+	if _, err := CreateRoomWithOptions(Options{}); err != ErrNoCodeAvailable {
+		t.Errorf("Expected ErrNoCodeAvailable, got %v", err)
+	}
+	if r, _ := rooms().Load(free); r != created {
+		t.Error("Existing room was overwritten")
+	}
 }
 
-func isLetter(char byte) bool {
-	return char >= 'A' && char <= 'Z'
+func TestJoinRejectsBadCheckCharacter(t *testing.T) {
+	defer SetCodeGenerator(codes.Default())
+	defer Reset()
+
+	g, _ := codes.New(codes.Classic, 0, "", true)
+	SetCodeGenerator(g)
+
+	code := CreateRoom()
+	typo := []byte(code)
+	if typo[0] == 'A' {
+		typo[0] = 'B'
+	} else {
+		typo[0] = 'A'
+	}
+
+	if _, err := JoinRoom(string(typo), "", &Peer{}); err != ErrInvalidCode {
+		t.Errorf("Expected ErrInvalidCode for %s (created %s), got %v", typo, code, err)
+	}
+	if _, err := GetRoom(code); err != nil {
+		t.Errorf("Correct code should still resolve, got %v", err)
+	}
 }
 
-func isDigit(char byte) bool {
-	return char >= '0' && char <= '9'
+func TestSecretHash(t *testing.T) {
+	pin := NewSecret("4821")
+	if pin.Iter != secretIter || !pin.Matches("4821") || pin.Matches("4822") {
+		t.Errorf("Expected a PIN hashed with %d rounds that only its own value matches, got %+v", secretIter, pin)
+	}
+
+	// keys, and secrets stored before PBKDF2, are a single salted SHA-256
+	key := NewKeySecret("device-key")
+	if key.Iter != 0 || !key.Matches("device-key") || key.Matches("other-key") {
+		t.Errorf("Expected a single-round key secret, got %+v", key)
+	}
+}
+
+func allCodes(alphabet string, n int) []string {
+	if n == 0 {
+		return []string{""}
+	}
+	var out []string
+	for _, prefix := range allCodes(alphabet, n-1) {
+		for _, c := range alphabet {
+			out = append(out, prefix+string(c))
+		}
+	}
+	return out
 }
@@ -0,0 +1,114 @@
+package room
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"log/slog"
+)
+
+// maxSecretAttempts is how many wrong secrets a room tolerates before it
+// locks itself against any further joins
+const maxSecretAttempts = 5
+
+// secretIter is how many PBKDF2-SHA256 rounds a passphrase or PIN is hashed
+// with, so that guessing a short PIN from a copy of the room log is slow
+var secretIter = 600_000
+
+// SetSecretIterations changes the PBKDF2 rounds new secrets are hashed with
+// (for testing - the real cost dominates a test that joins protected rooms).
+// Call it before serving requests.
+func SetSecretIterations(n int) {
+	secretIter = n
+}
+
+// Secret is a salted hash of a passphrase or PIN. The plain secret is never
+// stored, in memory or on disk.
+type Secret struct {
+	Salt []byte `json:"salt"`
+	Hash []byte `json:"hash"`
+	Iter int    `json:"iter,omitempty"` // PBKDF2 rounds, 0 for a single SHA-256
+}
+
+// NewSecret hashes a passphrase or PIN chosen by a person
+func NewSecret(plain string) *Secret {
+	return newSecret(plain, secretIter)
+}
+
+// NewKeySecret hashes a random key, such as a device's, with a single
+// SHA-256: a key cannot be guessed, so a slow hash would only slow down
+// every check
+func NewKeySecret(plain string) *Secret {
+	return newSecret(plain, 0)
+}
+
+func newSecret(plain string, iter int) *Secret {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	return &Secret{
+		Salt: salt,
+		Hash: hashSecret(salt, plain, iter),
+		Iter: iter,
+	}
+}
+
+// Matches compares attempt with the secret in constant time
+func (s *Secret) Matches(attempt string) bool {
+	return subtle.ConstantTimeCompare(hashSecret(s.Salt, attempt, s.Iter), s.Hash) == 1
+}
+
+func hashSecret(salt []byte, plain string, iter int) []byte {
+	if iter == 0 {
+		h := sha256.New()
+		h.Write(salt)
+		h.Write([]byte(plain))
+		return h.Sum(nil)
+	}
+	key, err := pbkdf2.Key(sha256.New, plain, salt, iter, sha256.Size)
+	if err != nil {
+		return nil
+	}
+	return key
+}
+
+// SecretRequired reports whether joining needs a passphrase or PIN
+func (r *Room) SecretRequired() bool {
+	return r.secret != nil
+}
+
+// Locked reports whether the room refuses new joins
+func (r *Room) Locked() bool {
+	return r.locked.Load()
+}
+
+// checkSecret verifies a join attempt's secret in constant time. Each wrong
+// guess counts towards maxSecretAttempts; the last one locks the room.
+func (r *Room) checkSecret(attempt string) error {
+	if r.secret == nil {
+		return nil
+	}
+	if attempt == "" {
+		return ErrSecretRequired
+	}
+
+	if r.secret.Matches(attempt) {
+		return nil
+	}
+
+	if r.failedAttempts.Add(1) >= maxSecretAttempts {
+		r.lock()
+		slog.Warn("Room locked after repeated wrong secrets", "code", r.Code)
+		return ErrRoomLocked
+	}
+	return ErrWrongSecret
+}
+
+// lock stops the room from accepting new peers, persisting the lock
+func (r *Room) lock() {
+	if r.locked.CompareAndSwap(false, true) {
+		if err := rooms().Save(r); err != nil {
+			slog.Error("Failed to save room", "code", r.Code, "error", err)
+		}
+	}
+}
@@ -1,17 +1,132 @@
 package room
 
-import "sync"
+import (
+	"frop/internal/events"
+	"sync"
+	"time"
+)
 
-var roomStore sync.Map // map[string]*Room
+// Store holds rooms by code. Implementations must be safe for concurrent use.
+//
+// Peers are live connections and are never persisted: a store only needs to
+// keep the *Room it was given and, if durable, the room's metadata.
+type Store interface {
+	Load(code string) (*Room, bool)
+	// Add stores a new room, failing with ErrCodeTaken if the code is in use
+	Add(room *Room) error
+	Save(room *Room) error
+	Delete(code string) error
+	Range(fn func(room *Room) bool)
+}
+
+var (
+	storeMu   sync.RWMutex
+	roomStore Store = NewMemoryStore()
+)
+
+// SetStore replaces the backing store. Call it before serving requests.
+func SetStore(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	roomStore = s
+}
+
+// rooms returns the backing store. Handlers of connections that are still
+// closing look rooms up while a test or a restart swaps the store.
+func rooms() Store {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return roomStore
+}
+
+// MemoryStore keeps rooms in process memory only
+type MemoryStore struct {
+	rooms sync.Map // map[string]*Room
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (m *MemoryStore) Load(code string) (*Room, bool) {
+	v, exists := m.rooms.Load(code)
+	if !exists {
+		return nil, false
+	}
+	return v.(*Room), true
+}
+
+func (m *MemoryStore) Add(room *Room) error {
+	if _, loaded := m.rooms.LoadOrStore(room.Code, room); loaded {
+		return ErrCodeTaken
+	}
+	return nil
+}
+
+func (m *MemoryStore) Save(room *Room) error {
+	m.rooms.Store(room.Code, room)
+	return nil
+}
+
+func (m *MemoryStore) Delete(code string) error {
+	m.rooms.Delete(code)
+	return nil
+}
+
+func (m *MemoryStore) Range(fn func(room *Room) bool) {
+	m.rooms.Range(func(_, v any) bool {
+		return fn(v.(*Room))
+	})
+}
+
+// deleteRoom removes the room and tells its watchers why
+func deleteRoom(code, reason string) {
+	rooms().Delete(code)
+	events.Publish(events.Event{Type: events.Closed, Code: code, Reason: reason})
+}
 
-func deleteRoom(code string) {
-	roomStore.Delete(code)
+// Normalize returns the canonical form of a typed room code
+func Normalize(code string) string {
+	return generator.Normalize(code)
+}
+
+// loadRoom is the single lookup path for rooms: every entry point goes
+// through it so an expired room is evicted no matter who touches it first.
+func loadRoom(code string, now time.Time) (*Room, error) {
+	code = generator.Normalize(code)
+	if err := generator.Validate(code); err != nil {
+		return nil, ErrInvalidCode
+	}
+
+	room, exists := rooms().Load(code)
+	if !exists {
+		return nil, ErrRoomNotFound
+	}
+	if room.Expired(now) {
+		deleteRoom(code, "expired")
+		return nil, ErrRoomExpired
+	}
+	return room, nil
+}
+
+// Sweep evicts every room that has expired at now and returns them, so the
+// caller can deal with any peers still waiting in them.
+func Sweep(now time.Time) []*Room {
+	var expired []*Room
+	rooms().Range(func(r *Room) bool {
+		if r.Expired(now) {
+			deleteRoom(r.Code, "expired")
+			expired = append(expired, r)
+		}
+		return true
+	})
+	return expired
 }
 
 // Reset clears the store (used for testing)
 func Reset() {
-	roomStore.Range(func(key, _ any) bool {
-		roomStore.Delete(key)
+	rooms().Range(func(r *Room) bool {
+		rooms().Delete(r.Code)
 		return true
 	})
 }
@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"frop/internal/device"
+	"frop/models"
+)
+
+// handleListDevices lists the devices the caller trusts. The caller proves
+// which device it is with its credential as a bearer token.
+func handleListDevices(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	d, err := authenticateDevice(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	res := &models.DevicesResponse{ID: d.ID, Name: d.Name(), Trusted: []*models.Device{}}
+	for _, t := range d.Trusted() {
+		lastSeen := t.LastSeen
+		res.Trusted = append(res.Trusted, &models.Device{ID: t.ID, Name: t.Name, Since: t.Since, LastSeen: &lastSeen})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleRevokeDevice ends the caller's pairing with a device, for both sides
+func handleRevokeDevice(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	d, err := authenticateDevice(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := device.Revoke(d, r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func authenticateDevice(r *http.Request) (*device.Device, error) {
+	return device.Authenticate(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), time.Now())
+}
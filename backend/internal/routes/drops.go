@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"frop/internal/drop"
+	"frop/internal/ratelimit"
+	"frop/models"
+)
+
+// handleClaimDrop reserves a name, or renews the caller's own reservation
+func handleClaimDrop(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if wait, err := ratelimit.Create.Allow(time.Now(), ratelimit.ClientIP(r)); err != nil {
+		writeRateLimited(w, wait, err)
+		return
+	}
+	if err := drop.Authorize(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req models.ClaimDropRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorStatus(w, http.StatusBadRequest, err)
+		return
+	}
+
+	d, err := drop.Claim(req.Name, req.Secret, time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, dropStatus(d))
+}
+
+func handleGetDrop(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	d, err := drop.Get(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, dropStatus(d))
+}
+
+// handleReleaseDrop gives a name up; the body carries the claim secret
+func handleReleaseDrop(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	// Only wrong secrets count, as with listening
+	now := time.Now()
+	if wait, err := ratelimit.Join.Check(now, ratelimit.ClientIP(r)); err != nil {
+		writeRateLimited(w, wait, err)
+		return
+	}
+
+	var req models.ClaimDropRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorStatus(w, http.StatusBadRequest, err)
+		return
+	}
+	err := drop.Release(r.PathValue("name"), req.Secret)
+	if errors.Is(err, drop.ErrWrongSecret) {
+		ratelimit.Join.Charge(now, ratelimit.ClientIP(r))
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func dropStatus(d *drop.Drop) *models.DropResponse {
+	return &models.DropResponse{
+		Name:      d.Name,
+		Online:    d.Owner() != nil,
+		ExpiresAt: d.ExpiresAt(),
+	}
+}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"frop/internal/events"
+	"frop/internal/room"
+)
+
+// heartbeat keeps idle event streams from being cut by proxies
+const heartbeat = 15 * time.Second
+
+// handleRoomEvents streams the room's lifecycle as Server-Sent Events. The
+// first event is the room's current status; the stream ends after a
+// "closed" event or when the client goes away.
+func handleRoomEvents(w http.ResponseWriter, req *http.Request) {
+	r, err := room.GetRoom(req.PathValue("code"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeErrorStatus(w, http.StatusInternalServerError, errNoStreaming)
+		return
+	}
+
+	// Subscribe before reading the status, so nothing falls in between
+	ch, cancel := events.Subscribe(r.Code)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	writeEvent(w, "status", roomStatus(r))
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case e, open := <-ch:
+			if !open {
+				return
+			}
+			writeEvent(w, string(e.Type), e)
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, name string, v any) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"frop/internal/qr"
+	"frop/internal/room"
+)
+
+// qrScale is the PNG size of one QR module, in pixels
+const qrScale = 8
+
+var errBadFormat = errors.New("format must be png or svg")
+
+// publicURL is the externally visible base URL join links point at. Empty
+// derives it from each request.
+var publicURL string
+
+// SetPublicURL sets the base URL used in join links, e.g.
+// "https://frop.example". Call it before serving requests.
+func SetPublicURL(u string) {
+	publicURL = strings.TrimSuffix(u, "/")
+}
+
+// joinURL returns the short link that opens the frontend on room code
+func joinURL(req *http.Request, code string) string {
+	base := publicURL
+	if base == "" {
+		scheme := "http"
+		if req.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + req.Host
+	}
+	return base + "/j/" + url.PathEscape(code)
+}
+
+// handleRoomQR renders the room's join link as a QR code, PNG by default
+// or SVG with ?format=svg
+func handleRoomQR(w http.ResponseWriter, req *http.Request) {
+	r, err := room.GetRoom(req.PathValue("code"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	code, err := qr.Encode([]byte(joinURL(req, r.Code)))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	switch req.URL.Query().Get("format") {
+	case "", "png":
+		img, err := code.PNG(qrScale)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(img)
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write(code.SVG())
+	default:
+		writeErrorStatus(w, http.StatusBadRequest, errBadFormat)
+	}
+}
+
+// handleJoinLink sends a scanned or shared link to the frontend with the
+// room code filled in. The room is not checked here, so the frontend shows
+// the same error a typed code would get.
+func handleJoinLink(w http.ResponseWriter, req *http.Request) {
+	code := room.Normalize(req.PathValue("code"))
+	http.Redirect(w, req, "/?c="+url.QueryEscape(code), http.StatusFound)
+}
@@ -2,9 +2,19 @@ package routes
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
+	"frop/internal/device"
+	"frop/internal/drop"
+	"frop/internal/ratelimit"
 	"frop/internal/room"
+	"frop/internal/session"
 	"frop/internal/ws"
 	"frop/models"
 )
@@ -14,35 +24,148 @@ func Setup(mux *http.ServeMux) {
 	mux.HandleFunc("/ws", ws.ServeHttp)
 	mux.HandleFunc("GET /api/room/{code}", handleGetRoom)
 	mux.HandleFunc("POST /api/room", handleCreateRoom)
+	mux.HandleFunc("GET /api/room/{code}/qr", handleRoomQR)
+	mux.HandleFunc("GET /api/room/{code}/events", handleRoomEvents)
+	mux.HandleFunc("DELETE /api/session/{token}", handleEndSession)
+	mux.HandleFunc("POST /api/drop", handleClaimDrop)
+	mux.HandleFunc("GET /api/drop/{name}", handleGetDrop)
+	mux.HandleFunc("DELETE /api/drop/{name}", handleReleaseDrop)
+	mux.HandleFunc("GET /api/devices", handleListDevices)
+	mux.HandleFunc("DELETE /api/devices/{id}", handleRevokeDevice)
+	mux.HandleFunc("/api/", handleUnknown)
+	mux.HandleFunc("GET /j/{code}", handleJoinLink)
+}
+
+// handleUnknown answers any other /api/* path in the shared error model
+// rather than the mux's plain-text 404
+func handleUnknown(w http.ResponseWriter, _ *http.Request) {
+	writeErrorStatus(w, http.StatusNotFound, errNotFound)
 }
 
 func handleGetRoom(w http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 
-	code := req.PathValue("code")
-	r, err := room.GetRoom(code)
-	w.Header().Set("Content-Type", "application/json")
-
-	var res *models.RoomResponse
+	r, err := room.GetRoom(req.PathValue("code"))
 	if err != nil {
-		res = &models.RoomResponse{
-			Error: err.Error(),
-		}
-	} else {
-		res = &models.RoomResponse{
-			Code: r.Code,
-		}
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, roomStatus(r))
+}
+
+func roomStatus(r *room.Room) *models.RoomStatusResponse {
+	peers := len(r.Peers())
+	return &models.RoomStatusResponse{
+		Code:           r.Code,
+		Exists:         true,
+		PeerCount:      peers,
+		Capacity:       r.Capacity,
+		IsFull:         peers >= r.Capacity,
+		SecretRequired: r.SecretRequired(),
+		ExpiresAt:      r.ExpiresAt(),
 	}
-	json.NewEncoder(w).Encode(res)
 }
 
 func handleCreateRoom(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	code := room.CreateRoom()
-	w.Header().Set("Content-Type", "application/json")
-	resp := models.RoomResponse{
-		Code: code,
+	if wait, err := ratelimit.Create.Allow(time.Now(), ratelimit.ClientIP(r)); err != nil {
+		writeRateLimited(w, wait, err)
+		return
+	}
+
+	// The body is optional: no body means a default two-peer room
+	var req models.CreateRoomRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeErrorStatus(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ttl, err := room.TTLFromSeconds(req.TTL)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	created, err := room.CreateRoomWithOptions(room.Options{
+		Capacity: req.Capacity,
+		Secret:   req.Secret,
+		TTL:      ttl,
+	})
+	if err != nil {
+		writeError(w, err)
+		return
 	}
-	json.NewEncoder(w).Encode(&resp)
+
+	expiresAt := created.ExpiresAt()
+	writeJSON(w, http.StatusOK, &models.RoomResponse{
+		Code:           created.Code,
+		Capacity:       created.Capacity,
+		SecretRequired: created.SecretRequired(),
+		ExpiresAt:      &expiresAt,
+	})
+}
+
+var (
+	errNotFound    = errors.New("not found")
+	errNoStreaming = errors.New("streaming unsupported")
+)
+
+// statusFor maps a domain error to the HTTP status it is reported with
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, room.ErrRoomNotFound),
+		errors.Is(err, drop.ErrDropNotFound),
+		errors.Is(err, device.ErrNotTrusted),
+		errors.Is(err, session.ErrSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, room.ErrRoomExpired),
+		errors.Is(err, session.ErrSessionExpired),
+		errors.Is(err, session.ErrSessionEnded):
+		return http.StatusGone
+	case errors.Is(err, room.ErrInvalidCode),
+		errors.Is(err, room.ErrInvalidCapacity),
+		errors.Is(err, room.ErrInvalidTTL),
+		errors.Is(err, drop.ErrInvalidName),
+		errors.Is(err, drop.ErrSecretRequired):
+		return http.StatusBadRequest
+	case errors.Is(err, drop.ErrUnauthorized),
+		errors.Is(err, device.ErrBadCredential):
+		return http.StatusUnauthorized
+	case errors.Is(err, drop.ErrWrongSecret),
+		errors.Is(err, session.ErrStaleCredential):
+		return http.StatusForbidden
+	case errors.Is(err, drop.ErrNameTaken):
+		return http.StatusConflict
+	case errors.Is(err, room.ErrNoCodeAvailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, ratelimit.ErrRateLimited),
+		errors.Is(err, ratelimit.ErrBanned):
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	writeErrorStatus(w, statusFor(err), err)
+}
+
+// writeRateLimited refuses a rate limited request, saying when to retry
+func writeRateLimited(w http.ResponseWriter, wait time.Duration, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeError(w, err)
+}
+
+// writeErrorStatus writes the error model every /api/* failure shares
+func writeErrorStatus(w http.ResponseWriter, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		slog.Error("API request failed", "status", status, "error", err)
+	}
+	writeJSON(w, status, &models.ErrorResponse{Error: err.Error(), Status: status})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"frop/internal/ratelimit"
+	"frop/internal/room"
+	"frop/internal/session"
+	"frop/internal/ws"
+)
+
+// handleEndSession ends the session a token belongs to, as a "leave" from
+// its peer would. It works without a WebSocket, e.g. from a page being
+// closed.
+func handleEndSession(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	// Only bad tokens count, as with reconnects
+	now := time.Now()
+	if wait, err := ratelimit.Reconnect.Check(now, ratelimit.ClientIP(r)); err != nil {
+		writeRateLimited(w, wait, err)
+		return
+	}
+
+	s, slot, err := session.Resume(r.PathValue("token"))
+	if err != nil {
+		ratelimit.Reconnect.Charge(now, ratelimit.ClientIP(r))
+		writeError(w, err)
+		return
+	}
+	ws.EndSession(s, room.PeerID(slot))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"frop/internal/room"
+	"frop/models"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every peer reconnects with its own credential, bound to its slot. A slot
+// has a generation that moves on each time the slot changes hands, whether
+// a peer joins, reconnects or is kicked, so the credential issued before
+// stops working. Presenting one of those stale credentials is how a leaked
+// token shows itself, and the session's peers are told.
+//
+// Unless tokens are signed, a credential is "<session>.<slot>.<generation>.<mac>",
+// the MAC keyed by a secret only the session knows.
+
+// newSeed returns the random secret unsigned credentials are derived from
+func newSeed() []byte {
+	seed := make([]byte, 32)
+	rand.Read(seed)
+	return seed
+}
+
+// credential returns the token peer presents to reconnect
+func (s *Session) credential(peer *room.Peer, now time.Time) string {
+	gen := s.gens[peer.Slot].Load()
+	if keyring != nil {
+		return s.signedCredential(peer.Slot, gen, now)
+	}
+	return s.token + "." + strconv.Itoa(peer.Slot) + "." + strconv.FormatInt(gen, 10) + "." + s.mac(peer.Slot, gen)
+}
+
+func (s *Session) mac(slot int, gen int64) string {
+	h := hmac.New(sha256.New, s.seed)
+	h.Write([]byte(s.token + "." + strconv.Itoa(slot) + "." + strconv.FormatInt(gen, 10)))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16])
+}
+
+// parseCredential splits an unsigned credential into its session key, slot
+// and generation, leaving the MAC for checkMAC
+func parseCredential(tok string) (key string, slot int, gen int64, mac string, err error) {
+	parts := strings.Split(tok, ".")
+	if len(parts) != 4 {
+		return "", 0, 0, "", ErrSessionNotFound
+	}
+	slot, err1 := strconv.Atoi(parts[1])
+	gen, err2 := strconv.ParseInt(parts[2], 10, 64)
+	if err1 != nil || err2 != nil {
+		return "", 0, 0, "", ErrSessionNotFound
+	}
+	return parts[0], slot, gen, parts[3], nil
+}
+
+// checkCredential accepts a credential for slot issued at generation gen,
+// the current one or, for a session rebuilt from a signed token, a later
+// one. An earlier generation is reported as reuse.
+func (s *Session) checkCredential(slot int, gen int64) error {
+	if slot < 0 || slot >= len(s.slots) {
+		return ErrSessionNotFound
+	}
+	for {
+		current := s.gens[slot].Load()
+		if gen < current {
+			s.reportReuse(slot)
+			return ErrStaleCredential
+		}
+		if gen == current || s.gens[slot].CompareAndSwap(current, gen) {
+			return nil
+		}
+	}
+}
+
+// advance moves slot on to a new generation, retiring the credential
+// issued for it so far
+func (s *Session) advance(slot int) {
+	s.gens[slot].Add(1)
+	saveSession(s)
+}
+
+// reportReuse tells every attached peer that slot's old credential was
+// presented. If the slot's own peer is away it hears on its return.
+func (s *Session) reportReuse(slot int) {
+	id := room.PeerID(slot)
+	slog.Warn("Stale session credential presented", "code", s.Code, "peer", id)
+
+	if s.slots[slot].Load() == nil {
+		s.reused[slot].Store(true)
+	}
+	for _, peer := range s.Peers() {
+		peer.SendResponse(&models.WsResponse{Type: models.CredentialReused, PeerID: id})
+	}
+}
@@ -5,5 +5,11 @@ import "errors"
 var (
 	ErrSessionNotFound  = errors.New("session not found")
 	ErrSessionExpired   = errors.New("session expired")
+	ErrSessionEnded     = errors.New("session ended")
 	ErrPeerDisconnected = errors.New("peer disconnected")
+	ErrPeerReconnecting = errors.New("peer reconnecting")
+	ErrPeerNotFound     = errors.New("peer not found")
+	ErrAlreadyInSession = errors.New("already in a session")
+	ErrSlotTaken        = errors.New("peer already connected")
+	ErrStaleCredential  = errors.New("stale session credential")
 )
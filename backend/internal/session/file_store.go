@@ -0,0 +1,117 @@
+package session
+
+import (
+	"frop/internal/room"
+	"frop/internal/store"
+	"time"
+)
+
+// record is the persisted form of a Session
+type record struct {
+	Token     string        `json:"token"`
+	Code      string        `json:"code"`
+	Capacity  int           `json:"capacity"`
+	CreatedAt time.Time     `json:"createdAt"`
+	LastSeen  time.Time     `json:"lastSeen"`
+	TTL       time.Duration `json:"ttl,omitempty"`
+	Seed      []byte        `json:"seed,omitempty"`
+	Gens      []int64       `json:"gens,omitempty"`  // credential generation per slot
+	Ended     *time.Time    `json:"ended,omitempty"` // set on a session that has ended: when to forget it
+}
+
+// FileStore keeps live sessions in memory and writes their metadata through
+// to an append-only log, so session tokens stay valid across a restart.
+// Restored sessions have no peers attached; peers come back via Reconnect.
+// A restored session is not linked to its room again, so new joiners of the
+// room code start a fresh session. An ended session is logged in its place
+// until it is forgotten.
+type FileStore struct {
+	*MemoryStore
+	log *store.File[record]
+}
+
+// OpenFileStore opens the log at path and restores the sessions recorded in it
+func OpenFileStore(path string) (*FileStore, error) {
+	log, err := store.OpenFile[record](path)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		log:         log,
+	}
+	log.Range(func(_ string, rec record) bool {
+		if rec.Ended != nil {
+			fs.MemoryStore.End(rec.Token, *rec.Ended)
+			return true
+		}
+		fs.MemoryStore.Save(rec.session())
+		return true
+	})
+	return fs, nil
+}
+
+func (fs *FileStore) Save(s *Session) error {
+	fs.MemoryStore.Save(s)
+	return fs.log.Put(s.Token(), s.record())
+}
+
+func (fs *FileStore) Delete(token string) error {
+	fs.MemoryStore.Delete(token)
+	return fs.log.Delete(token)
+}
+
+func (fs *FileStore) End(token string, until time.Time) error {
+	fs.MemoryStore.End(token, until)
+	return fs.log.Put(token, record{Token: token, Ended: &until})
+}
+
+func (fs *FileStore) Forget(token string) error {
+	fs.MemoryStore.Forget(token)
+	return fs.log.Delete(token)
+}
+
+func (fs *FileStore) Close() error {
+	return fs.log.Close()
+}
+
+func (s *Session) record() record {
+	gens := make([]int64, len(s.gens))
+	for i := range s.gens {
+		gens[i] = s.gens[i].Load()
+	}
+	return record{
+		Token:     s.Token(),
+		Code:      s.Code,
+		Capacity:  len(s.slots),
+		CreatedAt: s.CreatedAt,
+		LastSeen:  s.LastSeen(),
+		TTL:       s.TTL(),
+		Seed:      s.seed,
+		Gens:      gens,
+	}
+}
+
+func (rec record) session() *Session {
+	capacity := rec.Capacity
+	if capacity == 0 {
+		capacity = room.DefaultCapacity
+	}
+	s := newSession(rec.Token, rec.Code, capacity, rec.CreatedAt)
+	s.lastSeen.Store(rec.LastSeen.UnixNano())
+	if rec.TTL > 0 {
+		s.ttl.Store(int64(rec.TTL))
+	}
+	// Logs written before per-peer credentials keep the fresh seed: their
+	// sessions' tokens were never credentials and cannot be resumed
+	if rec.Seed != nil {
+		s.seed = rec.Seed
+	}
+	for i, gen := range rec.Gens {
+		if i < len(s.gens) {
+			s.gens[i].Store(gen)
+		}
+	}
+	return s
+}
@@ -0,0 +1,130 @@
+package session
+
+import (
+	"frop/internal/events"
+	"frop/internal/room"
+	"frop/models"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// grace is how long a dropped peer's slot is held for it before the others
+// are told it has gone. 0 tells them at once.
+var grace time.Duration
+
+// SetGrace changes the window a dropped peer has to reconnect, such as the
+// few seconds a page refresh takes
+func SetGrace(d time.Duration) {
+	grace = d
+}
+
+// maxHeld bounds the messages queued for one reconnecting peer
+const maxHeld = 32
+
+// away is a dropped peer within its grace window, and the messages held for
+// it until it is back
+type away struct {
+	timer *time.Timer
+	mu    sync.Mutex
+	held  []*models.WsRequest
+}
+
+func (a *away) hold(req *models.WsRequest) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.held) >= maxHeld {
+		return false
+	}
+	a.held = append(a.held, req)
+	return true
+}
+
+func (a *away) take() []*models.WsRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	held := a.held
+	a.held = nil
+	return held
+}
+
+// holdSlot keeps slot's peer in the session for the grace window; the
+// others see it as reconnecting until it returns or the window closes
+func (s *Session) holdSlot(slot int) {
+	a := &away{}
+	a.timer = time.AfterFunc(grace, func() {
+		if !s.away[slot].CompareAndSwap(a, nil) {
+			return
+		}
+		if _, exists := sessions().Load(s.token); exists {
+			s.departed(slot)
+		}
+	})
+	if old := s.away[slot].Swap(a); old != nil {
+		old.timer.Stop()
+	}
+
+	id := room.PeerID(slot)
+	slog.Info("Peer dropped, holding its slot", "peer", id, "grace", grace)
+	s.broadcast(nil, &models.WsResponse{Type: models.PeerReconnecting, PeerID: id, Peers: s.Roster()})
+}
+
+// returned ends slot's grace window and hands back what was held for it
+func (s *Session) returned(slot int) []*models.WsRequest {
+	a := s.away[slot].Swap(nil)
+	if a == nil {
+		return nil
+	}
+	a.timer.Stop()
+	return a.take()
+}
+
+// departed tells everyone left that slot's peer is gone
+func (s *Session) departed(slot int) {
+	id := room.PeerID(slot)
+	slog.Info("Peer disconnected from the session", "peer", id)
+	s.publish(events.PeerLeft, id, "disconnected")
+	s.broadcast(nil, &models.WsResponse{
+		Type:   models.PeerDisconnected,
+		PeerID: id,
+		Peers:  s.Roster(),
+	})
+}
+
+// reconnecting reports whether the peer with the given ID is within its
+// grace window, or, for an empty id, whether any peer is
+func (s *Session) reconnecting(id string) bool {
+	for i := range s.away {
+		if s.away[i].Load() != nil && (id == "" || id == room.PeerID(i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hold queues req for the reconnecting peers it is addressed to, all of
+// them when req.To is empty, and returns how many will get it on return
+func (s *Session) Hold(req *models.WsRequest) int {
+	n := 0
+	for i := range s.away {
+		a := s.away[i].Load()
+		if a == nil || (req.To != "" && req.To != room.PeerID(i)) {
+			continue
+		}
+		if a.hold(req) {
+			n++
+		}
+	}
+	return n
+}
+
+// Hold queues req from conn for reconnecting peers of conn's session
+func Hold(conn *websocket.Conn, req *models.WsRequest) int {
+	s, err := LookupSessionForConn(conn)
+	if err != nil {
+		return 0
+	}
+	return s.Hold(req)
+}
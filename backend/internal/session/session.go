@@ -1,10 +1,11 @@
 package session
 
 import (
-	"fmt"
+	"frop/internal/events"
 	"frop/internal/room"
 	"frop/models"
 	"log/slog"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -12,116 +13,299 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-// Session is created when two peers join a room
+// Session is created when the second peer joins a room. It has one slot per
+// room slot, so a peer keeps the same ID in both.
 type Session struct {
-	Token     string
-	peerA     atomic.Pointer[room.Peer]
-	peerB     atomic.Pointer[room.Peer]
+	token     string                      // key in the session store
+	Code      string                      // room the session was created from
+	slots     []atomic.Pointer[room.Peer] // nil while that peer is away
+	gens      []atomic.Int64              // per slot, see credential.go
+	reused    []atomic.Bool               // per slot, stale credential seen while away
+	away      []atomic.Pointer[away]      // per slot, set during a dropped peer's grace window
+	seed      []byte                      // secret unsigned credentials are derived from
 	CreatedAt time.Time
 	lastSeen  atomic.Int64 // unix nanoseconds
+	ttl       atomic.Int64 // idle lifetime, as a time.Duration
+	warnedFor atomic.Int64 // expiry, in unix nanoseconds, peers were last warned about
 }
 
-func NewSession(peers []*room.Peer) *Session {
-	token := uuid.NewString()
-	now := time.Now()
+// joinMu serializes session creation so two peers completing a room at the
+// same moment cannot both create one
+var joinMu sync.Mutex
+
+func newSession(token, code string, capacity int, createdAt time.Time) *Session {
 	s := &Session{
-		Token:     token,
-		CreatedAt: now,
+		token:     token,
+		Code:      code,
+		slots:     make([]atomic.Pointer[room.Peer], capacity),
+		gens:      make([]atomic.Int64, capacity),
+		reused:    make([]atomic.Bool, capacity),
+		away:      make([]atomic.Pointer[away], capacity),
+		seed:      newSeed(),
+		CreatedAt: createdAt,
 	}
-	s.peerA.Store(peers[0])
-	s.peerB.Store(peers[1])
-	s.lastSeen.Store(now.UnixNano())
-
-	sessionsByToken.Store(token, s)
-	registerConn(peers[0].Conn, s)
-	registerConn(peers[1].Conn, s)
+	s.lastSeen.Store(createdAt.UnixNano())
+	s.ttl.Store(int64(lifespan))
 	return s
 }
 
-func (s *Session) GetPeer(conn *websocket.Conn) (*room.Peer, bool) {
-	peerA := s.peerA.Load()
-	peerB := s.peerB.Load()
+// Token is the session's key in the store. It is not a credential: peers
+// reconnect with their own, see credential.go.
+func (s *Session) Token() string {
+	return s.token
+}
+
+// Join attaches peer, which has just taken a slot in room code, to that
+// room's session. The first time a room holds two peers the session is
+// created from members and everyone gets "connected"; later joiners get
+// "connected" themselves while existing members get a "roster" update.
+func Join(code string, peer *room.Peer, members []*room.Peer) error {
+	r, err := room.GetRoom(code)
+	if err != nil {
+		return err
+	}
+
+	code = r.Code // canonical form of what the peer typed
+
+	joinMu.Lock()
+	if v, exists := sessionsByRoom.Load(code); exists {
+		joinMu.Unlock()
+		s := v.(*Session)
+		s.attach(peer)
+		saveSession(s)
+		peer.SendResponse(s.connectedResponse(peer))
+		s.broadcast(peer.Conn, &models.WsResponse{Type: models.Roster, Peers: s.Roster()})
+		return nil
+	}
+
+	s := newSession(uuid.NewString(), code, r.Capacity, time.Now())
+	if r.TTL > 0 {
+		// the creator asked for a lifetime, let the session have it too
+		s.ttl.Store(int64(r.TTL))
+	}
+	for _, member := range members {
+		s.attach(member)
+	}
+	sessionsByRoom.Store(code, s)
+	joinMu.Unlock()
+
+	saveSession(s)
+	s.publish(events.Paired, "", "")
+	s.Notify()
+	return nil
+}
+
+// publish tells the room's watchers about a change to the session
+func (s *Session) publish(t events.Type, peerID, reason string) {
+	events.Publish(events.Event{Type: t, Code: s.Code, PeerID: peerID, Peers: s.Roster(), Reason: reason})
+}
+
+// attach puts peer into its slot, under a new generation since the slot
+// changes hands, and indexes its connection
+func (s *Session) attach(peer *room.Peer) {
+	s.gens[peer.Slot].Add(1)
+	s.reused[peer.Slot].Store(false)
+	s.slots[peer.Slot].Store(peer)
+	registerConn(peer.Conn, s)
+}
 
-	if peerA != nil && peerA.Is(conn) {
-		if peerB != nil {
-			return peerB, true
+// Peer returns the attached peer with the given ID
+func (s *Session) Peer(id string) (*room.Peer, bool) {
+	for i := range s.slots {
+		if peer := s.slots[i].Load(); peer != nil && peer.ID() == id {
+			return peer, true
 		}
-		return nil, false
 	}
+	return nil, false
+}
 
-	if peerB != nil && peerB.Is(conn) {
-		if peerA != nil {
-			return peerA, true
+// Recipients returns who a message from conn should go to: the peer named
+// by to, or every other attached peer when to is empty.
+func (s *Session) Recipients(conn *websocket.Conn, to string) ([]*room.Peer, error) {
+	if to != "" {
+		peer, exists := s.Peer(to)
+		if !exists && s.reconnecting(to) {
+			return nil, ErrPeerReconnecting
+		}
+		if !exists || peer.Is(conn) {
+			return nil, ErrPeerNotFound
 		}
-		return nil, false
+		return []*room.Peer{peer}, nil
 	}
 
-	return nil, false
+	var others []*room.Peer
+	for _, peer := range s.Peers() {
+		if !peer.Is(conn) {
+			others = append(others, peer)
+		}
+	}
+	if len(others) == 0 {
+		if s.reconnecting("") {
+			return nil, ErrPeerReconnecting
+		}
+		return nil, ErrPeerDisconnected
+	}
+	return others, nil
 }
 
-func (s *Session) Notify() {
-	peerA := s.peerA.Load()
-	peerB := s.peerB.Load()
+// Peers returns the peers currently attached to the session, in slot order
+func (s *Session) Peers() []*room.Peer {
+	var peers []*room.Peer
+	for i := range s.slots {
+		if peer := s.slots[i].Load(); peer != nil {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
 
-	res := connectedResponse(s.Token)
-	if peerA != nil {
-		peerA.SendResponse(res)
+// Roster returns the IDs of the attached peers
+func (s *Session) Roster() []string {
+	var ids []string
+	for _, peer := range s.Peers() {
+		ids = append(ids, peer.ID())
 	}
-	if peerB != nil {
-		peerB.SendResponse(res)
+	return ids
+}
+
+// Creator returns the peer in the first slot, the one that created the room
+func (s *Session) Creator() *room.Peer {
+	return s.slots[0].Load()
+}
+
+// Kick removes the peer with the given ID and retires its credential, so
+// the kicked peer cannot come back with the token it was given. Everyone
+// left gets "connected" with the new roster.
+func (s *Session) Kick(id string) (*room.Peer, error) {
+	peer, exists := s.Peer(id)
+	if !exists {
+		return nil, ErrPeerNotFound
+	}
+	if !s.slots[peer.Slot].CompareAndSwap(peer, nil) {
+		return nil, ErrPeerNotFound
 	}
+	unregisterConn(peer.Conn)
+
+	s.advance(peer.Slot)
+	slog.Info("Peer kicked from the session", "peer", id)
+	s.publish(events.PeerLeft, id, "kicked")
+	s.Notify()
+	return peer, nil
 }
 
-func (s *Session) Reconnect(peer *room.Peer) error {
-	// Try to claim an empty slot using CAS
-	if s.peerA.CompareAndSwap(nil, peer) {
-		registerConn(peer.Conn, s)
-		s.Notify()
-		return nil
+// Close ends the session at once and returns the peers that were attached,
+// so the caller can disconnect them
+func (s *Session) Close() []*room.Peer {
+	peers := s.Peers()
+	deleteSession(s.Token())
+	slog.Info("Session closed", "code", s.Code)
+	return peers
+}
+
+// End closes the session for good, as when a peer leaves: its credentials,
+// signed ones included, are refused from now on
+func (s *Session) End() []*room.Peer {
+	peers := s.Close()
+	retire(s.token, time.Now())
+	return peers
+}
+
+// Notify sends "connected", with the current roster, to every attached peer
+func (s *Session) Notify() {
+	for _, peer := range s.Peers() {
+		peer.SendResponse(s.connectedResponse(peer))
 	}
-	if s.peerB.CompareAndSwap(nil, peer) {
-		registerConn(peer.Conn, s)
-		s.Notify()
-		return nil
+}
+
+// broadcast sends res to every attached peer except the one on conn
+func (s *Session) broadcast(conn *websocket.Conn, res *models.WsResponse) {
+	for _, peer := range s.Peers() {
+		if !peer.Is(conn) {
+			peer.SendResponse(res)
+		}
 	}
-	return fmt.Errorf("Both peers already connected")
+}
+
+// Reconnect puts peer back into slot, the one its credential was issued
+// for, and issues it a new credential
+func (s *Session) Reconnect(peer *room.Peer, slot int) error {
+	if HasConn(peer.Conn) {
+		return ErrAlreadyInSession
+	}
+	if slot < 0 || slot >= len(s.slots) {
+		return ErrSessionNotFound
+	}
+
+	peer.Slot = slot
+	if !s.slots[slot].CompareAndSwap(nil, peer) {
+		return ErrSlotTaken
+	}
+	s.advance(slot)
+	registerConn(peer.Conn, s)
+	held := s.returned(slot)
+	s.publish(events.PeerJoined, peer.ID(), "reconnected")
+	s.Notify()
+	for _, req := range held {
+		peer.SendRequest(req)
+	}
+
+	if s.reused[slot].CompareAndSwap(true, false) {
+		peer.SendResponse(&models.WsResponse{Type: models.CredentialReused, PeerID: peer.ID()})
+	}
+	return nil
 }
 
 func (s *Session) Disconnect(conn *websocket.Conn) {
 	unregisterConn(conn)
 
-	var peerToNotify *room.Peer
-	var logMsg string
-
-	// Try to clear peerA if it matches
-	peerA := s.peerA.Load()
-	if peerA != nil && peerA.Is(conn) {
-		if s.peerA.CompareAndSwap(peerA, nil) {
-			peerToNotify = s.peerB.Load()
-			logMsg = "PeerA disconnected from the session"
+	for i := range s.slots {
+		peer := s.slots[i].Load()
+		if peer == nil || !peer.Is(conn) {
+			continue
+		}
+		if !s.slots[i].CompareAndSwap(peer, nil) {
+			return
 		}
-	}
 
-	// Try to clear peerB if it matches
-	peerB := s.peerB.Load()
-	if peerB != nil && peerB.Is(conn) {
-		if s.peerB.CompareAndSwap(peerB, nil) {
-			peerToNotify = s.peerA.Load()
-			logMsg = "PeerB disconnected from the session"
+		if grace > 0 {
+			s.holdSlot(i)
+		} else {
+			s.departed(i)
 		}
+		return
 	}
+}
 
-	if peerToNotify != nil {
-		peerToNotify.SendResponse(&models.WsResponse{Type: models.PeerDisconnected})
+// Extend pushes the session's expiry back: it counts as activity and, if
+// ttl is non-zero, replaces the session's idle lifetime (capped like a
+// room's). Every attached peer is told the new expiry, with a new token: a
+// signed one carries the expiry and lifetime it was issued under.
+func (s *Session) Extend(ttl time.Duration, now time.Time) (time.Time, error) {
+	ttl, err := room.ClampTTL(ttl)
+	if err != nil {
+		return time.Time{}, err
 	}
-	if logMsg != "" {
-		slog.Info(logMsg)
+	if ttl > 0 {
+		s.ttl.Store(int64(ttl))
+	}
+	s.lastSeen.Store(now.UnixNano())
+	saveSession(s)
+
+	expiresAt := s.ExpiresAt()
+	slog.Info("Session extended", "code", s.Code, "expiresAt", expiresAt)
+	for _, peer := range s.Peers() {
+		peer.SendResponse(&models.WsResponse{Type: models.Extended, SessionToken: s.credential(peer, now), ExpiresAt: &expiresAt})
 	}
+	return expiresAt, nil
 }
 
-func connectedResponse(token string) *models.WsResponse {
+func (s *Session) connectedResponse(peer *room.Peer) *models.WsResponse {
+	expiresAt := s.ExpiresAt()
 	return &models.WsResponse{
 		Type:         models.Connected,
-		SessionToken: token,
+		SessionToken: s.credential(peer, time.Now()),
+		PeerID:       peer.ID(),
+		Peers:        s.Roster(),
+		ExpiresAt:    &expiresAt,
 	}
 }
@@ -1,7 +1,9 @@
 package session
 
 import (
+	"frop/internal/events"
 	"frop/internal/room"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -10,41 +12,158 @@ import (
 
 const lifespan = 15 * time.Minute
 
+// Store holds sessions by token. Implementations must be safe for concurrent use.
+//
+// Like rooms, only session metadata is durable; the peers attached to a
+// session are live connections and are tracked in sessionsByConn.
+//
+// A store also remembers which sessions have ended, and until when, so that
+// a signed token for one cannot rebuild it after a restart.
+type Store interface {
+	Load(token string) (*Session, bool)
+	Save(s *Session) error
+	Delete(token string) error
+	Range(fn func(s *Session) bool)
+
+	// End records that the session stored under token has ended, until the
+	// given time
+	End(token string, until time.Time) error
+	Ended(token string) bool
+	// Forget drops the record that token's session has ended
+	Forget(token string) error
+	RangeEnded(fn func(token string, until time.Time) bool)
+}
+
 var (
-	sessionsByToken sync.Map // map[string]*Session
-	sessionsByConn  sync.Map // map[*websocket.Conn]*Session
+	storeMu        sync.RWMutex
+	sessionStore   Store    = NewMemoryStore()
+	sessionsByConn sync.Map // map[*websocket.Conn]*Session, always process-local
+	sessionsByRoom sync.Map // map[string]*Session, room code -> session, always process-local
 )
 
+// retire remembers that the session stored under key has ended, for as long
+// as any token issued for it could still be presented, so a signed one
+// cannot rebuild it
+func retire(key string, now time.Time) {
+	if err := sessions().End(key, now.Add(room.MaxTTL())); err != nil {
+		slog.Error("Failed to record ended session", "error", err)
+	}
+}
+
+// retired reports whether the session stored under key has ended
+func retired(key string) bool {
+	return sessions().Ended(key)
+}
+
+// SetStore replaces the backing store. Call it before serving requests.
+func SetStore(s Store) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	sessionStore = s
+}
+
+// sessions returns the backing store, read under storeMu as SetStore writes
+// it
+func sessions() Store {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return sessionStore
+}
+
+// MemoryStore keeps sessions in process memory only
+type MemoryStore struct {
+	sessions sync.Map // map[string]*Session
+	ended    sync.Map // map[string]time.Time, token of an ended session -> when to forget it
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (m *MemoryStore) Load(token string) (*Session, bool) {
+	v, exists := m.sessions.Load(token)
+	if !exists {
+		return nil, false
+	}
+	return v.(*Session), true
+}
+
+func (m *MemoryStore) Save(s *Session) error {
+	m.sessions.Store(s.Token(), s)
+	return nil
+}
+
+func (m *MemoryStore) Delete(token string) error {
+	m.sessions.Delete(token)
+	return nil
+}
+
+func (m *MemoryStore) Range(fn func(s *Session) bool) {
+	m.sessions.Range(func(_, v any) bool {
+		return fn(v.(*Session))
+	})
+}
+
+func (m *MemoryStore) End(token string, until time.Time) error {
+	m.ended.Store(token, until)
+	return nil
+}
+
+func (m *MemoryStore) Ended(token string) bool {
+	_, exists := m.ended.Load(token)
+	return exists
+}
+
+func (m *MemoryStore) Forget(token string) error {
+	m.ended.Delete(token)
+	return nil
+}
+
+func (m *MemoryStore) RangeEnded(fn func(token string, until time.Time) bool) {
+	m.ended.Range(func(k, v any) bool {
+		return fn(k.(string), v.(time.Time))
+	})
+}
+
 func deleteSession(token string) {
-	v, exists := sessionsByToken.Load(token)
+	sess, exists := sessions().Load(token)
 	if !exists {
 		return
 	}
-	sessionsByToken.Delete(token)
+	sessions().Delete(token)
+	sessionsByRoom.CompareAndDelete(sess.Code, sess)
 
-	sess := v.(*Session)
 	// Load peers atomically and clean up conn mappings
-	if peerA := sess.peerA.Load(); peerA != nil {
-		sessionsByConn.Delete(peerA.Conn)
+	for _, peer := range sess.Peers() {
+		sessionsByConn.Delete(peer.Conn)
 	}
-	if peerB := sess.peerB.Load(); peerB != nil {
-		sessionsByConn.Delete(peerB.Conn)
+}
+
+func saveSession(s *Session) {
+	if err := sessions().Save(s); err != nil {
+		slog.Error("Failed to save session", "error", err)
 	}
 }
 
+// GetSession returns the session a reconnect token belongs to
 func GetSession(token string) (*Session, error) {
-	v, exists := sessionsByToken.Load(token)
+	s, _, err := Resume(token)
+	return s, err
+}
+
+// load returns the live session stored under key
+func load(key string) (*Session, error) {
+	s, exists := sessions().Load(key)
 	if !exists {
+		if retired(key) {
+			return nil, ErrSessionEnded
+		}
 		return nil, ErrSessionNotFound
 	}
-	s := v.(*Session)
-
-	lastSeen := time.Unix(0, s.lastSeen.Load())
-	if time.Since(lastSeen) > lifespan {
-		deleteSession(token)
-		return nil, ErrSessionExpired
+	if err := checkExpiry(s, time.Now()); err != nil {
+		return nil, err
 	}
-	s.lastSeen.Store(time.Now().UnixNano())
+	saveSession(s)
 	return s, nil
 }
 
@@ -54,24 +173,77 @@ func LookupSessionForConn(conn *websocket.Conn) (*Session, error) {
 		return nil, ErrSessionNotFound
 	}
 	s := v.(*Session)
-
-	lastSeen := time.Unix(0, s.lastSeen.Load())
-	if time.Since(lastSeen) > lifespan {
-		return nil, ErrSessionExpired
+	if err := checkExpiry(s, time.Now()); err != nil {
+		return nil, err
 	}
 	return s, nil
 }
 
-func GetRemotePeer(conn *websocket.Conn) (*room.Peer, error) {
+// checkExpiry is shared by every lookup path: an expired session is evicted
+// on first touch, a live one has its activity time bumped.
+func checkExpiry(s *Session, now time.Time) error {
+	if s.Expired(now) {
+		s.expire(now)
+		return ErrSessionExpired
+	}
+	s.lastSeen.Store(now.UnixNano())
+	return nil
+}
+
+// expire evicts the session for good and tells the room's watchers it has
+// ended
+func (s *Session) expire(now time.Time) {
+	deleteSession(s.Token())
+	retire(s.token, now)
+	events.Publish(events.Event{Type: events.Closed, Code: s.Code, Reason: "session_expired"})
+}
+
+// Sweep evicts every session that has expired at now, along with its
+// connection mappings, and returns them so the caller can close any peers
+// still attached.
+func Sweep(now time.Time) []*Session {
+	sessions().RangeEnded(func(token string, until time.Time) bool {
+		if now.After(until) {
+			sessions().Forget(token)
+		}
+		return true
+	})
+
+	var expired []*Session
+	sessions().Range(func(s *Session) bool {
+		if s.Expired(now) {
+			s.expire(now)
+			expired = append(expired, s)
+		}
+		return true
+	})
+	return expired
+}
+
+// GetRecipients returns the peers a message from conn should be delivered
+// to. An empty to means every other peer in the session.
+func GetRecipients(conn *websocket.Conn, to string) ([]*room.Peer, error) {
 	s, err := LookupSessionForConn(conn)
 	if err != nil {
 		return nil, err
 	}
-	peer, exists := s.GetPeer(conn)
+	return s.Recipients(conn, to)
+}
+
+// ForRoom returns the live session created from room code
+func ForRoom(code string) (*Session, bool) {
+	v, exists := sessionsByRoom.Load(code)
 	if !exists {
-		return nil, ErrPeerDisconnected
+		return nil, false
 	}
-	return peer, nil
+	return v.(*Session), true
+}
+
+// HasConn reports whether conn is attached to a session, without counting
+// as activity on it
+func HasConn(conn *websocket.Conn) bool {
+	_, exists := sessionsByConn.Load(conn)
+	return exists
 }
 
 func registerConn(conn *websocket.Conn, s *Session) {
@@ -84,14 +256,57 @@ func unregisterConn(conn *websocket.Conn) {
 
 // Reset clears the store (used for testing)
 func Reset() {
-	sessionsByToken.Range(func(key, _ any) bool {
-		sessionsByToken.Delete(key)
+	sessions().Range(func(s *Session) bool {
+		sessions().Delete(s.Token())
 		return true
 	})
 	sessionsByConn.Range(func(key, _ any) bool {
 		sessionsByConn.Delete(key)
 		return true
 	})
+	sessionsByRoom.Range(func(key, _ any) bool {
+		sessionsByRoom.Delete(key)
+		return true
+	})
+	sessions().RangeEnded(func(token string, _ time.Time) bool {
+		sessions().Forget(token)
+		return true
+	})
+}
+
+// ExpiringSoon returns the live sessions that will expire within d of now
+// and whose peers have not yet been warned about that expiry. Activity or
+// an extend moves the expiry, so the same session can be returned again.
+func ExpiringSoon(now time.Time, d time.Duration) []*Session {
+	var expiring []*Session
+	sessions().Range(func(s *Session) bool {
+		expiresAt := s.ExpiresAt()
+		if s.Expired(now) || expiresAt.Sub(now) > d {
+			return true
+		}
+		warned := s.warnedFor.Load()
+		if warned != expiresAt.UnixNano() && s.warnedFor.CompareAndSwap(warned, expiresAt.UnixNano()) {
+			events.Publish(events.Event{Type: events.Expiring, Code: s.Code, ExpiresAt: &expiresAt})
+			expiring = append(expiring, s)
+		}
+		return true
+	})
+	return expiring
+}
+
+// TTL returns how long the session may stay idle before it expires
+func (s *Session) TTL() time.Duration {
+	return time.Duration(s.ttl.Load())
+}
+
+// ExpiresAt returns when the session expires unless there is activity first
+func (s *Session) ExpiresAt() time.Time {
+	return s.LastSeen().Add(s.TTL())
+}
+
+// Expired reports whether the session has been idle longer than its lifetime
+func (s *Session) Expired(now time.Time) bool {
+	return now.After(s.ExpiresAt())
 }
 
 // SetLastSeen is for testing - allows setting lastSeen on a session
@@ -0,0 +1,112 @@
+package session
+
+import (
+	"crypto/hmac"
+	"frop/internal/token"
+	"log/slog"
+	"time"
+)
+
+// keyring signs the tokens peers reconnect with. Without one, a token is
+// the session's random key and only means something to this process's
+// store; with one, each peer gets a signed token naming its session and
+// slot, which any instance sharing the keyring can verify.
+var keyring *token.Keyring
+
+// SetKeyring switches to signed session tokens, or back to random ones with
+// nil. Call it before serving requests.
+func SetKeyring(k *token.Keyring) {
+	keyring = k
+}
+
+// signedCredential returns a signed token for slot at generation gen
+func (s *Session) signedCredential(slot int, gen int64, now time.Time) string {
+	return keyring.Sign(token.Claims{
+		Session:  s.token,
+		Code:     s.Code,
+		Capacity: len(s.slots),
+		Slot:     slot,
+		Gen:      gen,
+		TTL:      s.TTL(),
+		Issued:   now,
+		Expires:  s.ExpiresAt(),
+	})
+}
+
+// Resume returns the session a reconnect token belongs to and the slot it
+// was issued for. A stale token is refused with ErrStaleCredential.
+//
+// A signed token for a session this process does not hold, after a restart
+// or on another instance, rebuilds an empty session from its claims for the
+// peers to come back to. The token's expiry only matters then: a session
+// that is still held expires on its own schedule.
+func Resume(tok string) (*Session, int, error) {
+	if keyring == nil {
+		return resumeUnsigned(tok)
+	}
+
+	claims, err := keyring.Verify(tok)
+	if err != nil {
+		slog.Warn("Rejected session token", "error", err)
+		return nil, 0, ErrSessionNotFound
+	}
+	if claims.Slot < 0 || claims.Slot >= claims.Capacity {
+		return nil, 0, ErrSessionNotFound
+	}
+
+	s, err := load(claims.Session)
+	if err == ErrSessionNotFound {
+		// a session this process does not hold, and did not see end
+		s, err = rebuild(claims, time.Now())
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.checkCredential(claims.Slot, claims.Gen); err != nil {
+		return nil, 0, err
+	}
+	return s, claims.Slot, nil
+}
+
+func resumeUnsigned(tok string) (*Session, int, error) {
+	key, slot, gen, mac, err := parseCredential(tok)
+	if err != nil {
+		return nil, 0, err
+	}
+	s, err := load(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if slot < 0 || slot >= len(s.slots) || !hmac.Equal([]byte(mac), []byte(s.mac(slot, gen))) {
+		return nil, 0, ErrSessionNotFound
+	}
+	if err := s.checkCredential(slot, gen); err != nil {
+		return nil, 0, err
+	}
+	return s, slot, nil
+}
+
+// rebuild recreates the shell of a session from a token's claims. Like a
+// session restored from a file store, it is not linked to its room again.
+func rebuild(claims token.Claims, now time.Time) (*Session, error) {
+	if claims.Expired(now) {
+		return nil, ErrSessionExpired
+	}
+
+	joinMu.Lock()
+	defer joinMu.Unlock()
+
+	// another peer of the same session may have just rebuilt it
+	if s, exists := sessions().Load(claims.Session); exists {
+		return s, nil
+	}
+	s := newSession(claims.Session, claims.Code, claims.Capacity, claims.Issued)
+	s.lastSeen.Store(now.UnixNano())
+	s.gens[claims.Slot].Store(claims.Gen)
+	if claims.TTL > 0 {
+		s.ttl.Store(int64(claims.TTL))
+	}
+	saveSession(s)
+	slog.Info("Rebuilt session from a signed token", "code", s.Code)
+	return s, nil
+}
@@ -0,0 +1,218 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// compactAfter is the number of appended records, beyond the live entries,
+// after which the log is rewritten to drop stale puts and deletes.
+const compactAfter = 1000
+
+// File is a small embedded key/value store backed by an append-only JSON log.
+//
+// Every Put or Delete appends one line to the log, so a crash loses at most
+// the record being written. The log is replayed into memory on open and
+// compacted (rewritten with only the live entries) once it grows too large.
+type File[T any] struct {
+	mu    sync.Mutex
+	path  string
+	f     *os.File
+	items map[string]T
+	stale int // records in the log that no longer describe a live entry
+}
+
+// entry is one line of the log. A nil Value marks a delete.
+type entry[T any] struct {
+	Key   string `json:"k"`
+	Value *T     `json:"v,omitempty"`
+}
+
+// OpenFile opens (or creates) the log at path and replays it into memory.
+func OpenFile[T any](path string) (*File[T], error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &File[T]{
+		path:  path,
+		items: make(map[string]T),
+	}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get returns the value stored under key
+func (s *File[T]) Get(key string) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.items[key]
+	return v, ok
+}
+
+// Put stores v under key and appends it to the log
+func (s *File[T]) Put(key string, v T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.items[key]; exists {
+		s.stale++
+	}
+	s.items[key] = v
+	return s.append(entry[T]{Key: key, Value: &v})
+}
+
+// Delete removes key and appends a tombstone to the log
+func (s *File[T]) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.items[key]; !exists {
+		return nil
+	}
+	delete(s.items, key)
+	s.stale += 2 // the old put and the tombstone itself
+	return s.append(entry[T]{Key: key})
+}
+
+// Range calls fn for a snapshot of all entries until fn returns false.
+// fn may call back into the store.
+func (s *File[T]) Range(fn func(key string, v T) bool) {
+	s.mu.Lock()
+	snapshot := make(map[string]T, len(s.items))
+	for k, v := range s.items {
+		snapshot[k] = v
+	}
+	s.mu.Unlock()
+
+	for k, v := range snapshot {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
+// Len returns the number of live entries
+func (s *File[T]) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+// Close closes the underlying log file
+func (s *File[T]) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func (s *File[T]) append(e entry[T]) error {
+	if s.f == nil {
+		return os.ErrClosed
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if s.stale > compactAfter && s.stale > len(s.items) {
+		return s.compact()
+	}
+	return nil
+}
+
+// replay loads the log into memory. A torn final line (from a crash
+// mid-write) is logged and ignored.
+func (s *File[T]) replay() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var e entry[T]
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			slog.Warn("Ignoring unreadable tail of store log", "path", s.path, "error", err)
+			return nil
+		}
+		if e.Value == nil {
+			delete(s.items, e.Key)
+		} else {
+			s.items[e.Key] = *e.Value
+		}
+	}
+}
+
+// compact rewrites the log with only the live entries and reopens it for
+// appending. The rewrite goes through a temp file so a crash never leaves a
+// half-written log behind.
+func (s *File[T]) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for k, v := range s.items {
+		if err := enc.Encode(entry[T]{Key: k, Value: &v}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if s.f != nil {
+		s.f.Close()
+		s.f = nil
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("replace store log: %w", err)
+	}
+
+	s.f, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	s.stale = 0
+	return nil
+}
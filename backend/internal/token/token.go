@@ -0,0 +1,137 @@
+// Package token issues and verifies self-contained session tokens, signed
+// with HMAC-SHA256 by a keyring so keys can be rotated.
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformed    = errors.New("malformed token")
+	ErrUnknownKey   = errors.New("token signed with an unknown key")
+	ErrBadSignature = errors.New("bad token signature")
+	ErrInvalidKey   = errors.New("invalid token key")
+)
+
+// minKeyLen is the shortest secret, in bytes, a key may have
+const minKeyLen = 16
+
+// Claims is what a token says about its holder
+type Claims struct {
+	Session  string        `json:"sid"`
+	Code     string        `json:"code"`
+	Capacity int           `json:"cap"`
+	Slot     int           `json:"slot"`
+	Gen      int64         `json:"gen"` // the slot's generation, see session credentials
+	TTL      time.Duration `json:"ttl"`
+	Issued   time.Time     `json:"iat"`
+	Expires  time.Time     `json:"exp"`
+}
+
+// Expired reports whether the token is past its expiry at now
+func (c Claims) Expired(now time.Time) bool {
+	return !now.Before(c.Expires)
+}
+
+// Key is one signing secret, named by ID in the tokens it signs
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Keyring signs with its first key and verifies with any of them, so a new
+// key can be put in front while tokens signed by the old one stay valid
+type Keyring struct {
+	keys []Key
+}
+
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrInvalidKey
+	}
+	for _, k := range keys {
+		if k.ID == "" || strings.ContainsRune(k.ID, '.') || len(k.Secret) < minKeyLen {
+			return nil, fmt.Errorf("%w %q: needs an ID without dots and a secret of at least %d bytes", ErrInvalidKey, k.ID, minKeyLen)
+		}
+	}
+	return &Keyring{keys: keys}, nil
+}
+
+// ParseKeyring reads keys written as "id:base64secret", comma separated,
+// newest first
+func ParseKeyring(s string) (*Keyring, error) {
+	var keys []Key
+	for _, field := range strings.Split(s, ",") {
+		id, secret, ok := strings.Cut(strings.TrimSpace(field), ":")
+		if !ok {
+			return nil, fmt.Errorf("%w %q: want id:base64secret", ErrInvalidKey, field)
+		}
+		raw, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidKey, id, err)
+		}
+		keys = append(keys, Key{ID: id, Secret: raw})
+	}
+	return NewKeyring(keys...)
+}
+
+// Sign returns a token carrying c: "<key id>.<payload>.<signature>"
+func (k *Keyring) Sign(c Claims) string {
+	payload, _ := json.Marshal(c)
+	key := k.keys[0]
+	signed := key.ID + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac(key.Secret, signed))
+}
+
+// Verify checks a token's signature and returns its claims. Expiry is left
+// to the caller, which may know better.
+func (k *Keyring) Verify(tok string) (Claims, error) {
+	var c Claims
+
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		return c, ErrMalformed
+	}
+	key, ok := k.find(parts[0])
+	if !ok {
+		return c, ErrUnknownKey
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return c, ErrMalformed
+	}
+	if !hmac.Equal(sig, mac(key.Secret, parts[0]+"."+parts[1])) {
+		return c, ErrBadSignature
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return c, ErrMalformed
+	}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return c, ErrMalformed
+	}
+	return c, nil
+}
+
+func (k *Keyring) find(id string) (Key, bool) {
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+func mac(secret []byte, data string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
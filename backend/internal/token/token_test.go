@@ -0,0 +1,77 @@
+package token
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testKey(id string) Key {
+	return Key{ID: id, Secret: []byte(strings.Repeat(id, 16))}
+}
+
+func TestSignVerify(t *testing.T) {
+	k, _ := NewKeyring(testKey("a"))
+	now := time.Now().Truncate(time.Second)
+	want := Claims{Session: "s1", Code: "ABC123", Capacity: 2, Slot: 1, TTL: time.Hour, Issued: now, Expires: now.Add(time.Hour)}
+
+	got, err := k.Verify(k.Sign(want))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got.Session != want.Session || got.Slot != want.Slot || got.TTL != want.TTL || !got.Expires.Equal(want.Expires) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	if got.Expired(now) || !got.Expired(now.Add(time.Hour)) {
+		t.Errorf("Expected the token to expire after an hour")
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	k, _ := NewKeyring(testKey("a"))
+	tok := k.Sign(Claims{Session: "s1", Slot: 0})
+
+	parts := strings.Split(tok, ".")
+	forged, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(forged), `"slot":0`, `"slot":1`, 1)))
+
+	for in, want := range map[string]error{
+		strings.Join(parts, "."): ErrBadSignature,
+		"not-a-token":            ErrMalformed,
+		"b" + tok[1:]:            ErrUnknownKey,
+	} {
+		if _, err := k.Verify(in); err != want {
+			t.Errorf("Verify(%.20s...): expected %v, got %v", in, want, err)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, _ := NewKeyring(testKey("a"))
+	rotated, _ := NewKeyring(testKey("b"), testKey("a"))
+	retired, _ := NewKeyring(testKey("b"))
+
+	tok := old.Sign(Claims{Session: "s1"})
+	if _, err := rotated.Verify(tok); err != nil {
+		t.Errorf("Expected the old key to still verify, got %v", err)
+	}
+	if _, err := retired.Verify(tok); err != ErrUnknownKey {
+		t.Errorf("Expected a retired key to be unknown, got %v", err)
+	}
+	if !strings.HasPrefix(rotated.Sign(Claims{}), "b.") {
+		t.Errorf("Expected the first key to sign")
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 32)))
+	if _, err := ParseKeyring("k2:" + secret + ", k1:" + secret); err != nil {
+		t.Errorf("Expected two keys to parse, got %v", err)
+	}
+	for _, bad := range []string{"", "k1", "k1:short", "k.1:" + secret, "k1:!!!"} {
+		if _, err := ParseKeyring(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
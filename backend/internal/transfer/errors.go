@@ -0,0 +1,23 @@
+package transfer
+
+import "errors"
+
+var (
+	ErrNoTransfer       = errors.New("no transfer in progress")
+	ErrTransferOpen     = errors.New("transfer already in progress")
+	ErrTooManyTransfers = errors.New("too many open transfers")
+	ErrInvalidSize      = errors.New("invalid transfer size")
+	ErrOverrun          = errors.New("transfer exceeds declared size")
+	ErrIncomplete       = errors.New("transfer ended short of declared size")
+	ErrCancelled        = errors.New("transfer cancelled")
+	ErrInterrupted      = errors.New("transfer interrupted")
+	ErrBadOffset        = errors.New("resume offset does not match")
+	ErrNotAccepted      = errors.New("transfer not accepted yet")
+	ErrRejected         = errors.New("transfer rejected")
+	ErrOfferExpired     = errors.New("offer not answered in time")
+	ErrNoOffer          = errors.New("no such offer")
+	ErrCorrupt          = errors.New("file digest mismatch")
+	ErrBadFrame         = errors.New("invalid frame header")
+	ErrOutOfOrder       = errors.New("frame out of order")
+	ErrNoCredit         = errors.New("frame exceeds granted credit")
+)
@@ -0,0 +1,81 @@
+package transfer
+
+import (
+	"frop/models"
+	"time"
+)
+
+// window is the credit a sender under flow control starts with: how many
+// bytes it may send ahead of what its recipients' sockets have taken
+var window int64 = 16 << 20
+
+// SetWindow changes how far a sender may get ahead of its recipients
+func SetWindow(n int64) {
+	window = n
+}
+
+// stallAfter is how long a write to a recipient may block before the
+// sender is told to pause
+const stallAfter = time.Second
+
+// take accounts for n bytes the sender relays, which under flow control
+// must be within its credit
+func (t *Transfer) take(n int64) error {
+	if !t.Flow {
+		return nil
+	}
+	t.flowMu.Lock()
+	defer t.flowMu.Unlock()
+	if n > t.credit {
+		return ErrNoCredit
+	}
+	t.credit -= n
+	return nil
+}
+
+// grant lets t's sender send n more bytes, and tells it with "credit"
+func (t *Transfer) grant(n int64) {
+	t.flowMu.Lock()
+	defer t.flowMu.Unlock()
+	t.credit += n
+	t.notify(&models.WsResponse{Type: models.Credit, Credit: n})
+}
+
+// stall tells t's sender to pause, as a recipient has not taken its frame
+// for a while
+func (t *Transfer) stall() {
+	t.flowMu.Lock()
+	defer t.flowMu.Unlock()
+	if !t.paused {
+		t.paused = true
+		t.notify(&models.WsResponse{Type: models.Pause})
+	}
+}
+
+// unstall tells a paused sender to resume, once its recipients have taken
+// the frame that stalled
+func (t *Transfer) unstall() {
+	t.flowMu.Lock()
+	defer t.flowMu.Unlock()
+	if t.paused {
+		t.paused = false
+		t.notify(&models.WsResponse{Type: models.Resume})
+	}
+}
+
+// restart starts t's flow afresh, for a new transfer or a resumed one, and
+// grants the window under flow control
+func (t *Transfer) restart(flow bool) {
+	t.flowMu.Lock()
+	t.Flow, t.credit, t.paused = flow, 0, false
+	t.flowMu.Unlock()
+	if flow {
+		t.grant(window)
+	}
+}
+
+// notify tells t's sender about its flow, without waiting on its connection
+func (t *Transfer) notify(res *models.WsResponse) {
+	res.TransferID, res.Name = t.ID, t.Name
+	t.sender.Notify(res)
+}
@@ -0,0 +1,44 @@
+package transfer
+
+import "encoding/binary"
+
+// Binary frames of a transfer with an ID start with a header
+//
+//	byte 0     frameVersion
+//	bytes 1-4  transfer ID, big-endian
+//	bytes 5-8  sequence number, big-endian, counting from 0
+//
+// followed by the file data. Frames are relayed with the header intact, so
+// receivers can tell concurrent transfers apart. A transfer without an ID
+// sends bare data instead, and must then be its sender's only one.
+const (
+	frameVersion = 1
+	HeaderSize   = 9
+)
+
+// Header is the prefix of a binary frame of a transfer with an ID
+type Header struct {
+	ID  uint32
+	Seq uint32
+}
+
+// ParseFrame splits a binary frame into its header and file data
+func ParseFrame(frame []byte) (Header, []byte, error) {
+	if len(frame) < HeaderSize || frame[0] != frameVersion {
+		return Header{}, nil, ErrBadFrame
+	}
+	h := Header{
+		ID:  binary.BigEndian.Uint32(frame[1:5]),
+		Seq: binary.BigEndian.Uint32(frame[5:9]),
+	}
+	return h, frame[HeaderSize:], nil
+}
+
+// Frame builds the binary frame carrying data as frame seq of transfer id
+func Frame(id, seq uint32, data []byte) []byte {
+	frame := make([]byte, HeaderSize, HeaderSize+len(data))
+	frame[0] = frameVersion
+	binary.BigEndian.PutUint32(frame[1:5], id)
+	binary.BigEndian.PutUint32(frame[5:9], seq)
+	return append(frame, data...)
+}
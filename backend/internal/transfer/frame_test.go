@@ -0,0 +1,34 @@
+package transfer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	frame := Frame(0xDEADBEEF, 42, []byte("hello"))
+	if len(frame) != HeaderSize+5 {
+		t.Fatalf("Expected %d bytes, got %d", HeaderSize+5, len(frame))
+	}
+
+	h, data, err := ParseFrame(frame)
+	if err != nil {
+		t.Fatalf("ParseFrame: %v", err)
+	}
+	if h.ID != 0xDEADBEEF || h.Seq != 42 || !bytes.Equal(data, []byte("hello")) {
+		t.Errorf("Expected id=deadbeef seq=42 \"hello\", got %x %d %q", h.ID, h.Seq, data)
+	}
+}
+
+func TestParseFrameRejects(t *testing.T) {
+	bad := [][]byte{
+		nil,
+		make([]byte, HeaderSize-1),
+		append([]byte{2}, make([]byte, HeaderSize)...), // unknown version
+	}
+	for _, frame := range bad {
+		if _, _, err := ParseFrame(frame); err != ErrBadFrame {
+			t.Errorf("Expected ErrBadFrame for %v, got %v", frame, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package transfer
+
+import (
+	"frop/internal/room"
+	"frop/internal/session"
+	"frop/models"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// offerTimeout is how long an offer waits for file_accept or file_reject
+var offerTimeout = time.Minute
+
+// SetOfferTimeout changes how long an offer waits to be answered
+func SetOfferTimeout(d time.Duration) {
+	offerTimeout = d
+}
+
+// A transfer's decision: a file_start is accepted from the outset, a
+// file_offer waits for a recipient to answer, or for the timeout
+const (
+	pending int32 = iota
+	accepted
+	rejected
+	expired
+)
+
+// offer is where a transfer waits to be answered
+type offer struct {
+	key   parkKey
+	timer *time.Timer
+	asked []string // the recipients the offer was made to
+}
+
+// offersMu guards offers, and each offered transfer's answers
+var (
+	offersMu sync.Mutex
+	offers   = make(map[parkKey]*Transfer)
+)
+
+// waiting returns why t may not carry data yet, or nil once accepted
+func (t *Transfer) waiting() error {
+	switch t.decision.Load() {
+	case pending:
+		return ErrNotAccepted
+	case rejected:
+		return ErrRejected
+	case expired:
+		return ErrOfferExpired
+	}
+	return nil
+}
+
+// Offer opens a transfer for a file_offer; the caller relays the message.
+// Its frames are refused until a recipient answers with file_accept, and
+// then go only to the recipients that did. If nobody answers within the
+// offer timeout, sender and recipients get "file_error". With flow, the
+// sender is granted credit once accepted.
+func (r *Relay) Offer(id uint32, name string, size int64, to string, flow bool) (*Transfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.check(id, size); err != nil {
+		return nil, err
+	}
+	k, ok := r.key(id)
+	if !ok {
+		return nil, session.ErrSessionNotFound
+	}
+	r.unpark(id)
+
+	t := r.add(id, name, size, to)
+	t.Flow = flow
+	t.answers = make(map[string]bool)
+	t.offer = &offer{key: k}
+	peers, _ := session.GetRecipients(r.self.Conn, to)
+	for _, peer := range peers {
+		t.offer.asked = append(t.offer.asked, peer.ID())
+	}
+	t.offer.timer = time.AfterFunc(offerTimeout, func() {
+		if !t.decision.CompareAndSwap(pending, expired) {
+			return
+		}
+		withdraw(t)
+		slog.Info("Offer expired", "id", id, "name", name)
+		r.report(t, &models.WsResponse{Type: models.TransferError, Error: ErrOfferExpired.Error()})
+	})
+
+	offersMu.Lock()
+	offers[k] = t
+	offersMu.Unlock()
+	return t, nil
+}
+
+// Answer records the answer of recipient by to the offer of transfer id
+// from peer from. With from empty, the offer is looked up among those made
+// to by. Each recipient answers once, until the sender's first frame. The
+// first file_accept lets the transfer start; it is rejected once every
+// recipient has declined. Answer reports whether the answer is relayed to
+// the sender: every file_accept is, a file_reject only the last.
+func Answer(s *session.Session, by *room.Peer, from string, id uint32, accept bool) (*Transfer, string, bool, error) {
+	offersMu.Lock()
+	defer offersMu.Unlock()
+	var t *Transfer
+	for k, o := range offers {
+		_, answered := o.answers[by.ID()]
+		if k.session == s.Token() && k.id == id && (from == "" || k.from == from) &&
+			slices.Contains(o.offer.asked, by.ID()) && !answered {
+			t, from = o, k.from
+			break
+		}
+	}
+	if t == nil || t.decision.Load() > accepted {
+		return nil, "", false, ErrNoOffer
+	}
+
+	t.answers[by.ID()] = accept
+	slog.Info("Offer answered", "id", id, "name", t.Name, "by", by.ID(), "accepted", accept)
+	if len(t.answers) == len(t.offer.asked) {
+		t.withdraw()
+	}
+	if accept {
+		if t.decision.CompareAndSwap(pending, accepted) {
+			t.offer.timer.Stop()
+			if t.Flow {
+				t.grant(window)
+			}
+		}
+		if t.decision.Load() != accepted {
+			return nil, "", false, ErrNoOffer // expired as it was answered
+		}
+		return t, from, true, nil
+	}
+	if len(t.answers) == len(t.offer.asked) && t.decision.CompareAndSwap(pending, rejected) {
+		return t, from, true, nil
+	}
+	return t, from, false, nil
+}
+
+// Recipients narrows peers, the members t is addressed to, to those that
+// should hear of it: for an offered file, once accepted, only the
+// recipients that took it. A recipient that declined hears nothing more.
+func (t *Transfer) Recipients(peers []*room.Peer) []*room.Peer {
+	offersMu.Lock()
+	defer offersMu.Unlock()
+	if t.answers == nil {
+		return peers
+	}
+	started := t.decision.Load() == accepted
+	var kept []*room.Peer
+	for _, peer := range peers {
+		took, answered := t.answers[peer.ID()]
+		if took || (!answered && !started) {
+			kept = append(kept, peer)
+		}
+	}
+	return kept
+}
+
+// withdraw takes t off the offers, if it is there
+func withdraw(t *Transfer) {
+	offersMu.Lock()
+	defer offersMu.Unlock()
+	t.withdraw()
+}
+
+// withdraw takes t off the offers, with offersMu held
+func (t *Transfer) withdraw() {
+	o := t.offer
+	if o == nil {
+		return
+	}
+	o.timer.Stop()
+	if offers[o.key] == t {
+		delete(offers, o.key)
+	}
+}
+
+// prune closes transfers whose offer was rejected or expired, which the
+// sender's connection has not touched since
+func (r *Relay) prune() {
+	for _, t := range r.open {
+		if d := t.decision.Load(); d == rejected || d == expired {
+			r.close(t, Cancelled, t.waiting())
+		}
+	}
+}
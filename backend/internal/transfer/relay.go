@@ -2,36 +2,315 @@ package transfer
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"frop/internal/room"
 	"frop/internal/session"
+	"frop/models"
+	"io"
 	"log/slog"
-
-	"github.com/gorilla/websocket"
+	"strings"
+	"sync"
 )
 
+// maxOpen caps how many transfers one sender may have open at once
+const maxOpen = 16
+
+// Relay carries one sender's files to the other peers of its session,
+// holding each transfer's data to what its file_start declared. Transfers
+// with an ID may run side by side; their frames are told apart by header.
 type Relay struct {
-	conn *websocket.Conn
+	ctx  context.Context // the sender's connection
+	self *room.Peer
+	mu   sync.Mutex           // held by the sender's messages, and by offers answered
+	open map[uint32]*Transfer // by ID, 0 for one without
 }
 
-func NewRelay(conn *websocket.Conn) *Relay {
-	return &Relay{conn}
+// NewRelay returns a relay for self, whose transfers all end with ctx
+func NewRelay(ctx context.Context, self *room.Peer) *Relay {
+	return &Relay{ctx: ctx, self: self, open: make(map[uint32]*Transfer)}
 }
 
-func (r *Relay) RelayFile(ctx context.Context, chunk []byte) error {
-	// Check if already cancelled before attempting send
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+// Start opens a transfer for a file_start; the caller relays the message.
+// The binary frames that follow go to peer to, or to every other member of
+// the session when to is empty. A transfer without an ID (id 0) cannot
+// share the connection with any other. A non-zero offset resumes an
+// interrupted transfer from there, keeping its original recipients. With
+// flow, the sender is granted credit, see flow.go.
+func (r *Relay) Start(id uint32, name string, size int64, to string, offset int64, flow bool) (*Transfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if offset < 0 || offset > size {
+		return nil, ErrBadOffset
+	}
+	if err := r.check(id, size); err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		return r.resume(id, name, size, offset, flow)
+	}
+	r.unpark(id) // started over instead
+
+	t := r.add(id, name, size, to)
+	t.decision.Store(accepted)
+	t.restart(flow)
+	return t, nil
+}
+
+// check reports whether transfer id, of size bytes, may be opened
+func (r *Relay) check(id uint32, size int64) error {
+	if size < 0 {
+		return ErrInvalidSize
+	}
+	r.prune()
+	_, bare := r.open[0]
+	_, taken := r.open[id]
+	if bare || taken || (id == 0 && len(r.open) > 0) {
+		return ErrTransferOpen
 	}
+	if len(r.open) >= maxOpen {
+		return ErrTooManyTransfers
+	}
+	return nil
+}
+
+// add opens a new transfer, still to be accepted
+func (r *Relay) add(id uint32, name string, size int64, to string) *Transfer {
+	t := &Transfer{ID: id, Name: name, Size: size, To: to, hash: sha256.New(), sender: r.self}
+	t.ctx, t.cancel = context.WithCancelCause(r.ctx)
+	r.open[id] = t
+	return t
+}
+
+// Open returns the transfer in progress with the given ID
+func (r *Relay) Open(id uint32) (*Transfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.get(id)
+}
 
-	return r.relay(chunk)
+func (r *Relay) get(id uint32) (*Transfer, error) {
+	t, exists := r.open[id]
+	if !exists {
+		return nil, ErrNoTransfer
+	}
+	return t, nil
 }
 
-func (r *Relay) relay(chunk []byte) error {
-	peer, err := session.GetRemotePeer(r.conn)
+// RelayFile streams one binary frame from the sender's msg to its
+// recipients, a piece at a time, without holding the whole frame. A frame
+// outside a transfer or with a bad header is refused; one out of sequence,
+// past the declared size or beyond the sender's credit fails its transfer.
+func (r *Relay) RelayFile(msg io.Reader) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var buf [HeaderSize]byte
+	t, header, err := r.route(msg, buf[:])
 	if err != nil {
 		return err
 	}
-	slog.Debug("Sending chunk to peer", "size", len(chunk))
-	return peer.SendChunk(chunk)
+	// Check if already cancelled before attempting send
+	if err := t.Err(); err != nil {
+		return err
+	}
+	if t.seq == 0 {
+		withdraw(t) // too late to answer once data flows
+	}
+	peers, err := session.GetRecipients(r.self.Conn, t.To)
+	if err != nil {
+		r.park(t)
+		return err
+	}
+	peers = t.Recipients(peers)
+
+	piece := pieces.Get().(*[pieceSize]byte)
+	defer pieces.Put(piece)
+	from := t.Relayed
+	mark, _ := t.hash.(encoding.BinaryMarshaler).MarshalBinary()
+	lost, err := r.stream(t, peers, header, msg, piece[:])
+	switch {
+	case lost:
+		// the frame never reached a recipient whole, so it does not count
+		t.Relayed = from
+		t.hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(mark)
+		r.park(t)
+		return err
+	case errors.Is(err, ErrOverrun), errors.Is(err, ErrNoCredit):
+		r.fail(t, err)
+		return err
+	case err != nil:
+		return err // the sender's connection broke, and parks t as it closes
+	}
+
+	if n := t.Relayed - from; t.Flow && n > 0 {
+		t.grant(n)
+	}
+	t.unstall()
+	t.seq++
+	t.State = Streaming
+	return nil
+}
+
+// route finds the transfer a frame belongs to, reading its header, if any,
+// from msg into buf. Frames of a transfer not yet accepted are refused
+// without counting.
+func (r *Relay) route(msg io.Reader, buf []byte) (*Transfer, []byte, error) {
+	if t, bare := r.open[0]; bare {
+		return t, nil, r.accepted(t)
+	}
+	n, _ := io.ReadFull(msg, buf)
+	h, _, err := ParseFrame(buf[:n])
+	if err != nil && len(r.open) == 0 {
+		return nil, nil, r.stray(0) // bare data outside any transfer
+	}
+	if err != nil {
+		r.Refuse(0, "", err)
+		return nil, nil, err
+	}
+	t, err := r.get(h.ID)
+	if err != nil {
+		return nil, nil, r.stray(h.ID)
+	}
+	if err := r.accepted(t); err != nil {
+		return nil, nil, err
+	}
+	if h.Seq != t.seq {
+		r.fail(t, ErrOutOfOrder)
+		return nil, nil, ErrOutOfOrder
+	}
+	return t, buf[:n], nil
+}
+
+// accepted refuses a frame of t unless it has been accepted
+func (r *Relay) accepted(t *Transfer) error {
+	err := t.waiting()
+	if err != nil {
+		r.Refuse(t.ID, t.Name, err)
+	}
+	return err
+}
+
+// stray refuses a frame for transfer id, which is not open. Frames still
+// in flight for an interrupted transfer are dropped quietly instead.
+func (r *Relay) stray(id uint32) error {
+	if r.Parked(id) {
+		return ErrInterrupted
+	}
+	r.Refuse(id, "", ErrNoTransfer)
+	return ErrNoTransfer
+}
+
+// End closes transfer id for a file_end carrying the sender's digest, if
+// any. Unless every declared byte was relayed, it fails with ErrIncomplete;
+// unless the digest matches the data relayed, with ErrCorrupt. Either way
+// file_end must not be relayed.
+func (r *Relay) End(id uint32, digest string) (*Transfer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, err := r.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.waiting(); err != nil {
+		r.Refuse(id, t.Name, err)
+		return t, err
+	}
+	if t.Relayed != t.Size {
+		r.fail(t, ErrIncomplete)
+		return t, ErrIncomplete
+	}
+
+	t.Digest = hex.EncodeToString(t.hash.Sum(nil))
+	if digest != "" && !strings.EqualFold(digest, t.Digest) {
+		slog.Warn("Transfer corrupt", "id", t.ID, "name", t.Name, "want", digest, "got", t.Digest)
+		r.close(t, Failed, ErrCorrupt)
+		r.report(t, &models.WsResponse{Type: models.TransferCorrupt, Error: ErrCorrupt.Error()})
+		return t, ErrCorrupt
+	}
+	t.Checked = digest != ""
+	r.close(t, Completed, nil)
+	return t, nil
+}
+
+// Cancel closes transfer id for a file_cancel from its sender, keeping
+// reason, whether it is open or interrupted. Other transfers on the
+// connection carry on.
+func (r *Relay) Cancel(id uint32, reason string) (*Transfer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, err := r.get(id)
+	if err != nil {
+		if t, exists := r.unpark(id); exists {
+			t.Reason, t.State = reason, Cancelled
+			return t, true
+		}
+		return nil, false
+	}
+	slog.Info("Transfer cancelled", "id", id, "name", t.Name, "relayed", t.Relayed, "reason", reason)
+	t.Reason = reason
+	r.close(t, Cancelled, ErrCancelled)
+	return t, true
+}
+
+// Abandon closes t without a report, when its file_start could not be
+// relayed in the first place
+func (r *Relay) Abandon(t *Transfer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.close(t, Failed, ErrCancelled)
+}
+
+// fail stops t and tells its sender and recipients with file_error
+func (r *Relay) fail(t *Transfer, err error) {
+	slog.Warn("Transfer failed", "id", t.ID, "name", t.Name, "size", t.Size, "relayed", t.Relayed, "error", err)
+	r.close(t, Failed, err)
+	r.report(t, &models.WsResponse{Type: models.TransferError, Error: err.Error()})
+}
+
+// close takes t off the relay in its final state; err is what its context
+// gives as the cause, nil for a completed transfer
+func (r *Relay) close(t *Transfer, state State, err error) {
+	withdraw(t)
+	delete(r.open, t.ID)
+	t.State = state
+	t.cancel(err)
+}
+
+// Complete tells t's sender and recipients it arrived whole, once its
+// file_end has been relayed: with file_verified when its digest was
+// checked, file_complete otherwise
+func (r *Relay) Complete(t *Transfer) {
+	if t.Checked {
+		r.report(t, &models.WsResponse{Type: models.TransferVerified})
+		return
+	}
+	r.report(t, &models.WsResponse{Type: models.TransferComplete})
+}
+
+// report sends a server-authored outcome, with the bytes actually relayed,
+// to the sender and the transfer's recipients
+func (r *Relay) report(t *Transfer, res *models.WsResponse) {
+	relayed := t.Relayed
+	res.TransferID, res.Name, res.Size, res.Relayed, res.PeerID = t.ID, t.Name, t.Size, &relayed, r.self.ID()
+	if res.Type == models.TransferVerified || res.Type == models.TransferCorrupt {
+		res.SHA256 = t.Digest
+	}
+
+	r.self.SendResponse(res)
+	peers, err := session.GetRecipients(r.self.Conn, t.To)
+	if err != nil {
+		return
+	}
+	for _, peer := range t.Recipients(peers) {
+		peer.SendResponse(res)
+	}
+}
+
+// Refuse tells the sender alone, with file_error, that a message about
+// transfer id or name was out of place
+func (r *Relay) Refuse(id uint32, name string, err error) {
+	slog.Warn("Refused transfer message", "id", id, "name", name, "error", err)
+	r.self.SendResponse(&models.WsResponse{Type: models.TransferError, TransferID: id, Name: name, Error: err.Error()})
 }
@@ -0,0 +1,72 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"frop/internal/room"
+	"testing"
+)
+
+func TestCancelIsPerTransfer(t *testing.T) {
+	r := NewRelay(context.Background(), &room.Peer{})
+
+	a, _ := r.Start(1, "a.bin", 10, "", 0, false)
+	b, _ := r.Start(2, "b.bin", 10, "", 0, false)
+
+	if _, ok := r.Cancel(1, "user_cancelled"); !ok {
+		t.Fatal("Expected transfer 1 to be cancelled")
+	}
+	if a.State != Cancelled || a.Reason != "user_cancelled" || !errors.Is(a.Err(), ErrCancelled) {
+		t.Errorf("Expected cancelled with reason, got %v %q %v", a.State, a.Reason, a.Err())
+	}
+	if b.Err() != nil || !b.Open() {
+		t.Errorf("Expected transfer 2 still open, got %v %v", b.State, b.Err())
+	}
+	if _, ok := r.Cancel(1, "again"); ok {
+		t.Error("Expected a second cancel to find nothing")
+	}
+
+	// the ID is free for the next transfer
+	if _, err := r.Start(1, "c.bin", 10, "", 0, false); err != nil {
+		t.Errorf("Expected a new transfer 1, got %v", err)
+	}
+}
+
+func TestConnectionEndsTransfers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewRelay(ctx, &room.Peer{})
+
+	a, _ := r.Start(0, "a.bin", 10, "", 0, false)
+	cancel()
+	if !errors.Is(a.Err(), context.Canceled) {
+		t.Errorf("Expected the transfer to end with its connection, got %v", a.Err())
+	}
+}
+
+// TestStreamPieces verifies a frame larger than a piece is counted and
+// hashed whole, and that its size and the sender's credit are enforced
+func TestStreamPieces(t *testing.T) {
+	r := NewRelay(context.Background(), &room.Peer{})
+	data := bytes.Repeat([]byte("frop"), pieceSize) // four pieces
+	buf := make([]byte, pieceSize)
+
+	tr := &Transfer{Size: int64(len(data)), hash: sha256.New()}
+	if lost, err := r.stream(tr, nil, nil, bytes.NewReader(data), buf); lost || err != nil {
+		t.Fatalf("Expected the frame relayed, got lost=%v %v", lost, err)
+	}
+	if sum := sha256.Sum256(data); tr.Relayed != int64(len(data)) || !bytes.Equal(tr.hash.Sum(nil), sum[:]) {
+		t.Errorf("Expected %d bytes relayed and hashed, got %d", len(data), tr.Relayed)
+	}
+
+	short := &Transfer{Size: pieceSize, hash: sha256.New()}
+	if _, err := r.stream(short, nil, nil, bytes.NewReader(data), buf); !errors.Is(err, ErrOverrun) {
+		t.Errorf("Expected ErrOverrun, got %v", err)
+	}
+
+	flow := &Transfer{Size: int64(len(data)), Flow: true, credit: pieceSize, hash: sha256.New()}
+	if _, err := r.stream(flow, nil, nil, bytes.NewReader(data), buf); !errors.Is(err, ErrNoCredit) || flow.Relayed != pieceSize {
+		t.Errorf("Expected ErrNoCredit after one piece, got %v with %d relayed", err, flow.Relayed)
+	}
+}
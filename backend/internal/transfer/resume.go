@@ -0,0 +1,201 @@
+package transfer
+
+import (
+	"context"
+	"frop/internal/session"
+	"frop/models"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// resumeWindow is how long an interrupted transfer waits to be resumed
+var resumeWindow = time.Hour
+
+// SetResumeWindow changes how long an interrupted transfer can be resumed
+func SetResumeWindow(d time.Duration) {
+	resumeWindow = d
+}
+
+// parkKey names a transfer, interrupted or offered, by its session, sender
+// and ID
+type parkKey struct {
+	session string
+	from    string
+	id      uint32
+}
+
+type parkedTransfer struct {
+	t  *Transfer
+	at time.Time
+}
+
+// parked holds transfers cut off by either side dropping, with the bytes
+// delivered before the drop, until the sender resumes them
+var (
+	parkedMu sync.Mutex
+	parked   = make(map[parkKey]parkedTransfer)
+)
+
+// key returns where the sender's transfer id is parked, or false once the
+// sender is no longer in a session
+func (r *Relay) key(id uint32) (parkKey, bool) {
+	s, err := session.LookupSessionForConn(r.self.Conn)
+	if err != nil {
+		return parkKey{}, false
+	}
+	return parkKey{session: s.Token(), from: r.self.ID(), id: id}, true
+}
+
+// park sets t aside as interrupted at the bytes relayed so far and tells
+// whoever is still attached with "file_interrupted"
+func (r *Relay) park(t *Transfer) {
+	k, ok := r.key(t.ID)
+	if !ok {
+		r.close(t, Failed, ErrInterrupted)
+		return
+	}
+	if t.waiting() != nil {
+		r.close(t, Cancelled, ErrInterrupted) // nothing to resume before an answer
+		return
+	}
+	slog.Info("Transfer interrupted", "id", t.ID, "name", t.Name, "relayed", t.Relayed, "size", t.Size)
+	r.close(t, Interrupted, ErrInterrupted)
+
+	parkedMu.Lock()
+	parked[k] = parkedTransfer{t: t, at: time.Now()}
+	parkedMu.Unlock()
+	r.report(t, &models.WsResponse{Type: models.TransferInterrupted})
+}
+
+// Interrupt parks every open transfer, as the sender's connection closes
+func (r *Relay) Interrupt() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range r.open {
+		r.park(t)
+	}
+}
+
+// Parked reports whether the sender's transfer id is waiting to be resumed
+func (r *Relay) Parked(id uint32) bool {
+	k, ok := r.key(id)
+	if !ok {
+		return false
+	}
+	parkedMu.Lock()
+	defer parkedMu.Unlock()
+	_, exists := parked[k]
+	return exists
+}
+
+// unpark takes the sender's transfer id out of the parked set
+func (r *Relay) unpark(id uint32) (*Transfer, bool) {
+	k, ok := r.key(id)
+	if !ok {
+		return nil, false
+	}
+	parkedMu.Lock()
+	defer parkedMu.Unlock()
+	p, exists := parked[k]
+	delete(parked, k)
+	return p.t, exists
+}
+
+// resume reopens the parked transfer id from offset, which must be what
+// was delivered before it was interrupted
+func (r *Relay) resume(id uint32, name string, size, offset int64, flow bool) (*Transfer, error) {
+	t, exists := r.unpark(id)
+	if !exists {
+		return nil, ErrNoTransfer
+	}
+	if t.Name != name || t.Size != size || t.Relayed != offset {
+		r.close(t, Failed, ErrBadOffset)
+		return nil, ErrBadOffset
+	}
+
+	// the new leg counts frames afresh
+	t.seq = 0
+	t.State = Streaming
+	t.ctx, t.cancel = context.WithCancelCause(r.ctx)
+	r.open[id] = t
+	t.restart(flow)
+	slog.Info("Transfer resumed", "id", id, "name", name, "offset", offset)
+	return t, nil
+}
+
+// Announce offers every transfer of s that was interrupted, and whose
+// sender and recipients are attached again, to be resumed: each gets
+// "file_resumable" with the offset to resume from. Called after a peer
+// reconnects.
+func Announce(s *session.Session) {
+	parkedMu.Lock()
+	var ready []parkKey
+	for k := range parked {
+		if k.session == s.Token() {
+			ready = append(ready, k)
+		}
+	}
+	parkedMu.Unlock()
+
+	for _, k := range ready {
+		parkedMu.Lock()
+		p, exists := parked[k]
+		parkedMu.Unlock()
+		if !exists {
+			continue
+		}
+
+		sender, attached := s.Peer(k.from)
+		if !attached {
+			continue
+		}
+		peers, err := s.Recipients(sender.Conn, p.t.To)
+		if err != nil {
+			continue
+		}
+
+		t := p.t
+		res := &models.WsResponse{
+			Type:       models.TransferResumable,
+			TransferID: t.ID,
+			Name:       t.Name,
+			Size:       t.Size,
+			Offset:     t.Relayed,
+			PeerID:     k.from,
+		}
+		sender.SendResponse(res)
+		for _, peer := range peers {
+			peer.SendResponse(res)
+		}
+	}
+}
+
+// Sweep drops interrupted transfers not resumed within the resume window,
+// and returns how many
+func Sweep(now time.Time) int {
+	parkedMu.Lock()
+	defer parkedMu.Unlock()
+	n := 0
+	for k, p := range parked {
+		if now.Sub(p.at) > resumeWindow {
+			delete(parked, k)
+			n++
+		}
+	}
+	return n
+}
+
+// Reset forgets every interrupted transfer and offer (used for testing)
+func Reset() {
+	parkedMu.Lock()
+	clear(parked)
+	parkedMu.Unlock()
+
+	offersMu.Lock()
+	defer offersMu.Unlock()
+	for _, t := range offers {
+		t.offer.timer.Stop()
+	}
+	clear(offers)
+}
@@ -0,0 +1,111 @@
+package transfer
+
+import (
+	"frop/internal/room"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// pieceSize is how much of a frame is read from the sender and written to
+// its recipients at a time
+const pieceSize = 32 << 10
+
+// pieces are the buffers frames stream through, one per frame in flight
+var pieces = sync.Pool{New: func() any { return new([pieceSize]byte) }}
+
+// maxFrame caps the file data one binary frame may carry
+var maxFrame int64 = 8 << 20
+
+// SetMaxFrame changes how much file data one binary frame may carry
+func SetMaxFrame(n int64) {
+	maxFrame = n
+}
+
+// ReadLimit is the largest message a connection may send: a frame of the
+// maximum size, with its header
+func ReadLimit() int64 {
+	return maxFrame + HeaderSize
+}
+
+// stream writes a frame of t to peers: its header, if any, then the rest
+// of msg a piece at a time through buf, counted as relayed as it goes. It
+// reports whether a recipient failed to take the frame, which then never
+// reaches that recipient whole.
+func (r *Relay) stream(t *Transfer, peers []*room.Peer, header []byte, msg io.Reader, buf []byte) (lost bool, err error) {
+	// A fixed order, so two senders streaming to each other cannot deadlock
+	slices.SortFunc(peers, func(a, b *room.Peer) int { return a.Slot - b.Slot })
+
+	var writers []io.WriteCloser
+	defer func() {
+		for _, w := range writers {
+			if cerr := w.Close(); cerr != nil && !lost {
+				lost, err = true, cerr
+			}
+		}
+	}()
+	open := func() error {
+		for _, peer := range peers {
+			w, err := peer.ChunkWriter()
+			if err != nil {
+				return err
+			}
+			writers = append(writers, w)
+			if _, err := w.Write(header); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for {
+		n, rerr := io.ReadFull(msg, buf)
+		if n > 0 {
+			piece := buf[:n]
+			if int64(n) > t.Size-t.Relayed {
+				return false, ErrOverrun
+			}
+			if err := t.take(int64(n)); err != nil {
+				return false, err
+			}
+			if writers == nil {
+				if err := open(); err != nil {
+					return true, err
+				}
+			}
+			if err := t.write(writers, piece); err != nil {
+				return true, err
+			}
+			t.hash.Write(piece)
+			t.Relayed += int64(n)
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return false, rerr
+		}
+	}
+
+	// a frame without data still reaches the recipients
+	if writers == nil {
+		if err := open(); err != nil {
+			return true, err
+		}
+	}
+	return false, nil
+}
+
+// write hands piece to every recipient's writer, pausing the sender if one
+// of them holds it up
+func (t *Transfer) write(writers []io.WriteCloser, piece []byte) error {
+	stall := time.AfterFunc(stallAfter, t.stall)
+	defer stall.Stop()
+	for _, w := range writers {
+		if _, err := w.Write(piece); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package transfer
+
+import (
+	"context"
+	"frop/internal/room"
+	"hash"
+	"sync"
+	"sync/atomic"
+)
+
+// State is where a transfer is in its lifecycle
+type State int
+
+const (
+	Offered     State = iota // file_start relayed, no data yet
+	Streaming                // data is being relayed
+	Completed                // every declared byte relayed, then file_end
+	Cancelled                // given up with file_cancel
+	Failed                   // stopped by the server, see file_error
+	Interrupted              // cut off by a dropped peer, waiting to be resumed
+)
+
+var stateNames = [...]string{"offered", "streaming", "completed", "cancelled", "failed", "interrupted"}
+
+func (s State) String() string {
+	return stateNames[s]
+}
+
+// Transfer is one file on its way from a sender to the other peers
+type Transfer struct {
+	ID      uint32 // chosen by the sender, 0 for a transfer without one
+	Name    string
+	Size    int64  // declared in file_start
+	To      string // target peer, empty for every other member
+	State   State
+	Relayed int64  // bytes of file data relayed so far
+	Reason  string // given with file_cancel, once Cancelled
+	Digest  string // hex SHA-256 of the data relayed, once it has all been
+	Checked bool   // file_end carried a digest, and it matched
+	Flow    bool   // the sender asked for credit, see flow.go
+	seq     uint32 // sequence number the next frame must carry
+	hash    hash.Hash
+	sender  *room.Peer
+
+	flowMu sync.Mutex // see flow.go
+	credit int64      // bytes the sender may still send, under flow control
+	paused bool       // the sender was told to pause
+
+	decision atomic.Int32    // see offer.go; set by a recipient's connection
+	offer    *offer          // while awaiting an answer
+	answers  map[string]bool // for an offered file, recipient -> accepted it
+
+	ctx    context.Context // done once the transfer or its connection ends
+	cancel context.CancelCauseFunc
+}
+
+// Err returns why the transfer stopped, or nil while it is open
+func (t *Transfer) Err() error {
+	return context.Cause(t.ctx)
+}
+
+// Open reports whether the transfer still accepts data
+func (t *Transfer) Open() bool {
+	return t.State == Offered || t.State == Streaming
+}
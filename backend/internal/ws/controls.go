@@ -0,0 +1,173 @@
+package ws
+
+import (
+	"errors"
+	"frop/internal/room"
+	"frop/internal/session"
+	"frop/models"
+	"log/slog"
+
+	"github.com/gorilla/websocket"
+)
+
+var errJoinDenied = errors.New("join denied")
+
+// roomCode returns the room this connection belongs to: the session's room
+// once paired, otherwise the room it joined or knocked on
+func (c *Client) roomCode() string {
+	if s, err := session.LookupSessionForConn(c.conn); err == nil {
+		return s.Code
+	}
+	return c.code
+}
+
+// currentCreator returns the creator's live peer in room code, looking at
+// the session first since a reconnected creator only exists there
+func currentCreator(code string) *room.Peer {
+	if s, exists := session.ForRoom(code); exists {
+		return s.Creator()
+	}
+	r, err := room.GetRoom(code)
+	if err != nil {
+		return nil
+	}
+	return r.Creator()
+}
+
+// requireCreator returns the code of the room this connection created
+func (c *Client) requireCreator() (string, error) {
+	code := c.roomCode()
+	if code == "" {
+		return "", room.ErrRoomNotFound
+	}
+	if creator := currentCreator(code); creator == nil || creator.Conn != c.conn {
+		return "", room.ErrNotCreator
+	}
+	return code, nil
+}
+
+// knock parks this connection in a room that needs approval and asks the
+// creator to let it in
+func (c *Client) knock(code string) error {
+	id, err := room.Knock(code, c.selfPeer)
+	if err != nil {
+		return err
+	}
+	c.request = id
+
+	creator := currentCreator(code)
+	if creator == nil {
+		room.Withdraw(code, id)
+		c.request = ""
+		return room.ErrRoomNotFound
+	}
+	if err := c.sendResponse(&models.WsResponse{Type: models.Pending, RequestID: id}); err != nil {
+		return err
+	}
+	return creator.SendResponse(&models.WsResponse{Type: models.JoinRequest, RequestID: id})
+}
+
+func (c *Client) handleApprove(req *models.WsRequest) error {
+	code, err := c.requireCreator()
+	if err != nil {
+		return err
+	}
+	peer, members, err := room.Approve(code, req.RequestID)
+	if err != nil {
+		if peer != nil {
+			peer.SendResponse(&models.WsResponse{Type: models.Failed, Error: err.Error()})
+		}
+		return err
+	}
+
+	slog.Info("Join approved", "code", code, "peer", peer.ID())
+	if members != nil {
+		return session.Join(code, peer, members)
+	}
+	return nil
+}
+
+func (c *Client) handleDeny(req *models.WsRequest) error {
+	code, err := c.requireCreator()
+	if err != nil {
+		return err
+	}
+	peer, err := room.Deny(code, req.RequestID)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Join denied", "code", code, "request", req.RequestID)
+	return peer.SendResponse(&models.WsResponse{Type: models.Failed, Error: errJoinDenied.Error()})
+}
+
+func (c *Client) handleKick(req *models.WsRequest) error {
+	code, err := c.requireCreator()
+	if err != nil {
+		return err
+	}
+	if req.To == c.selfPeer.ID() {
+		return session.ErrPeerNotFound
+	}
+	s, exists := session.ForRoom(code)
+	if !exists {
+		return session.ErrPeerNotFound
+	}
+	peer, err := s.Kick(req.To)
+	if err != nil {
+		return err
+	}
+
+	peer.SendResponse(&models.WsResponse{Type: models.Kicked})
+	peer.Close()
+	if r, err := room.GetRoom(code); err == nil {
+		r.Release(peer.Slot)
+	}
+	return nil
+}
+
+func (c *Client) handleLock(locked bool) error {
+	code, err := c.requireCreator()
+	if err != nil {
+		return err
+	}
+	r, err := room.GetRoom(code)
+	if err != nil {
+		return err
+	}
+	r.SetLocked(locked)
+	slog.Info("Room lock changed", "code", code, "locked", locked)
+	return nil
+}
+
+func (c *Client) handleClose() error {
+	code, err := c.requireCreator()
+	if err != nil {
+		return err
+	}
+
+	var peers []*room.Peer
+	if s, exists := session.ForRoom(code); exists {
+		peers = append(peers, s.End()...)
+	}
+	if r, err := room.Close(code, "closed"); err == nil {
+		peers = append(peers, r.Peers()...)
+		peers = append(peers, r.Pending()...)
+	}
+	disconnectAll(peers, &models.WsResponse{Type: models.RoomClosed})
+	return nil
+}
+
+// disconnectAll sends res to each peer once and closes its connection
+func disconnectAll(peers []*room.Peer, res *models.WsResponse) {
+	seen := make(map[*websocket.Conn]bool)
+	for _, peer := range peers {
+		// the same connection can hold a room slot and a session slot
+		if seen[peer.Conn] {
+			continue
+		}
+		seen[peer.Conn] = true
+		peer.SendResponse(res)
+		peer.Close()
+	}
+}
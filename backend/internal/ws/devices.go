@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"frop/internal/device"
+	"frop/internal/ratelimit"
+	"frop/internal/room"
+	"frop/internal/session"
+	"frop/models"
+	"time"
+)
+
+// handleTrust asks to remember the pairing with the session's other peer.
+// Nothing is issued until that peer sends "trust" too; it is asked with
+// "trust_request".
+func (c *Client) handleTrust(req *models.WsRequest) error {
+	s, err := session.LookupSessionForConn(c.conn)
+	if err != nil {
+		return err
+	}
+	others, err := s.Recipients(c.conn, "")
+	if err != nil {
+		return err
+	}
+	if len(others) != 1 {
+		return device.ErrNotPaired
+	}
+	other := others[0]
+
+	now := time.Now()
+	side := device.Side{PeerID: c.selfPeer.ID(), Token: req.DeviceToken, Name: req.Name}
+	mine, theirs, err := device.Offer(s.Code, side, other.ID(), now)
+	if err != nil {
+		return err
+	}
+	if mine == nil {
+		return other.SendResponse(&models.WsResponse{Type: models.TrustRequest, PeerID: c.selfPeer.ID(), Name: req.Name})
+	}
+
+	c.sendResponse(trustedResponse(mine, theirs, now))
+	return other.SendResponse(trustedResponse(theirs, mine, now))
+}
+
+// trustedResponse gives self its credential and describes the device it
+// now trusts
+func trustedResponse(self, other *device.Side, since time.Time) *models.WsResponse {
+	return &models.WsResponse{
+		Type:        models.Trusted,
+		PeerID:      other.PeerID,
+		DeviceToken: self.Token,
+		DeviceID:    self.Device.ID,
+		Device:      &models.Device{ID: other.Device.ID, Name: other.Device.Name(), Since: since},
+	}
+}
+
+// handlePair meets a trusted device without a code: the first of the two to
+// ask waits in a fresh room, which the second joins
+func (c *Client) handlePair(req *models.WsRequest) error {
+	// Only bad credentials count, as with reconnects
+	now := time.Now()
+	if wait, err := ratelimit.Reconnect.Check(now, c.ip, c.key); err != nil {
+		return c.sendRateLimited(wait, err)
+	}
+	d, err := device.Authenticate(req.DeviceToken, now)
+	if err != nil {
+		ratelimit.Reconnect.Charge(now, c.ip, c.key)
+		return err
+	}
+
+	code, key, err := device.Meet(d, req.To)
+	if err != nil {
+		return err
+	}
+	peers, err := room.JoinRoom(code, key, c.selfPeer)
+	if err != nil {
+		return err
+	}
+	c.code = code
+	c.sendResponse(&models.WsResponse{Type: models.Routed, Code: code})
+
+	if peers != nil {
+		return session.Join(code, c.selfPeer, peers)
+	}
+	c.meeting = code
+	return nil
+}
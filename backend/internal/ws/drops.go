@@ -0,0 +1,54 @@
+package ws
+
+import (
+	"errors"
+	"frop/internal/drop"
+	"frop/internal/ratelimit"
+	"frop/internal/room"
+	"frop/models"
+	"time"
+)
+
+// handleListen registers this connection as the device a drop's visitors
+// are paired with
+func (c *Client) handleListen(req *models.WsRequest) error {
+	// Only wrong secrets count, as with reconnects
+	now := time.Now()
+	if wait, err := ratelimit.Join.Check(now, c.ip, c.key); err != nil {
+		return c.sendRateLimited(wait, err)
+	}
+
+	d, err := drop.Listen(req.Code, req.Secret, c.selfPeer, now)
+	if errors.Is(err, drop.ErrWrongSecret) {
+		ratelimit.Join.Charge(now, c.ip, c.key)
+	}
+	if err != nil {
+		return err
+	}
+	c.drop = d.Name
+
+	expiresAt := d.ExpiresAt()
+	return c.sendResponse(&models.WsResponse{Type: models.Listening, Code: d.Name, ExpiresAt: &expiresAt})
+}
+
+// joinDrop pairs a visitor with a drop's owner through a fresh room: the
+// visitor joins it here and the owner's device is asked to join it too,
+// taking the creator's seat with the host key
+func (c *Client) joinDrop(name string) error {
+	r, owner, host, err := drop.Route(name)
+	if err != nil {
+		return err
+	}
+	if _, err := room.JoinRoom(r.Code, "", c.selfPeer); err != nil {
+		return err
+	}
+	c.code = r.Code
+	c.sendResponse(&models.WsResponse{Type: models.Routed, Code: r.Code})
+
+	if err := owner.SendResponse(&models.WsResponse{Type: models.DropRequest, Code: r.Code, Secret: host}); err != nil {
+		room.Close(r.Code, "closed")
+		c.code = ""
+		return drop.ErrOwnerAway
+	}
+	return nil
+}
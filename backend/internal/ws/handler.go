@@ -3,13 +3,20 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"frop/internal/device"
+	"frop/internal/drop"
+	"frop/internal/ratelimit"
 	"frop/internal/room"
 	"frop/internal/session"
 	"frop/internal/transfer"
 	"frop/models"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -21,14 +28,53 @@ const (
 	pongWait     = 7 * time.Second  // How long to wait for pong before considering dead
 )
 
+// keepalive overrides the timing above once SetKeepalive is called.
+// Connections read it as they go, so it is swapped atomically.
+var keepalive atomic.Pointer[keepaliveTiming]
+
+type keepaliveTiming struct {
+	ping, pong time.Duration
+}
+
+// SetKeepalive changes how often peers are pinged and how long a pong may
+// take (for testing - a peer is only dropped after both have passed)
+func SetKeepalive(ping, pong time.Duration) {
+	keepalive.Store(&keepaliveTiming{ping: ping, pong: pong})
+}
+
+// pingEvery returns how often peers are pinged
+func pingEvery() time.Duration {
+	if k := keepalive.Load(); k != nil {
+		return k.ping
+	}
+	return pingInterval
+}
+
+// readWait returns how long a connection may go without a pong, or any
+// other sign of life, before it is dropped
+func readWait() time.Duration {
+	if k := keepalive.Load(); k != nil {
+		return k.ping + k.pong
+	}
+	return pingInterval + pongWait
+}
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
 type Client struct {
+	ip       string // rate limit keys for the client's address and this connection
+	key      string
 	conn     *websocket.Conn
 	selfPeer *room.Peer // Our own Peer - used for pings and responses to this connection
 	relay    *transfer.Relay
+	code     string // room joined or knocked on, before a session exists
+	request  string // pending join request awaiting the creator's answer
+	drop     string // drop this connection listens on for its owner
+	meeting  string // room this connection waits in for a trusted device
+
+	cancel context.CancelFunc // ends the connection's transfers when it closes
 }
 
 func ServeHttp(w http.ResponseWriter, r *http.Request) {
@@ -38,38 +84,57 @@ func ServeHttp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// No message may be larger than the largest frame
+	conn.SetReadLimit(transfer.ReadLimit())
+
 	// Set up keepalive: read deadline + pong handler
-	conn.SetReadDeadline(time.Now().Add(pingInterval + pongWait))
+	conn.SetReadDeadline(time.Now().Add(readWait()))
 	conn.SetPongHandler(func(string) error {
-		conn.SetReadDeadline(time.Now().Add(pingInterval + pongWait))
+		conn.SetReadDeadline(time.Now().Add(readWait()))
 		return nil
 	})
 
 	// Create Peer for this connection - used for pings/responses AND passed to JoinRoom
 	selfPeer := &room.Peer{Conn: conn}
+	ctx, cancel := context.WithCancel(context.Background())
 
 	client := &Client{
+		ip:       ratelimit.ClientIP(r),
+		key:      fmt.Sprintf("conn:%p", conn),
 		conn:     conn,
 		selfPeer: selfPeer,
-		relay:    transfer.NewRelay(conn),
+		relay:    transfer.NewRelay(ctx, selfPeer),
+		cancel:   cancel,
 	}
 	go client.startPinger()
 	go client.handle()
 }
 
 func (c *Client) handle() {
-	ctx, cancel := context.WithCancel(context.Background())
-
 	defer func() {
 		c.conn.Close()
-		cancel()
-		if s, err := session.LookupSessionForConn(c.conn); err == nil {
+		c.cancel()
+		ratelimit.Join.Forget(c.key)
+		ratelimit.Reconnect.Forget(c.key)
+		s, err := session.LookupSessionForConn(c.conn)
+		if c.request != "" && err != nil {
+			// still knocking; an approved request was already taken
+			room.Withdraw(c.code, c.request)
+		}
+		if c.drop != "" {
+			drop.Unlisten(c.drop, c.selfPeer)
+		}
+		if c.meeting != "" {
+			device.Abandon(c.meeting)
+		}
+		if err == nil {
+			c.relay.Interrupt()
 			s.Disconnect(c.conn)
 		}
 	}()
 
 	for {
-		msgType, msg, err := c.conn.ReadMessage()
+		msgType, r, err := c.conn.NextReader()
 		if err != nil {
 			// Don't log or send response for normal close errors
 			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
@@ -79,12 +144,17 @@ func (c *Client) handle() {
 		}
 
 		if msgType == websocket.BinaryMessage {
-			if err := c.sendBinary(ctx, msg); err != nil {
+			if err := c.sendBinary(r); err != nil {
 				slog.Error("Failed to send chunk", "error", err)
 			}
 			continue
 		}
 
+		msg, err := io.ReadAll(r)
+		if err != nil {
+			slog.Error("Failed to read msg", "error", err)
+			return
+		}
 		slog.Info("Read message", "size", len(msg))
 		slog.Debug("Message content", "message", string(msg))
 		var req models.WsRequest
@@ -95,7 +165,7 @@ func (c *Client) handle() {
 			continue
 		}
 
-		err = c.processRequest(cancel, &req)
+		err = c.processRequest(&req)
 		if err != nil {
 			slog.Error("Failed to process request", "error", err)
 			c.sendFailureResponse(err)
@@ -104,58 +174,200 @@ func (c *Client) handle() {
 	}
 }
 
-func (c *Client) processRequest(cancel context.CancelFunc, req *models.WsRequest) error {
+func (c *Client) processRequest(req *models.WsRequest) error {
 	slog.Info("Processing request", "type", req.Type)
 	switch req.Type {
 	case models.Join:
 		return c.handleJoin(req)
 	case models.Reconnect:
 		return c.handleReconnect(req)
-	case models.TransferStart, models.TransferEnd:
-		return c.handleFraming(req)
+	case models.Listen:
+		return c.handleListen(req)
+	case models.Pair:
+		return c.handlePair(req)
+	case models.Trust:
+		return c.handleTrust(req)
+	case models.TransferStart:
+		return c.handleStart(req)
+	case models.TransferOffer:
+		return c.handleOffer(req)
+	case models.TransferAccept, models.TransferReject:
+		return c.handleAnswer(req)
+	case models.TransferEnd:
+		return c.handleEnd(req)
 	case models.TransferCancel:
-		return c.handleCancel(cancel, req)
+		return c.handleCancel(req)
 	case models.Clipboard:
 		return c.handleClipboard(req)
+	case models.Extend:
+		return c.handleExtend(req)
+	case models.Leave:
+		return c.handleLeave()
+	case models.Approve:
+		return c.handleApprove(req)
+	case models.Deny:
+		return c.handleDeny(req)
+	case models.Kick:
+		return c.handleKick(req)
+	case models.Lock:
+		return c.handleLock(true)
+	case models.Unlock:
+		return c.handleLock(false)
+	case models.Close:
+		return c.handleClose()
 	}
 
 	return fmt.Errorf("Request type did not match any operation %s", req.Type)
 }
 
 func (c *Client) handleJoin(req *models.WsRequest) error {
-	peers, err := room.JoinRoom(req.Code, c.selfPeer)
+	if wait, err := ratelimit.Join.Allow(time.Now(), c.ip, c.key); err != nil {
+		return c.sendRateLimited(wait, err)
+	}
+	if drop.Exists(req.Code) {
+		return c.joinDrop(req.Code)
+	}
+
+	peers, err := room.JoinRoom(req.Code, req.Secret, c.selfPeer)
+	if errors.Is(err, room.ErrAwaitingApproval) {
+		c.code = room.Normalize(req.Code)
+		return c.knock(c.code)
+	}
 	if err != nil {
 		return err
 	}
+	c.code = room.Normalize(req.Code)
 
 	if peers != nil {
-		// both peers have joined, create a new session
-		s := session.NewSession(peers)
-		s.Notify()
+		// at least two peers are in, create or grow the room's session
+		return session.Join(req.Code, c.selfPeer, peers)
 	}
 
 	return nil
 }
 
 func (c *Client) handleReconnect(req *models.WsRequest) error {
-	token := req.SessionToken
-	s, err := session.GetSession(token)
+	// Only failed reconnects count: guessing tokens is what is limited
+	if wait, err := ratelimit.Reconnect.Check(time.Now(), c.ip, c.key); err != nil {
+		return c.sendRateLimited(wait, err)
+	}
+
+	s, slot, err := session.Resume(req.SessionToken)
 	if err != nil {
-		slog.Error("No session found", "token", token)
+		slog.Error("No session found", "error", err)
+		ratelimit.Reconnect.Charge(time.Now(), c.ip, c.key)
+		return err
+	}
+	if err := s.Reconnect(c.selfPeer, slot); err != nil {
 		return err
 	}
-	return s.Reconnect(c.selfPeer)
+	transfer.Announce(s)
+	return nil
 }
 
-func (c *Client) handleFraming(req *models.WsRequest) error {
-	return c.forwardToPeer(req)
+func (c *Client) handleExtend(req *models.WsRequest) error {
+	s, err := session.LookupSessionForConn(c.conn)
+	if err != nil {
+		return err
+	}
+	ttl, err := room.TTLFromSeconds(req.TTL)
+	if err != nil {
+		return err
+	}
+	_, err = s.Extend(ttl, time.Now())
+	return err
+}
+
+// handleStart opens a transfer and relays its file_start. Out of place
+// transfer messages get "file_error" rather than "failed", which clients
+// take as the end of the session.
+func (c *Client) handleStart(req *models.WsRequest) error {
+	t, err := c.relay.Start(req.TransferID, req.Name, req.Size, req.To, req.Offset, req.Flow)
+	if err != nil {
+		c.relay.Refuse(req.TransferID, req.Name, err)
+		return nil
+	}
+	if req.Offset > 0 {
+		req.Type, req.To = models.TransferResume, t.To
+	}
+	if err := c.forwardToPeer(req); err != nil {
+		c.relay.Abandon(t)
+		return err
+	}
+	return nil
+}
+
+// handleOffer opens a transfer that waits for a recipient's answer and
+// relays its file_offer
+func (c *Client) handleOffer(req *models.WsRequest) error {
+	t, err := c.relay.Offer(req.TransferID, req.Name, req.Size, req.To, req.Flow)
+	if err != nil {
+		c.relay.Refuse(req.TransferID, req.Name, err)
+		return nil
+	}
+	if err := c.forwardToPeer(req); err != nil {
+		c.relay.Abandon(t)
+		return err
+	}
+	return nil
 }
 
-func (c *Client) handleCancel(cancel context.CancelFunc, req *models.WsRequest) error {
-	cancel()
+// handleAnswer records this peer's file_accept or file_reject of an offer
+// made to it, and relays the answer to its sender when transfer.Answer says
+// so. req.To names the sender; it can be left out when only one offer has
+// that ID.
+func (c *Client) handleAnswer(req *models.WsRequest) error {
+	s, err := session.LookupSessionForConn(c.conn)
+	if err != nil {
+		return err
+	}
+	t, from, relay, err := transfer.Answer(s, c.selfPeer, req.To, req.TransferID, req.Type == models.TransferAccept)
+	if err != nil {
+		c.relay.Refuse(req.TransferID, req.Name, err)
+		return nil
+	}
+	if !relay {
+		return nil
+	}
+	req.To, req.Name = from, t.Name
 	return c.forwardToPeer(req)
 }
 
+// handleEnd relays file_end, and then "file_complete" or "file_verified",
+// only once every declared byte has been relayed and matches its digest;
+// otherwise everyone gets "file_error" or "file_corrupt"
+func (c *Client) handleEnd(req *models.WsRequest) error {
+	t, err := c.relay.End(req.TransferID, req.SHA256)
+	if errors.Is(err, transfer.ErrNoTransfer) {
+		c.relay.Refuse(req.TransferID, req.Name, err)
+		return nil
+	}
+	if err != nil {
+		return nil // reported by End
+	}
+
+	req.To = t.To
+	if err := c.forwardTransfer(req, t); err != nil {
+		return err
+	}
+	c.relay.Complete(t)
+	return nil
+}
+
+// handleCancel stops the sender's own transfer, if it is one, and relays
+// file_cancel. A receiver's file_cancel is only relayed: the sender answers
+// it with its own.
+func (c *Client) handleCancel(req *models.WsRequest) error {
+	t, ok := c.relay.Cancel(req.TransferID, req.Reason)
+	if !ok {
+		return c.forwardToPeer(req)
+	}
+	if req.To == "" {
+		req.To = t.To
+	}
+	return c.forwardTransfer(req, t)
+}
+
 func (c *Client) handleClipboard(req *models.WsRequest) error {
 	return c.forwardToPeer(req)
 }
@@ -168,13 +380,56 @@ func (c *Client) sendFailureResponse(err error) {
 	c.sendResponse(res)
 }
 
+// sendRateLimited answers a refused request with "rate_limited" rather
+// than "failed", so clients can back off instead of starting over
+func (c *Client) sendRateLimited(wait time.Duration, err error) error {
+	slog.Warn("Rate limited", "ip", c.ip, "error", err)
+	return c.sendResponse(&models.WsResponse{
+		Type:       models.RateLimited,
+		RetryAfter: int(math.Ceil(wait.Seconds())),
+		Error:      err.Error(),
+	})
+}
+
+// held are the message types kept for a peer that is reconnecting, rather
+// than refused: small ones that still make sense once it is back
+var held = map[models.Type]bool{
+	models.Clipboard:      true,
+	models.TransferCancel: true,
+}
+
 func (c *Client) forwardToPeer(req *models.WsRequest) error {
-	peer, err := session.GetRemotePeer(c.conn)
+	return c.forwardTransfer(req, nil)
+}
+
+// forwardTransfer relays the sender's message about t, if any, only to the
+// recipients of t that took it, see transfer.Transfer.Recipients
+func (c *Client) forwardTransfer(req *models.WsRequest, t *transfer.Transfer) error {
+	req.From = c.selfPeer.ID()
+	queued := 0
+	if held[req.Type] {
+		queued = session.Hold(c.conn, req)
+	}
+
+	peers, err := session.GetRecipients(c.conn, req.To)
+	if errors.Is(err, session.ErrPeerReconnecting) && queued > 0 {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	slog.Debug("Forwarding message to peer", "type", req.Type)
-	return c.forwardRequest(req, peer)
+	if t != nil {
+		peers = t.Recipients(peers)
+	}
+	slog.Debug("Forwarding message to peers", "type", req.Type, "peers", len(peers))
+
+	var errs []error
+	for _, peer := range peers {
+		if err := c.forwardRequest(req, peer); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 func (c *Client) forwardRequest(req *models.WsRequest, peer *room.Peer) error {
@@ -187,13 +442,25 @@ func (c *Client) sendResponse(res *models.WsResponse) error {
 	return c.selfPeer.SendResponse(res)
 }
 
-func (c *Client) sendBinary(ctx context.Context, msg []byte) error {
-	// Mutex is inside peer.SendChunk (called by relay)
-	return c.relay.RelayFile(ctx, msg)
+func (c *Client) sendBinary(msg io.Reader) error {
+	// Streamed to each recipient as it is read, see peer.ChunkWriter
+	return c.relay.RelayFile(progressReader{msg, c.conn})
+}
+
+// progressReader keeps a sender's connection alive while a frame streams
+// in, however long its recipients take to read it
+type progressReader struct {
+	io.Reader
+	conn *websocket.Conn
+}
+
+func (p progressReader) Read(b []byte) (int, error) {
+	p.conn.SetReadDeadline(time.Now().Add(readWait()))
+	return p.Reader.Read(b)
 }
 
 func (c *Client) startPinger() {
-	ticker := time.NewTicker(pingInterval)
+	ticker := time.NewTicker(pingEvery())
 	defer ticker.Stop()
 
 	for range ticker.C {
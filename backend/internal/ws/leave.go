@@ -0,0 +1,30 @@
+package ws
+
+import (
+	"frop/internal/room"
+	"frop/internal/session"
+	"frop/models"
+	"log/slog"
+)
+
+func (c *Client) handleLeave() error {
+	s, err := session.LookupSessionForConn(c.conn)
+	if err != nil {
+		return err
+	}
+	EndSession(s, c.selfPeer.ID())
+	return nil
+}
+
+// EndSession ends s for every peer because peerID left: its credentials
+// stop working, its room code is freed and everyone still connected, the
+// leaver included, gets "session_ended" and is disconnected
+func EndSession(s *session.Session, peerID string) {
+	peers := s.End()
+	if r, err := room.Close(s.Code, "left"); err == nil {
+		peers = append(peers, r.Peers()...)
+		peers = append(peers, r.Pending()...)
+	}
+	slog.Info("Session ended", "code", s.Code, "by", peerID)
+	disconnectAll(peers, &models.WsResponse{Type: models.SessionEnded, Reason: "left", PeerID: peerID})
+}
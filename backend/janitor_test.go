@@ -0,0 +1,147 @@
+package main
+
+// Janitor tests - background eviction of rooms and sessions that nobody
+// looks up again.
+
+import (
+	"testing"
+	"time"
+
+	"frop/internal/janitor"
+	"frop/internal/room"
+	"frop/internal/session"
+
+	"github.com/gorilla/websocket"
+)
+
+// expectClosedWith reads one message of the given type, then expects the
+// server to close the connection
+func expectClosedWith(t *testing.T, conn *websocket.Conn, msgType string) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg map[string]any
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("Expected %s message, got error: %v", msgType, err)
+	}
+	if msg["type"] != msgType {
+		t.Fatalf("Expected type=%s, got %v", msgType, msg)
+	}
+
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("Expected normal close after %s, got: %v", msgType, err)
+	}
+}
+
+// TestJanitorEvictsUntouchedRoom verifies a room nobody looks up again is
+// still removed by a sweep
+func TestJanitorEvictsUntouchedRoom(t *testing.T) {
+	defer cleanup()
+
+	code := room.CreateRoom()
+	fresh := room.CreateRoom()
+
+	r, _ := room.GetRoom(code)
+	r.SetCreatedAt(time.Now().Add(-31 * time.Minute))
+
+	report := janitor.Sweep(time.Now())
+
+	if len(report.Rooms) != 1 || report.Rooms[0] != code {
+		t.Errorf("Expected report to list only %s, got %v", code, report.Rooms)
+	}
+	if _, err := room.GetRoom(code); err != room.ErrRoomNotFound {
+		t.Errorf("Expected swept room to be gone, got: %v", err)
+	}
+	if _, err := room.GetRoom(fresh); err != nil {
+		t.Errorf("Fresh room should survive the sweep, got: %v", err)
+	}
+
+	t.Log("Untouched room evicted by janitor!")
+}
+
+// TestJanitorClosesWaitingPeer verifies a creator still waiting in an
+// expired room, and a joiner still waiting for its approval, are told and
+// disconnected
+func TestJanitorClosesWaitingPeer(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createRoom(t)
+	creator := ts.dialWS(t)
+	defer creator.Close()
+	joinFirst(t, creator, code)
+	knocker := ts.dialWS(t)
+	defer knocker.Close()
+	knock(t, creator, knocker, code)
+
+	r, _ := room.GetRoom(code)
+	r.SetCreatedAt(time.Now().Add(-31 * time.Minute))
+
+	report := janitor.Sweep(time.Now())
+	if report.Conns != 2 {
+		t.Errorf("Expected 2 connections closed, got %d", report.Conns)
+	}
+
+	expectClosedWith(t, creator, "room_expired")
+	expectClosedWith(t, knocker, "room_expired")
+
+	t.Log("Waiting peer notified and closed!")
+}
+
+// TestJanitorExpiresSession verifies an idle session is evicted along with
+// its connection mappings, and both attached peers are notified
+func TestJanitorExpiresSession(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	peer1, peer2, token := establishSession(t, ts.Server, ts.wsURL)
+	defer peer1.Close()
+	defer peer2.Close()
+
+	s, err := session.GetSession(token)
+	if err != nil {
+		t.Fatalf("Session not found: %v", err)
+	}
+	s.SetLastSeen(time.Now().Add(-16 * time.Minute))
+
+	report := janitor.Sweep(time.Now())
+	if report.Sessions != 1 || report.Conns != 2 {
+		t.Errorf("Expected 1 session and 2 conns in report, got %+v", report)
+	}
+
+	expectClosedWith(t, peer1, "session_expired")
+	expectClosedWith(t, peer2, "session_expired")
+
+	if _, err := session.GetSession(token); err != session.ErrSessionEnded {
+		t.Errorf("Expected swept session to have ended, got: %v", err)
+	}
+
+	t.Log("Idle session evicted and peers closed!")
+}
+
+// TestJoinExpiredRoom verifies JoinRoom enforces the room lifespan just
+// like GetRoom does
+func TestJoinExpiredRoom(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createRoom(t)
+	r, _ := room.GetRoom(code)
+	r.SetCreatedAt(time.Now().Add(-31 * time.Minute))
+
+	conn := ts.dialWS(t)
+	defer conn.Close()
+	msg := joinRoom(t, conn, code)
+
+	if msg["type"] != "failed" || msg["error"] != "room expired" {
+		t.Errorf("Expected failed/room expired, got %v", msg)
+	}
+
+	t.Log("Join on expired room rejected!")
+}
@@ -0,0 +1,84 @@
+package main
+
+// Join link tests - QR codes for a room and the short /j/{code} redirect.
+
+import (
+	"bytes"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestRoomQRCode verifies the QR endpoint renders PNG and SVG for a live
+// room and 404s for a missing one
+func TestRoomQRCode(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createRoom(t)
+
+	resp, err := http.Get(ts.URL + "/api/room/" + code + "/qr")
+	if err != nil {
+		t.Fatalf("Failed to GET QR code: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("Expected a PNG, got %s", resp.Header.Get("Content-Type"))
+	}
+	if _, err := png.Decode(bytes.NewReader(body)); err != nil {
+		t.Errorf("QR code is not a valid PNG: %v", err)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/room/" + code + "/qr?format=svg")
+	if err != nil {
+		t.Fatalf("Failed to GET SVG QR code: %v", err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "image/svg+xml" || !strings.HasPrefix(string(body), "<svg") {
+		t.Errorf("Expected an SVG, got %s: %.40s", resp.Header.Get("Content-Type"), body)
+	}
+
+	resp, err = http.Get(ts.URL + "/api/room/FAKE99/qr")
+	if err != nil {
+		t.Fatalf("Failed to GET QR code: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a missing room, got %d", resp.StatusCode)
+	}
+
+	t.Log("QR code rendered as PNG and SVG!")
+}
+
+// TestJoinLinkRedirect verifies /j/{code} opens the frontend with the code
+// filled in
+func TestJoinLinkRedirect(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(ts.URL + "/j/abc123")
+	if err != nil {
+		t.Fatalf("Failed to GET join link: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("Expected 302, got %d", resp.StatusCode)
+	}
+	if loc := resp.Header.Get("Location"); loc != "/?c=ABC123" {
+		t.Errorf("Expected redirect to /?c=ABC123, got %q", loc)
+	}
+
+	t.Log("Join link redirects to the prefilled frontend!")
+}
@@ -8,9 +8,11 @@ import (
 	"testing"
 	"time"
 
+	"frop/internal/ratelimit"
 	"frop/internal/room"
 	"frop/internal/routes"
 	"frop/internal/session"
+	"frop/internal/ws"
 	"frop/models"
 
 	"github.com/gorilla/websocket"
@@ -64,8 +66,8 @@ func (ts *keepaliveTestServer) pairPeers(t *testing.T) (peer1, peer2 *websocket.
 	peer1 = ts.dialWS(t)
 	peer2 = ts.dialWS(t)
 
-	peer1.WriteJSON(map[string]string{"type": "join", "code": code})
-	peer2.WriteJSON(map[string]string{"type": "join", "code": code})
+	joinFirst(t, peer1, code)
+	admit(t, peer1, peer2, code)
 
 	// Read connected messages
 	peer1.SetReadDeadline(time.Now().Add(2 * time.Second))
@@ -291,9 +293,8 @@ func TestKeepaliveWithWriteDeadline(t *testing.T) {
 	// Send multiple messages rapidly
 	for i := range 10 {
 		msg := map[string]any{
-			"type": "file_start",
-			"name": "test.txt",
-			"size": 100,
+			"type":    "clipboard",
+			"content": "test",
 		}
 		if err := peer1.WriteJSON(msg); err != nil {
 			t.Fatalf("Write %d failed: %v", i, err)
@@ -315,4 +316,100 @@ func TestKeepaliveWithWriteDeadline(t *testing.T) {
 func keepaliveCleanup() {
 	room.Reset()
 	session.Reset()
+	ratelimit.Configure(ratelimit.Defaults)
+}
+
+// TestSlowSenderKeepsRecipient verifies that a recipient stays connected
+// while a frame streams in from a sender that stalls partway through it for
+// longer than the keepalive allows. The frame holds the recipient's writer
+// the whole time, so its pings must not wait on it.
+func TestSlowSenderKeepsRecipient(t *testing.T) {
+	defer keepaliveCleanup()
+	ws.SetKeepalive(100*time.Millisecond, 200*time.Millisecond)
+	defer ws.SetKeepalive(10*time.Second, 7*time.Second)
+
+	ts := newKeepaliveTestServer()
+	defer ts.Close()
+
+	sender, recipient, _ := ts.pairPeers(t)
+	defer sender.Close()
+	defer recipient.Close()
+
+	// Both clients answer pings only while reading
+	type message struct {
+		kind int
+		data []byte
+	}
+	received := make(chan message, 8)
+	go func() {
+		defer close(received)
+		for {
+			kind, data, err := recipient.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- message{kind, data}
+		}
+	}()
+	go func() {
+		for {
+			if _, _, err := sender.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	next := func(what string) message {
+		t.Helper()
+		select {
+		case msg, ok := <-received:
+			if !ok {
+				t.Fatalf("Recipient was disconnected waiting for %s", what)
+			}
+			return msg
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		return message{}
+	}
+
+	data := make([]byte, 64<<10)
+	for i := range data {
+		data[i] = byte(i % 256)
+	}
+	if err := sender.WriteJSON(map[string]any{"type": "file_start", "name": "slow.bin", "size": len(data)}); err != nil {
+		t.Fatalf("Failed to send file_start: %v", err)
+	}
+	if msg := next("file_start"); !strings.Contains(string(msg.data), `"file_start"`) {
+		t.Fatalf("Expected file_start, got %s", msg.data)
+	}
+
+	// Send enough for the server to start streaming to the recipient, then
+	// stall for several keepalive windows before sending the rest
+	w, err := sender.NextWriter(websocket.BinaryMessage)
+	if err != nil {
+		t.Fatalf("Failed to start binary frame: %v", err)
+	}
+	if _, err := w.Write(data[:40<<10]); err != nil {
+		t.Fatalf("Failed to send first part: %v", err)
+	}
+	time.Sleep(time.Second)
+	if _, err := w.Write(data[40<<10:]); err != nil {
+		t.Fatalf("Failed to send rest: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to finish binary frame: %v", err)
+	}
+	if err := sender.WriteJSON(map[string]any{"type": "file_end", "name": "slow.bin"}); err != nil {
+		t.Fatalf("Failed to send file_end: %v", err)
+	}
+
+	msg := next("binary frame")
+	if msg.kind != websocket.BinaryMessage || string(msg.data) != string(data) {
+		t.Fatalf("Expected the whole frame, got type %d with %d bytes", msg.kind, len(msg.data))
+	}
+	if msg := next("file_end"); !strings.Contains(string(msg.data), `"file_end"`) {
+		t.Fatalf("Expected file_end, got %s", msg.data)
+	}
+
+	t.Log("Recipient stayed connected through a stalled frame")
 }
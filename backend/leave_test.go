@@ -0,0 +1,155 @@
+package main
+
+// Leave tests - ending a session on purpose, over the WebSocket or HTTP.
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"frop/internal/session"
+
+	"github.com/gorilla/websocket"
+)
+
+// expectSessionEnded reads "session_ended" from conn and checks who left
+func expectSessionEnded(t *testing.T, conn *websocket.Conn, by any) {
+	t.Helper()
+
+	msg := readType(t, conn, "session_ended")
+	if msg["reason"] != "left" || msg["peerId"] != by {
+		t.Errorf("Expected session_ended left by %v, got %v", by, msg)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("Expected normal close after session_ended, got: %v", err)
+	}
+}
+
+// endSession calls DELETE /api/session/{token}
+func (ts *testServer) endSession(t *testing.T, token any) int {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/session/"+url.PathEscape(token.(string)), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to end session: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// =============================================================================
+// Leave
+// =============================================================================
+
+// TestLeaveEndsSession verifies "leave" ends the session for both peers,
+// frees the room code and retires every token
+func TestLeaveEndsSession(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createRoom(t)
+	conns := []*websocket.Conn{ts.dialWS(t), ts.dialWS(t)}
+	joinFirst(t, conns[0], code)
+	admit(t, conns[0], conns[1], code)
+	msgs := []map[string]any{readType(t, conns[0], "connected"), readType(t, conns[1], "connected")}
+
+	conns[0].WriteJSON(map[string]string{"type": "leave"})
+	for _, conn := range conns {
+		expectSessionEnded(t, conn, msgs[0]["peerId"])
+	}
+
+	resp, err := http.Get(ts.URL + "/api/room/" + code)
+	if err != nil {
+		t.Fatalf("Failed to get room: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the room code to be freed, got %d", resp.StatusCode)
+	}
+
+	again := ts.reconnectWith(t, msgs[1]["sessionToken"])
+	defer again.Close()
+	if msg := readType(t, again, "failed"); msg["error"] != session.ErrSessionEnded.Error() {
+		t.Errorf("Expected %q, got %v", session.ErrSessionEnded, msg["error"])
+	}
+
+	t.Log("Leave ended the session for both peers!")
+}
+
+// TestEndSessionEndpoint verifies DELETE /api/session/{token} ends the
+// session like "leave" does
+func TestEndSessionEndpoint(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	conns[0].Close()
+	readType(t, conns[1], "peer_disconnected")
+
+	if status := ts.endSession(t, msgs[0]["sessionToken"]); status != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", status)
+	}
+	expectSessionEnded(t, conns[1], msgs[0]["peerId"])
+
+	if status := ts.endSession(t, msgs[0]["sessionToken"]); status != http.StatusGone {
+		t.Errorf("Expected 410 for an ended session, got %d", status)
+	}
+	if status := ts.endSession(t, "nonsense"); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown token, got %d", status)
+	}
+
+	t.Log("Session ended over HTTP!")
+}
+
+// TestLeaveRetiresSignedTokens verifies a signed token cannot rebuild a
+// session that was left
+func TestLeaveRetiresSignedTokens(t *testing.T) {
+	defer cleanup()
+	defer useSignedTokens(t, tokenKey("k1"))()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	conns[0].WriteJSON(map[string]string{"type": "leave"})
+	expectSessionEnded(t, conns[1], msgs[0]["peerId"])
+	conns[0].Close()
+
+	again := ts.reconnectWith(t, msgs[1]["sessionToken"])
+	defer again.Close()
+	if msg := readType(t, again, "failed"); msg["error"] != session.ErrSessionEnded.Error() {
+		t.Errorf("Expected %q, got %v", session.ErrSessionEnded, msg["error"])
+	}
+
+	t.Log("Signed tokens retired on leave!")
+}
+
+// TestCloseRetiresSignedTokens verifies a signed token cannot rebuild a
+// session whose room the creator closed
+func TestCloseRetiresSignedTokens(t *testing.T) {
+	defer cleanup()
+	defer useSignedTokens(t, tokenKey("k1"))()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	conns[0].WriteJSON(map[string]string{"type": "close"})
+	readType(t, conns[1], "room_closed")
+	conns[1].Close()
+
+	again := ts.reconnectWith(t, msgs[1]["sessionToken"])
+	defer again.Close()
+	if msg := readType(t, again, "failed"); msg["error"] != session.ErrSessionEnded.Error() {
+		t.Errorf("Expected %q, got %v", session.ErrSessionEnded, msg["error"])
+	}
+
+	t.Log("Signed tokens retired on close!")
+}
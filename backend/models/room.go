@@ -1,6 +1,62 @@
 package models
 
+import "time"
+
+// CreateRoomRequest is the optional JSON body of POST /api/room
+type CreateRoomRequest struct {
+	Capacity int    `json:"capacity,omitempty"` // max peers, defaults to 2
+	Secret   string `json:"secret,omitempty"`   // passphrase or PIN required to join
+	TTL      int    `json:"ttl,omitempty"`      // lifetime in seconds, capped by the server
+}
+
 type RoomResponse struct {
-	Code  string `json:"code,omitempty"`
-	Error string `json:"error,omitempty"`
+	Code           string     `json:"code,omitempty"`
+	Capacity       int        `json:"capacity,omitempty"`
+	SecretRequired bool       `json:"secretRequired,omitempty"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+}
+
+// RoomStatusResponse is returned by GET /api/room/:code
+type RoomStatusResponse struct {
+	Code           string    `json:"code"`
+	Exists         bool      `json:"exists"`
+	PeerCount      int       `json:"peerCount"`
+	Capacity       int       `json:"capacity"`
+	IsFull         bool      `json:"isFull"`
+	SecretRequired bool      `json:"secretRequired,omitempty"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+}
+
+// ErrorResponse is the body of every failed /api/* request
+type ErrorResponse struct {
+	Error  string `json:"error"`  // e.g. "room not found", same wording as WebSocket "failed"
+	Status int    `json:"status"` // HTTP status code, repeated for convenience
+}
+
+// ClaimDropRequest is the JSON body of POST /api/drop and DELETE /api/drop/:name
+type ClaimDropRequest struct {
+	Name   string `json:"name,omitempty"` // 3-32 of a-z, 0-9 and "-"; taken from the path on DELETE
+	Secret string `json:"secret"`         // proves ownership when listening, renewing or releasing
+}
+
+// DropResponse describes a reserved name
+type DropResponse struct {
+	Name      string    `json:"name"`
+	Online    bool      `json:"online"` // the owner's device is listening
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Device describes a trusted device, in "trusted" and GET /api/devices
+type Device struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name,omitempty"`
+	Since    time.Time  `json:"since"`              // when the pairing was made
+	LastSeen *time.Time `json:"lastSeen,omitempty"` // last use of its credential
+}
+
+// DevicesResponse is returned by GET /api/devices
+type DevicesResponse struct {
+	ID      string    `json:"id"` // the calling device
+	Name    string    `json:"name,omitempty"`
+	Trusted []*Device `json:"trusted"`
 }
@@ -1,29 +1,106 @@
 package models
 
+import "time"
+
 type Type string
 
 const (
 	Join             Type = "join"
 	Reconnect        Type = "reconnect"
 	Connected        Type = "connected"
+	Roster           Type = "roster"
 	Failed           Type = "failed"
 	PeerDisconnected Type = "peer_disconnected"
+	PeerReconnecting Type = "peer_reconnecting" // a peer dropped and may be back within the grace window
+	RoomExpired      Type = "room_expired"
+	SessionExpired   Type = "session_expired"
+	RateLimited      Type = "rate_limited" // too many attempts, see retryAfter
+	Extend           Type = "extend"
+	Extended         Type = "extended"          // sent to every peer after an extend
+	ExpiringSoon     Type = "expiring_soon"     // sent to every peer ahead of expiry
+	CredentialReused Type = "credential_reused" // a peer's old session token was presented
+	Leave            Type = "leave"
+	SessionEnded     Type = "session_ended" // sent to every peer once one leaves, see reason
+
 	TransferStart    Type = "file_start"
 	TransferEnd      Type = "file_end"
 	TransferCancel   Type = "file_cancel"
+	TransferComplete Type = "file_complete" // sent by the server to sender and recipients after file_end
+	TransferError    Type = "file_error"    // sent by the server when it stops or refuses a transfer
+	TransferVerified Type = "file_verified" // instead of "file_complete" when file_end's digest matched
+	TransferCorrupt  Type = "file_corrupt"  // instead of relaying file_end when its digest did not match
 	Clipboard        Type = "clipboard"
+
+	// asking a recipient before sending: the offer opens a transfer whose
+	// data is refused until the answer is file_accept
+
+	TransferOffer  Type = "file_offer"
+	TransferAccept Type = "file_accept"
+	TransferReject Type = "file_reject"
+
+	// resuming a transfer after a peer drops
+
+	TransferInterrupted Type = "file_interrupted" // sent by the server to whoever is left when a peer drops mid-transfer
+	TransferResumable   Type = "file_resumable"   // sent by the server to both sides once the dropped peer is back
+	TransferResume      Type = "file_resume"      // a file_start with an offset, as recipients get it
+
+	// flow control, sent by the server to a sender as its recipients drain
+
+	Credit Type = "credit" // bytes more the sender may send, for a transfer started with "flow"
+	Pause  Type = "pause"  // a window's worth of the transfer is waiting on its recipients
+	Resume Type = "resume" // they caught up; unlike "file_resume", nothing was interrupted
+
+	// creator controls
+
+	Pending     Type = "pending"      // sent to a joiner waiting for approval
+	JoinRequest Type = "join_request" // sent to the creator
+	Approve     Type = "approve"
+	Deny        Type = "deny"
+	Kick        Type = "kick"
+	Kicked      Type = "kicked"
+	Lock        Type = "lock"
+	Unlock      Type = "unlock"
+	Close       Type = "close"
+	RoomClosed  Type = "room_closed"
+
+	// drops
+
+	Listen      Type = "listen"       // the owner's device waits for visitors to a drop
+	Listening   Type = "listening"    // sent to the owner once listening
+	DropRequest Type = "drop_request" // sent to the owner: join code to meet a visitor
+	Routed      Type = "routed"       // sent to a visitor: paired through code
+
+	// trusted devices
+
+	Trust        Type = "trust"         // remember this pairing; both peers must send it
+	TrustRequest Type = "trust_request" // sent to the other peer after the first "trust"
+	Trusted      Type = "trusted"       // sent to both peers with their device credentials
+	Pair         Type = "pair"          // connect to a trusted device, no code needed
 )
 
 type WsRequest struct {
 	Type         Type   `json:"type"`
-	Code         string `json:"code,omitempty"`         // for "join"
+	Code         string `json:"code,omitempty"`         // for "join", or a drop name for "listen"
+	Secret       string `json:"secret,omitempty"`       // for "join" on a protected room, or a drop's host key; claim secret for "listen"
+	RequestID    string `json:"requestId,omitempty"`    // for "approve" and "deny"
 	SessionToken string `json:"sessionToken,omitempty"` // for "reconnect"
+	DeviceToken  string `json:"deviceToken,omitempty"`  // for "pair", and "trust" from an already trusted device
+	TTL          int    `json:"ttl,omitempty"`          // for "extend", seconds; 0 renews the current lifetime
+
+	// addressing
+
+	To   string `json:"to,omitempty"`   // target peer ID, empty broadcasts to every other member; device ID for "pair"
+	From string `json:"from,omitempty"` // sender peer ID, stamped by the server when relaying
 
 	// transfer
 
-	Name   string `json:"name,omitempty"`
-	Size   int    `json:"size,omitempty"`
-	Reason string `json:"reason,omitempty"`
+	TransferID uint32 `json:"transferId,omitempty"` // chosen by the sender, see transfer.Frame; omitted for one transfer at a time
+	Name       string `json:"name,omitempty"`       // also this device's label in "trust"
+	Size       int64  `json:"size,omitempty"`
+	Offset     int64  `json:"offset,omitempty"` // in "file_start", to resume from what "file_resumable" offered
+	Reason     string `json:"reason,omitempty"`
+	SHA256     string `json:"sha256,omitempty"` // hex digest of the whole file, in "file_end"
+	Flow       bool   `json:"flow,omitempty"`   // in "file_start" and "file_offer": send only as far as granted "credit"
 
 	// clipboard
 
@@ -31,14 +108,25 @@ type WsRequest struct {
 }
 
 type WsResponse struct {
-	Type         Type   `json:"type"`
-	SessionToken string `json:"sessionToken,omitempty"` // included in "connected" response
-	Error        string `json:"error,omitempty"`
-}
-
-// RoomStatusResponse is returned by GET /api/room/:code
-type RoomStatusResponse struct {
-	Exists    bool `json:"exists"`
-	PeerCount int  `json:"peerCount"`
-	IsFull    bool `json:"isFull"`
+	Type         Type       `json:"type"`
+	SessionToken string     `json:"sessionToken,omitempty"` // included in "connected" and "extended" responses
+	Code         string     `json:"code,omitempty"`         // room to join in "drop_request", room joined in "routed"
+	Secret       string     `json:"secret,omitempty"`       // host key to join with in "drop_request"
+	PeerID       string     `json:"peerId,omitempty"`       // own ID in "connected", departed peer in "peer_disconnected", sender in "file_complete" and "file_error"
+	Peers        []string   `json:"peers,omitempty"`        // current roster
+	RequestID    string     `json:"requestId,omitempty"`    // in "join_request"
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`    // in "connected", "extended" and "expiring_soon"
+	RetryAfter   int        `json:"retryAfter,omitempty"`   // seconds, in "rate_limited"
+	Reason       string     `json:"reason,omitempty"`       // why, in "session_ended"
+	TransferID   uint32     `json:"transferId,omitempty"`   // in "file_complete" and "file_error"
+	Name         string     `json:"name,omitempty"`         // transfer in "file_complete" and "file_error", asking device's label in "trust_request"
+	Size         int64      `json:"size,omitempty"`         // declared transfer size in "file_complete" and "file_error"
+	Relayed      *int64     `json:"relayed,omitempty"`      // bytes the server actually relayed, in "file_complete", "file_error" and "file_interrupted"
+	Offset       int64      `json:"offset,omitempty"`       // bytes delivered before the drop, to resume from, in "file_resumable"
+	SHA256       string     `json:"sha256,omitempty"`       // hex digest of what the server relayed, in "file_verified" and "file_corrupt"
+	Credit       int64      `json:"credit,omitempty"`       // bytes granted, in "credit"
+	DeviceToken  string     `json:"deviceToken,omitempty"`  // own device credential in "trusted"
+	DeviceID     string     `json:"deviceId,omitempty"`     // own device ID in "trusted"
+	Device       *Device    `json:"device,omitempty"`       // the newly trusted device in "trusted"
+	Error        string     `json:"error,omitempty"`
 }
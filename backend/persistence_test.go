@@ -0,0 +1,196 @@
+package main
+
+// Persistence tests - rooms and sessions survive a server restart when the
+// durable file-backed stores are in use.
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"frop/internal/device"
+	"frop/internal/drop"
+	"frop/internal/room"
+	"frop/internal/session"
+	"frop/models"
+)
+
+// useFileStores swaps in file-backed stores under dir, returning a function
+// that closes them. Calling it again with the same dir simulates a restart.
+func useFileStores(t *testing.T, dir string) func() {
+	t.Helper()
+
+	rooms, err := room.OpenFileStore(filepath.Join(dir, "rooms.log"))
+	if err != nil {
+		t.Fatalf("Failed to open room store: %v", err)
+	}
+	sessions, err := session.OpenFileStore(filepath.Join(dir, "sessions.log"))
+	if err != nil {
+		t.Fatalf("Failed to open session store: %v", err)
+	}
+	room.SetStore(rooms)
+	session.SetStore(sessions)
+
+	return func() {
+		rooms.Close()
+		sessions.Close()
+	}
+}
+
+// restoreMemoryStores puts the default in-memory stores back for other tests
+func restoreMemoryStores() {
+	room.SetStore(room.NewMemoryStore())
+	session.SetStore(session.NewMemoryStore())
+}
+
+// TestSwapStoresWhileLookingUp verifies the stores can be swapped while
+// lookups run, as they do for connections still closing when a test or a
+// restart swaps them. The race detector catches an unguarded swap.
+func TestSwapStoresWhileLookingUp(t *testing.T) {
+	defer restoreMemoryStores()
+
+	swapped := make(chan struct{})
+	go func() {
+		defer close(swapped)
+		room.SetStore(room.NewMemoryStore())
+		session.SetStore(session.NewMemoryStore())
+		drop.SetStore(drop.NewMemoryStore())
+		device.SetStore(device.NewMemoryStore())
+	}()
+
+	room.GetRoom("ABC123")
+	session.GetSession("nope")
+	drop.Get("nope")
+	device.Authenticate("nope.nope", time.Now())
+	<-swapped
+
+	t.Log("Stores swapped while looking up!")
+}
+
+// TestRoomSurvivesRestart verifies a created room can still be looked up
+// after the stores are reopened from disk
+func TestRoomSurvivesRestart(t *testing.T) {
+	defer restoreMemoryStores()
+	dir := t.TempDir()
+
+	closeStores := useFileStores(t, dir)
+	code := room.CreateRoom()
+	closeStores()
+
+	// "Restart": fresh stores replayed from the same directory
+	closeStores = useFileStores(t, dir)
+	defer closeStores()
+
+	if _, err := room.GetRoom(code); err != nil {
+		t.Fatalf("Room %s should survive restart, got: %v", code, err)
+	}
+
+	t.Log("Room survived restart!")
+}
+
+// unsavedRooms is a room store whose writes fail, like a full disk
+type unsavedRooms struct{ *room.MemoryStore }
+
+func (unsavedRooms) Add(*room.Room) error { return errors.New("disk full") }
+
+// TestCreateRoomNotSaved verifies a room the store failed to save is not
+// handed out, since its code would be gone after a restart
+func TestCreateRoomNotSaved(t *testing.T) {
+	defer restoreMemoryStores()
+	room.SetStore(unsavedRooms{room.NewMemoryStore()})
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/api/room", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var res models.RoomResponse
+	json.NewDecoder(resp.Body).Decode(&res)
+	if resp.StatusCode != http.StatusInternalServerError || res.Code != "" {
+		t.Errorf("Expected 500 without a code, got %d %+v", resp.StatusCode, res)
+	}
+
+	t.Log("Unsaved room not handed out!")
+}
+
+// TestReconnectAfterRestart verifies a peer can reconnect with its old
+// session token once the server has restarted
+func TestReconnectAfterRestart(t *testing.T) {
+	defer restoreMemoryStores()
+	dir := t.TempDir()
+
+	closeStores := useFileStores(t, dir)
+
+	ts := newTestServer()
+	peer1, peer2, token := establishSession(t, ts.Server, ts.wsURL)
+	peer1.Close()
+	peer2.Close()
+	ts.Close()
+	closeStores()
+
+	// Restart with the same data directory
+	closeStores = useFileStores(t, dir)
+	defer closeStores()
+	ts = newTestServer()
+	defer ts.Close()
+
+	conn := ts.dialWS(t)
+	defer conn.Close()
+
+	conn.WriteJSON(map[string]string{"type": "reconnect", "sessionToken": token})
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var resp map[string]any
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("Failed to read reconnect response: %v", err)
+	}
+
+	if resp["type"] != "connected" {
+		t.Fatalf("Expected connected after restart, got %v", resp)
+	}
+	if resp["sessionToken"] == token {
+		t.Errorf("Expected the token to rotate on reconnect, got the same %s", token)
+	}
+
+	t.Log("Reconnected with old token after restart!")
+}
+
+// TestEndedSessionSurvivesRestart verifies a session that was left stays
+// ended across a restart, so a signed token cannot rebuild it
+func TestEndedSessionSurvivesRestart(t *testing.T) {
+	defer cleanup()
+	defer restoreMemoryStores()
+	defer useSignedTokens(t, tokenKey("k1"))()
+	dir := t.TempDir()
+
+	closeStores := useFileStores(t, dir)
+
+	ts := newTestServer()
+	conns, msgs := ts.pairWithTokens(t)
+	conns[0].WriteJSON(map[string]string{"type": "leave"})
+	expectSessionEnded(t, conns[1], msgs[0]["peerId"])
+	conns[0].Close()
+	ts.Close()
+	closeStores()
+
+	// Restart with the same data directory
+	session.Reset()
+	closeStores = useFileStores(t, dir)
+	defer closeStores()
+	ts = newTestServer()
+	defer ts.Close()
+
+	again := ts.reconnectWith(t, msgs[1]["sessionToken"])
+	defer again.Close()
+	if msg := readType(t, again, "failed"); msg["error"] != session.ErrSessionEnded.Error() {
+		t.Errorf("Expected %q after restart, got %v", session.ErrSessionEnded, msg["error"])
+	}
+
+	t.Log("Ended session stayed ended after restart!")
+}
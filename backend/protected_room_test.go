@@ -0,0 +1,128 @@
+package main
+
+// Protected room tests - rooms created with a passphrase or PIN.
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"frop/models"
+)
+
+// createProtectedRoom creates a room that needs secret to join
+func (ts *testServer) createProtectedRoom(t *testing.T, secret string) string {
+	t.Helper()
+
+	body, _ := json.Marshal(models.CreateRoomRequest{Secret: secret})
+	resp, err := http.Post(ts.URL+"/api/room", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result models.RoomResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	if !result.SecretRequired {
+		t.Fatalf("Expected a protected room, got %+v", result)
+	}
+	return result.Code
+}
+
+// joinWithSecret sends a join message carrying secret and returns the
+// first response
+func (ts *testServer) joinWithSecret(t *testing.T, code, secret string) map[string]any {
+	t.Helper()
+
+	conn := ts.dialWS(t)
+	t.Cleanup(func() { conn.Close() })
+	conn.WriteJSON(map[string]string{"type": "join", "code": code, "secret": secret})
+	return readNext(t, conn)
+}
+
+// TestProtectedRoomJoin verifies joiners need the matching secret
+func TestProtectedRoomJoin(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createProtectedRoom(t, "4921")
+
+	if msg := ts.joinWithSecret(t, code, ""); msg["error"] != "secret required" {
+		t.Errorf("Expected secret required, got %v", msg)
+	}
+	if msg := ts.joinWithSecret(t, code, "0000"); msg["error"] != "wrong secret" {
+		t.Errorf("Expected wrong secret, got %v", msg)
+	}
+
+	creator := ts.dialWS(t)
+	defer creator.Close()
+	joiner := ts.dialWS(t)
+	defer joiner.Close()
+
+	creator.WriteJSON(map[string]string{"type": "join", "code": code, "secret": "4921"})
+	seated(t, code)
+	joiner.WriteJSON(map[string]string{"type": "join", "code": code, "secret": "4921"})
+	id := readType(t, joiner, "pending")["requestId"]
+	readType(t, creator, "join_request")
+	creator.WriteJSON(map[string]any{"type": "approve", "requestId": id})
+	readType(t, creator, "connected")
+	readType(t, joiner, "connected")
+
+	t.Log("Protected room joined with the right secret!")
+}
+
+// TestProtectedRoomLocksAfterWrongAttempts verifies repeated wrong guesses
+// lock the room, even against the right secret
+func TestProtectedRoomLocksAfterWrongAttempts(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createProtectedRoom(t, "correct horse")
+
+	var last map[string]any
+	for range 5 {
+		last = ts.joinWithSecret(t, code, "battery staple")
+	}
+	if last["error"] != "room locked" {
+		t.Errorf("Expected the 5th wrong guess to lock the room, got %v", last)
+	}
+
+	if msg := ts.joinWithSecret(t, code, "correct horse"); msg["error"] != "room locked" {
+		t.Errorf("Locked room should refuse even the right secret, got %v", msg)
+	}
+
+	t.Log("Room locked after brute-force attempts!")
+}
+
+// TestProtectedRoomStatus verifies GET reveals only that a secret is needed
+func TestProtectedRoomStatus(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createProtectedRoom(t, "hunter2")
+
+	resp, err := http.Get(ts.URL + "/api/room/" + code)
+	if err != nil {
+		t.Fatalf("Failed to GET room: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !strings.Contains(string(body), `"secretRequired":true`) {
+		t.Errorf("Expected secretRequired=true, got %s", body)
+	}
+	if strings.Contains(string(body), "hunter2") || strings.Contains(string(body), "hash") || strings.Contains(string(body), "salt") {
+		t.Errorf("Status leaks secret material: %s", body)
+	}
+
+	t.Log("Room status only reports that a secret is required!")
+}
@@ -0,0 +1,166 @@
+package main
+
+// Rate limit tests - room creation and join attempts from one client.
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"frop/internal/ratelimit"
+	"frop/models"
+)
+
+// TestCreateRoomRateLimited verifies room creation past the limit gets a
+// 429 in the shared error model
+func TestCreateRoomRateLimited(t *testing.T) {
+	defer cleanup()
+
+	ratelimit.Configure(ratelimit.Config{Create: ratelimit.Limit{Burst: 2, Per: time.Minute}})
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	ts.createRoom(t)
+	ts.createRoom(t)
+
+	resp, err := http.Post(ts.URL+"/api/room", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var errResp models.ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&errResp)
+	if resp.StatusCode != http.StatusTooManyRequests || errResp.Error != "rate limited" {
+		t.Errorf("Expected 429 rate limited, got %d %+v", resp.StatusCode, errResp)
+	}
+	if resp.Header.Get("Retry-After") != "30" {
+		t.Errorf("Expected Retry-After: 30, got %q", resp.Header.Get("Retry-After"))
+	}
+
+	t.Log("Room creation rate limited!")
+}
+
+// TestJoinRateLimited verifies code guessing on one socket is answered with
+// rate_limited, then a ban
+func TestJoinRateLimited(t *testing.T) {
+	defer cleanup()
+
+	ratelimit.Configure(ratelimit.Config{
+		Join: ratelimit.Limit{Burst: 3, Per: time.Minute},
+		Ban:  ratelimit.Ban{After: 2, For: time.Hour},
+	})
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conn := ts.dialWS(t)
+	defer conn.Close()
+
+	for range 3 {
+		if msg := joinRoom(t, conn, "FAKE99"); msg["error"] != "room not found" {
+			t.Fatalf("Expected room not found within the limit, got %v", msg)
+		}
+	}
+
+	msg := joinRoom(t, conn, "FAKE99")
+	if msg["type"] != "rate_limited" || msg["retryAfter"] != float64(20) {
+		t.Errorf("Expected rate_limited with retryAfter=20, got %v", msg)
+	}
+	msg = joinRoom(t, conn, "FAKE99")
+	if msg["type"] != "rate_limited" || msg["error"] != "temporarily banned" {
+		t.Errorf("Expected a ban after repeated refusals, got %v", msg)
+	}
+
+	// The ban is per IP too, so a fresh socket does not escape it
+	fresh := ts.dialWS(t)
+	defer fresh.Close()
+	if msg := joinRoom(t, fresh, ts.createRoom(t)); msg["error"] != "temporarily banned" {
+		t.Errorf("Expected the ban to follow the client IP, got %v", msg)
+	}
+
+	t.Log("Join attempts rate limited and banned!")
+}
+
+// TestFailedReconnectsRateLimited verifies only failed reconnects count
+func TestFailedReconnectsRateLimited(t *testing.T) {
+	defer cleanup()
+
+	ratelimit.Configure(ratelimit.Config{Reconnect: ratelimit.Limit{Burst: 2, Per: time.Minute}})
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conn := ts.dialWS(t)
+	defer conn.Close()
+
+	for range 2 {
+		conn.WriteJSON(map[string]string{"type": "reconnect", "sessionToken": "guess"})
+		readType(t, conn, "failed")
+	}
+	conn.WriteJSON(map[string]string{"type": "reconnect", "sessionToken": "guess"})
+	readType(t, conn, "rate_limited")
+
+	t.Log("Failed reconnects rate limited!")
+}
+
+// TestReleaseDropRateLimited verifies wrong claim secrets on release count,
+// so the secret cannot be guessed without limit
+func TestReleaseDropRateLimited(t *testing.T) {
+	defer cleanup()
+
+	ratelimit.Configure(ratelimit.Config{Join: ratelimit.Limit{Burst: 2, Per: time.Minute}})
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	ts.claimDrop(t, "alice", "hunter2")
+
+	release := func(secret string) *http.Response {
+		body, _ := json.Marshal(models.ClaimDropRequest{Secret: secret})
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/drop/alice", bytes.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to release drop: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for range 2 {
+		if resp := release("wrong"); resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("Expected 403 within the limit, got %d", resp.StatusCode)
+		}
+	}
+	resp := release("hunter2")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d", resp.StatusCode)
+	}
+
+	t.Log("Drop release rate limited!")
+}
+
+// TestFailedEndSessionRateLimited verifies bad tokens sent to
+// DELETE /api/session/{token} count like failed reconnects
+func TestFailedEndSessionRateLimited(t *testing.T) {
+	defer cleanup()
+
+	ratelimit.Configure(ratelimit.Config{Reconnect: ratelimit.Limit{Burst: 2, Per: time.Minute}})
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	for range 2 {
+		if status := ts.endSession(t, "guess"); status != http.StatusNotFound {
+			t.Fatalf("Expected 404 within the limit, got %d", status)
+		}
+	}
+	if status := ts.endSession(t, "guess"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 past the limit, got %d", status)
+	}
+
+	t.Log("Ending sessions with bad tokens rate limited!")
+}
@@ -0,0 +1,171 @@
+package main
+
+// Resumable transfer tests - a transfer cut off by either side dropping is
+// offered for resumption, from the bytes already delivered, once both sides
+// are back.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"frop/internal/transfer"
+
+	"github.com/gorilla/websocket"
+)
+
+// readChunk reads the next message, which must be a binary frame of
+// transfer id, and returns its data
+func readChunk(t *testing.T, conn *websocket.Conn, id uint32) []byte {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	msgType, frame, err := conn.ReadMessage()
+	if err != nil || msgType != websocket.BinaryMessage {
+		t.Fatalf("Expected a binary frame, got %d %q %v", msgType, frame, err)
+	}
+	h, data, err := transfer.ParseFrame(frame)
+	if err != nil || h.ID != id {
+		t.Fatalf("Expected a frame of transfer %d, got %v %v", id, h, err)
+	}
+	return data
+}
+
+// expectResumable checks a file_resumable offer for transfer id
+func expectResumable(t *testing.T, conn *websocket.Conn, id uint32, offset int, from any) {
+	t.Helper()
+
+	msg := readType(t, conn, "file_resumable")
+	if msg["transferId"] != float64(id) || msg["offset"] != float64(offset) || msg["peerId"] != from {
+		t.Errorf("Expected transfer %d from %v resumable at %d, got %v", id, from, offset, msg)
+	}
+}
+
+// =============================================================================
+// Resuming
+// =============================================================================
+
+// TestResumeAfterSenderDrops verifies a sender that reconnects picks up
+// from the offset it is given and the file still verifies end to end
+func TestResumeAfterSenderDrops(t *testing.T) {
+	defer cleanup()
+	defer useGrace(2 * time.Second)()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	defer conns[1].Close()
+	sender := msgs[0]["peerId"]
+
+	conns[0].WriteJSON(map[string]any{"type": "file_start", "transferId": 3, "name": "a.bin", "size": 10})
+	conns[0].WriteMessage(websocket.BinaryMessage, transfer.Frame(3, 0, []byte("hello")))
+	readType(t, conns[1], "file_start")
+	readChunk(t, conns[1], 3)
+
+	conns[0].Close()
+	if msg := readType(t, conns[1], "file_interrupted"); msg["relayed"] != float64(5) {
+		t.Errorf("Expected relayed=5, got %v", msg)
+	}
+	readType(t, conns[1], "peer_reconnecting")
+
+	back := ts.reconnectWith(t, msgs[0]["sessionToken"])
+	defer back.Close()
+	readType(t, back, "connected")
+	expectResumable(t, back, 3, 5, sender)
+	readType(t, conns[1], "connected")
+	expectResumable(t, conns[1], 3, 5, sender)
+
+	sum := sha256.Sum256([]byte("helloworld"))
+	back.WriteJSON(map[string]any{"type": "file_start", "transferId": 3, "name": "a.bin", "size": 10, "offset": 5})
+	back.WriteMessage(websocket.BinaryMessage, transfer.Frame(3, 0, []byte("world")))
+	back.WriteJSON(map[string]any{"type": "file_end", "transferId": 3, "name": "a.bin", "sha256": hex.EncodeToString(sum[:])})
+
+	if msg := readType(t, conns[1], "file_resume"); msg["offset"] != float64(5) || msg["from"] != sender {
+		t.Errorf("Expected file_resume at 5 from %v, got %v", sender, msg)
+	}
+	if data := readChunk(t, conns[1], 3); string(data) != "world" {
+		t.Errorf("Expected \"world\", got %q", data)
+	}
+	readType(t, conns[1], "file_end")
+	expectReport(t, readType(t, conns[1], "file_verified"), "file_verified", 10, "")
+	expectReport(t, readType(t, back, "file_verified"), "file_verified", 10, "")
+
+	t.Log("Transfer resumed after the sender dropped!")
+}
+
+// TestResumeAfterReceiverDrops verifies the sender is told its transfer is
+// interrupted, frames still in flight are dropped quietly, and both sides
+// are offered the resume once the receiver is back
+func TestResumeAfterReceiverDrops(t *testing.T) {
+	defer cleanup()
+	defer useGrace(2 * time.Second)()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	defer conns[0].Close()
+	sender := msgs[0]["peerId"]
+
+	conns[0].WriteJSON(map[string]any{"type": "file_start", "transferId": 3, "name": "a.bin", "size": 15})
+	conns[0].WriteMessage(websocket.BinaryMessage, transfer.Frame(3, 0, []byte("hello")))
+	readType(t, conns[1], "file_start")
+	readChunk(t, conns[1], 3)
+
+	conns[1].Close()
+	readType(t, conns[0], "peer_reconnecting")
+
+	conns[0].WriteMessage(websocket.BinaryMessage, transfer.Frame(3, 1, []byte("world")))
+	if msg := readType(t, conns[0], "file_interrupted"); msg["relayed"] != float64(5) {
+		t.Errorf("Expected relayed=5, got %v", msg)
+	}
+	conns[0].WriteMessage(websocket.BinaryMessage, transfer.Frame(3, 2, []byte("again")))
+
+	back := ts.reconnectWith(t, msgs[1]["sessionToken"])
+	defer back.Close()
+	readType(t, conns[0], "connected") // not a file_error for the frame in flight
+	expectResumable(t, conns[0], 3, 5, sender)
+	readType(t, back, "connected")
+	expectResumable(t, back, 3, 5, sender)
+
+	conns[0].WriteJSON(map[string]any{"type": "file_start", "transferId": 3, "name": "a.bin", "size": 15, "offset": 5})
+	if msg := readType(t, back, "file_resume"); msg["offset"] != float64(5) {
+		t.Errorf("Expected file_resume at 5, got %v", msg)
+	}
+
+	t.Log("Transfer resumable after the receiver dropped!")
+}
+
+// TestResumeWrongOffsetRefused verifies a resume must start exactly where
+// delivery stopped
+func TestResumeWrongOffsetRefused(t *testing.T) {
+	defer cleanup()
+	defer useGrace(2 * time.Second)()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	defer conns[1].Close()
+
+	conns[0].WriteJSON(map[string]any{"type": "file_start", "transferId": 3, "name": "a.bin", "size": 10})
+	conns[0].WriteMessage(websocket.BinaryMessage, transfer.Frame(3, 0, []byte("hello")))
+	readType(t, conns[1], "file_start")
+	readChunk(t, conns[1], 3)
+	conns[0].Close()
+	readType(t, conns[1], "file_interrupted")
+
+	back := ts.reconnectWith(t, msgs[0]["sessionToken"])
+	defer back.Close()
+	readType(t, back, "connected")
+	readType(t, back, "file_resumable")
+
+	back.WriteJSON(map[string]any{"type": "file_start", "transferId": 3, "name": "a.bin", "size": 10, "offset": 8})
+	if msg := readType(t, back, "file_error"); msg["error"] != transfer.ErrBadOffset.Error() {
+		t.Errorf("Expected %q, got %v", transfer.ErrBadOffset, msg)
+	}
+
+	t.Log("Wrong resume offset refused!")
+}
@@ -0,0 +1,135 @@
+package main
+
+// Room event stream tests - GET /api/room/{code}/events as Server-Sent Events.
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"frop/internal/events"
+)
+
+// eventStream reads named events off an SSE response
+type eventStream struct {
+	resp   *http.Response
+	events chan [2]string // name, data
+}
+
+// watchRoom opens the event stream of room code and waits for its status
+func (ts *testServer) watchRoom(t *testing.T, code string) *eventStream {
+	t.Helper()
+
+	resp, err := http.Get(ts.URL + "/api/room/" + code + "/events")
+	if err != nil {
+		t.Fatalf("Failed to open event stream: %v", err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %s", ct)
+	}
+
+	s := &eventStream{resp: resp, events: make(chan [2]string, 16)}
+	go func() {
+		defer close(s.events)
+		var name string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				s.events <- [2]string{name, strings.TrimPrefix(line, "data: ")}
+			}
+		}
+	}()
+	s.next(t, "status")
+	return s
+}
+
+// next reads the next event and checks its name
+func (s *eventStream) next(t *testing.T, name string) map[string]any {
+	t.Helper()
+
+	select {
+	case e, open := <-s.events:
+		if !open {
+			t.Fatalf("Expected %s, stream ended", name)
+		}
+		if e[0] != name {
+			t.Fatalf("Expected event %s, got %s: %s", name, e[0], e[1])
+		}
+		var data map[string]any
+		json.Unmarshal([]byte(e[1]), &data)
+		return data
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Timed out waiting for %s", name)
+		return nil
+	}
+}
+
+// TestRoomEventStream verifies a watcher sees peers join, pair, leave, and
+// the room close
+func TestRoomEventStream(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createRoom(t)
+	stream := ts.watchRoom(t, code)
+	defer stream.resp.Body.Close()
+
+	peers := ts.joinGroup(t, code, 2)
+	defer peers[0].Close()
+
+	if e := stream.next(t, "peer_joined"); e["peerId"] != "p1" {
+		t.Errorf("Expected p1 to join first, got %v", e)
+	}
+	stream.next(t, "peer_joined")
+	if e := stream.next(t, "paired"); len(e["peers"].([]any)) != 2 {
+		t.Errorf("Expected both peers in the paired event, got %v", e)
+	}
+
+	peers[1].Close()
+	if e := stream.next(t, "peer_left"); e["peerId"] != "p2" || e["reason"] != "disconnected" {
+		t.Errorf("Expected p2 to leave, got %v", e)
+	}
+	readType(t, peers[0], "peer_disconnected")
+
+	peers[0].WriteJSON(map[string]string{"type": "close"})
+	if e := stream.next(t, "closed"); e["reason"] != "closed" {
+		t.Errorf("Expected the room to be closed by its creator, got %v", e)
+	}
+	if _, open := <-stream.events; open {
+		t.Error("Expected the stream to end after closed")
+	}
+
+	t.Log("Room lifecycle streamed as events!")
+}
+
+// TestRoomEventStreamMissingRoom verifies a missing room gets a JSON 404
+// instead of a stream
+func TestRoomEventStreamMissingRoom(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/room/FAKE99/events")
+	if err != nil {
+		t.Fatalf("Failed to GET events: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", resp.StatusCode)
+	}
+	if events.Subscribers("FAKE99") != 0 {
+		t.Error("A refused stream should not leave a subscription behind")
+	}
+
+	t.Log("Missing room refused without a stream!")
+}
@@ -4,13 +4,18 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"frop/internal/device"
+	"frop/internal/drop"
+	"frop/internal/ratelimit"
 	"frop/internal/room"
 	"frop/internal/routes"
 	"frop/internal/session"
+	"frop/internal/transfer"
 	"frop/models"
 
 	"github.com/gorilla/websocket"
@@ -26,6 +31,13 @@ type testServer struct {
 	wsURL string
 }
 
+// TestMain hashes secrets with few rounds: the real cost guards against
+// offline guessing, and would only slow these tests down
+func TestMain(m *testing.M) {
+	room.SetSecretIterations(1000)
+	os.Exit(m.Run())
+}
+
 // newTestServer creates a test server with all API routes configured
 func newTestServer() *testServer {
 	mux := http.NewServeMux()
@@ -70,6 +82,44 @@ func joinRoom(t *testing.T, conn *websocket.Conn, code string) map[string]any {
 	return msg
 }
 
+// readNext reads the next JSON message of any type
+func readNext(t *testing.T, conn *websocket.Conn) map[string]any {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg map[string]any
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	return msg
+}
+
+// readType reads the next JSON message and checks its type
+func readType(t *testing.T, conn *websocket.Conn, msgType string) map[string]any {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg map[string]any
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("Expected %s, got error: %v", msgType, err)
+	}
+	if msg["type"] != msgType {
+		t.Fatalf("Expected type=%s, got %v", msgType, msg)
+	}
+	return msg
+}
+
+// expectSilence verifies nothing arrives on conn for a short while. The
+// read times out, so conn cannot be read from afterwards.
+func expectSilence(t *testing.T, conn *websocket.Conn) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, msg, err := conn.ReadMessage(); err == nil {
+		t.Fatalf("Expected nothing, got %s", msg)
+	}
+}
+
 // =============================================================================
 // Tests
 // =============================================================================
@@ -97,20 +147,15 @@ func TestFullRoomFlow(t *testing.T) {
 	creator := ts.dialWS(t)
 	defer creator.Close()
 
-	joinMsg := map[string]string{"type": "join", "code": code}
-	if err := creator.WriteJSON(joinMsg); err != nil {
-		t.Fatalf("Creator failed to send join: %v", err)
-	}
+	joinFirst(t, creator, code)
 	t.Log("Creator sent join message")
 
-	// Step 3: Joiner connects and joins
+	// Step 3: Joiner connects, knocks and is let in
 	joiner := ts.dialWS(t)
 	defer joiner.Close()
 
-	if err := joiner.WriteJSON(joinMsg); err != nil {
-		t.Fatalf("Joiner failed to send join: %v", err)
-	}
-	t.Log("Joiner sent join message")
+	admit(t, creator, joiner, code)
+	t.Log("Creator approved the joiner")
 
 	// Step 4: Both should receive "connected" message
 	creator.SetReadDeadline(time.Now().Add(2 * time.Second))
@@ -153,12 +198,12 @@ func TestFullRoomFlow(t *testing.T) {
 		t.Error("Joiner should receive a sessionToken")
 	}
 
-	// Both peers should get the SAME token (they share a session)
-	if creatorToken != joinerToken {
-		t.Errorf("Session tokens should match: creator=%s, joiner=%s", creatorToken, joinerToken)
+	// Each peer gets its own credential for the shared session
+	if creatorToken == joinerToken {
+		t.Errorf("Session tokens should differ per peer, both got %s", creatorToken)
 	}
 
-	t.Logf("Both peers received matching session token: %s", creatorToken)
+	t.Logf("Both peers received their own session token: %s", creatorToken)
 }
 
 // TestSessionTokenReconnect tests reconnection flow
@@ -170,13 +215,13 @@ func TestSessionTokenReconnect(t *testing.T) {
 
 	code := ts.createRoom(t)
 
-	// Both peers join
+	// peer1 creates, and lets peer2 in
 	peer1 := ts.dialWS(t)
 	peer2 := ts.dialWS(t)
 	defer peer2.Close()
 
-	peer1.WriteJSON(map[string]string{"type": "join", "code": code})
-	peer2.WriteJSON(map[string]string{"type": "join", "code": code})
+	joinFirst(t, peer1, code)
+	admit(t, peer1, peer2, code)
 
 	// Get session token from connected message
 	peer1.SetReadDeadline(time.Now().Add(2 * time.Second))
@@ -258,13 +303,13 @@ func TestPeerDisconnectNotification(t *testing.T) {
 
 	code := ts.createRoom(t)
 
-	// Both peers join
+	// peer1 creates, and lets peer2 in
 	peer1 := ts.dialWS(t)
 	peer2 := ts.dialWS(t)
 	defer peer2.Close()
 
-	peer1.WriteJSON(map[string]string{"type": "join", "code": code})
-	peer2.WriteJSON(map[string]string{"type": "join", "code": code})
+	joinFirst(t, peer1, code)
+	admit(t, peer1, peer2, code)
 
 	// Read connected messages
 	peer1.SetReadDeadline(time.Now().Add(2 * time.Second))
@@ -301,14 +346,14 @@ func TestRoomFullRejection(t *testing.T) {
 	code := ts.createRoom(t)
 	t.Logf("Created room with code: %s", code)
 
-	// Peer 1 and 2 join (need to send both before reading - they wait for each other)
+	// Peer 1 creates and lets peer 2 in
 	peer1 := ts.dialWS(t)
 	defer peer1.Close()
 	peer2 := ts.dialWS(t)
 	defer peer2.Close()
 
-	peer1.WriteJSON(map[string]string{"type": "join", "code": code})
-	peer2.WriteJSON(map[string]string{"type": "join", "code": code})
+	joinFirst(t, peer1, code)
+	admit(t, peer1, peer2, code)
 
 	// Now both can read their connected messages
 	peer1.SetReadDeadline(time.Now().Add(2 * time.Second))
@@ -368,37 +413,62 @@ func TestGetRoomEndpoint(t *testing.T) {
 	ts := newTestServer()
 	defer ts.Close()
 
-	// Test 1: Nonexistent room returns error
+	// Test 1: Nonexistent room returns 404 with an error
 	resp, err := http.Get(ts.URL + "/api/room/FAKE99")
 	if err != nil {
 		t.Fatalf("Failed to GET nonexistent room: %v", err)
 	}
-	var notFoundResp models.RoomResponse
+	var notFoundResp models.ErrorResponse
 	json.NewDecoder(resp.Body).Decode(&notFoundResp)
 	resp.Body.Close()
-	if notFoundResp.Error == "" {
-		t.Error("Expected error for nonexistent room")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", resp.StatusCode)
+	}
+	if notFoundResp.Error != "room not found" || notFoundResp.Status != http.StatusNotFound {
+		t.Errorf("Expected room not found error, got %+v", notFoundResp)
 	}
 	t.Logf("Nonexistent room correctly returns error: %s", notFoundResp.Error)
 
 	// Create a room
 	code := ts.createRoom(t)
 
-	// Test 2: Existing room returns code
+	// Test 2: Existing room returns its status
 	resp, err = http.Get(ts.URL + "/api/room/" + code)
 	if err != nil {
 		t.Fatalf("Failed to GET existing room: %v", err)
 	}
-	var roomResp models.RoomResponse
+	var roomResp models.RoomStatusResponse
 	json.NewDecoder(resp.Body).Decode(&roomResp)
 	resp.Body.Close()
-	if roomResp.Code != code {
-		t.Errorf("Expected code=%s, got %s", code, roomResp.Code)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", resp.StatusCode)
+	}
+	if roomResp.Code != code || !roomResp.Exists || roomResp.PeerCount != 0 || roomResp.IsFull {
+		t.Errorf("Unexpected status for empty room %s: %+v", code, roomResp)
+	}
+	if time.Until(roomResp.ExpiresAt) < 29*time.Minute {
+		t.Errorf("Expected expiry about 30 min out, got %v", roomResp.ExpiresAt)
 	}
 	t.Logf("Room status: %+v", roomResp)
+
+	// Test 3: Expired room returns 410
+	r, _ := room.GetRoom(code)
+	r.SetCreatedAt(time.Now().Add(-31 * time.Minute))
+	resp, err = http.Get(ts.URL + "/api/room/" + code)
+	if err != nil {
+		t.Fatalf("Failed to GET expired room: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("Expected 410 for expired room, got %d", resp.StatusCode)
+	}
 }
 
 func cleanup() {
 	room.Reset()
 	session.Reset()
+	drop.Reset()
+	device.Reset()
+	transfer.Reset()
+	ratelimit.Configure(ratelimit.Defaults)
 }
@@ -0,0 +1,199 @@
+package main
+
+// Signed session token tests - per-peer tokens, reconnecting into the
+// issued slot, and rebuilding a session the server no longer holds.
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"frop/internal/session"
+	"frop/internal/token"
+
+	"github.com/gorilla/websocket"
+)
+
+// useSignedTokens switches the server to signed tokens until the returned
+// function is called
+func useSignedTokens(t *testing.T, keys ...token.Key) func() {
+	t.Helper()
+
+	k, err := token.NewKeyring(keys...)
+	if err != nil {
+		t.Fatalf("Failed to build keyring: %v", err)
+	}
+	session.SetKeyring(k)
+	return func() { session.SetKeyring(nil) }
+}
+
+// pairWithTokens pairs two peers in a new room and returns their
+// connections and "connected" messages
+func (ts *testServer) pairWithTokens(t *testing.T) ([]*websocket.Conn, []map[string]any) {
+	t.Helper()
+
+	code := ts.createRoom(t)
+	conns := []*websocket.Conn{ts.dialWS(t), ts.dialWS(t)}
+	joinFirst(t, conns[0], code)
+	admit(t, conns[0], conns[1], code)
+
+	var msgs []map[string]any
+	for _, conn := range conns {
+		msgs = append(msgs, readType(t, conn, "connected"))
+	}
+	return conns, msgs
+}
+
+func tokenKey(id string) token.Key {
+	return token.Key{ID: id, Secret: []byte(strings.Repeat(id, 32))}
+}
+
+// =============================================================================
+// Signed tokens
+// =============================================================================
+
+// TestSignedTokenReconnect verifies each peer gets its own signed token and
+// comes back into its own slot with it
+func TestSignedTokenReconnect(t *testing.T) {
+	defer cleanup()
+	defer useSignedTokens(t, tokenKey("k1"))()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	defer conns[1].Close()
+
+	token1 := msgs[0]["sessionToken"].(string)
+	if token1 == msgs[1]["sessionToken"] || strings.Count(token1, ".") != 2 {
+		t.Fatalf("Expected distinct signed tokens, got %q and %q", token1, msgs[1]["sessionToken"])
+	}
+
+	conns[0].Close()
+	readType(t, conns[1], "peer_disconnected")
+
+	back := ts.dialWS(t)
+	defer back.Close()
+	back.WriteJSON(map[string]string{"type": "reconnect", "sessionToken": token1})
+	if msg := readType(t, back, "connected"); msg["peerId"] != msgs[0]["peerId"] {
+		t.Errorf("Expected to come back as %v, got %v", msgs[0]["peerId"], msg["peerId"])
+	}
+
+	t.Log("Signed token reconnects into its own slot!")
+}
+
+// TestSignedTokenSlotTaken verifies a token cannot take over a slot whose
+// peer is still connected
+func TestSignedTokenSlotTaken(t *testing.T) {
+	defer cleanup()
+	defer useSignedTokens(t, tokenKey("k1"))()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	defer conns[0].Close()
+	defer conns[1].Close()
+
+	intruder := ts.dialWS(t)
+	defer intruder.Close()
+	intruder.WriteJSON(map[string]any{"type": "reconnect", "sessionToken": msgs[0]["sessionToken"]})
+	if msg := readType(t, intruder, "failed"); msg["error"] != session.ErrSlotTaken.Error() {
+		t.Errorf("Expected %q, got %v", session.ErrSlotTaken, msg["error"])
+	}
+
+	t.Log("Occupied slot cannot be taken!")
+}
+
+// TestSignedTokenSurvivesRestart verifies a server that has lost every
+// session, but shares the keyring, rebuilds one from a token, including
+// after the signing key has been rotated
+func TestSignedTokenSurvivesRestart(t *testing.T) {
+	defer cleanup()
+	restore := useSignedTokens(t, tokenKey("k1"))
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	token1, token2 := msgs[0]["sessionToken"], msgs[1]["sessionToken"]
+	conns[0].Close()
+	conns[1].Close()
+
+	// a fresh instance with a new signing key in front of the old one
+	session.Reset()
+	restore()
+	defer useSignedTokens(t, tokenKey("k2"), tokenKey("k1"))()
+
+	peer1 := ts.dialWS(t)
+	defer peer1.Close()
+	peer1.WriteJSON(map[string]any{"type": "reconnect", "sessionToken": token1})
+	readType(t, peer1, "connected")
+
+	peer2 := ts.dialWS(t)
+	defer peer2.Close()
+	peer2.WriteJSON(map[string]any{"type": "reconnect", "sessionToken": token2})
+	msg := readType(t, peer2, "connected")
+	if peers := msg["peers"].([]any); len(peers) != 2 {
+		t.Errorf("Expected both peers back in one session, got %v", peers)
+	}
+	if tok := msg["sessionToken"].(string); !strings.HasPrefix(tok, "k2.") {
+		t.Errorf("Expected a token signed with the new key, got %q", tok)
+	}
+
+	// and a key that was dropped no longer verifies
+	session.SetKeyring(nil)
+	defer useSignedTokens(t, tokenKey("k2"))()
+	stale := ts.dialWS(t)
+	defer stale.Close()
+	stale.WriteJSON(map[string]any{"type": "reconnect", "sessionToken": token1})
+	readType(t, stale, "failed")
+
+	t.Log("Signed tokens rebuild sessions across restarts and key rotation!")
+}
+
+// TestSignedTokenAfterExtend verifies extending a session hands out tokens
+// carrying the new expiry, so a session rebuilt from one keeps it
+func TestSignedTokenAfterExtend(t *testing.T) {
+	defer cleanup()
+	defer useSignedTokens(t, tokenKey("k1"))()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, msgs := ts.pairWithTokens(t)
+	conns[0].WriteJSON(map[string]any{"type": "extend", "ttl": 7200})
+
+	var tokens []string
+	for i, conn := range conns {
+		msg := readType(t, conn, "extended")
+		tok, _ := msg["sessionToken"].(string)
+		if tok == "" || tok == msgs[i]["sessionToken"] {
+			t.Fatalf("Expected a new token with the new expiry, got %v", msg)
+		}
+		tokens = append(tokens, tok)
+		conn.Close()
+	}
+
+	k, _ := token.NewKeyring(tokenKey("k1"))
+	claims, err := k.Verify(tokens[0])
+	if err != nil {
+		t.Fatalf("Failed to verify the new token: %v", err)
+	}
+	if claims.TTL != 2*time.Hour || time.Until(claims.Expires) < 119*time.Minute {
+		t.Errorf("Expected the token to carry the 2h lifetime, got %+v", claims)
+	}
+
+	// a fresh instance rebuilds the session with its extended lifetime
+	session.Reset()
+	back := ts.dialWS(t)
+	defer back.Close()
+	back.WriteJSON(map[string]any{"type": "reconnect", "sessionToken": tokens[1]})
+	msg := readType(t, back, "connected")
+	expiresAt, _ := time.Parse(time.RFC3339Nano, msg["expiresAt"].(string))
+	if time.Until(expiresAt) < 119*time.Minute {
+		t.Errorf("Expected the rebuilt session to keep its 2h lifetime, got %v", msg["expiresAt"])
+	}
+
+	t.Log("Extended sessions hand out tokens with the new expiry!")
+}
@@ -0,0 +1,180 @@
+package main
+
+// Trusted device tests - remembering a pairing, meeting again without a
+// code, listing and revoking.
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"frop/internal/device"
+	"frop/internal/room"
+	"frop/models"
+
+	"github.com/gorilla/websocket"
+)
+
+// trustPair pairs two peers and has both ask to remember the pairing. It
+// returns each peer's "trusted" message, in the order of the connections.
+func (ts *testServer) trustPair(t *testing.T) ([]*websocket.Conn, []map[string]any) {
+	t.Helper()
+
+	conns, msgs := ts.pairWithTokens(t)
+	conns[0].WriteJSON(map[string]string{"type": "trust", "name": "Laptop"})
+	req := readType(t, conns[1], "trust_request")
+	if req["peerId"] != msgs[0]["peerId"] || req["name"] != "Laptop" {
+		t.Errorf("Expected a trust request from the laptop, got %v", req)
+	}
+	conns[1].WriteJSON(map[string]string{"type": "trust", "name": "Phone"})
+
+	return conns, []map[string]any{readType(t, conns[0], "trusted"), readType(t, conns[1], "trusted")}
+}
+
+// pairDevice asks to meet a trusted device over a new connection
+func (ts *testServer) pairDevice(t *testing.T, trusted map[string]any, to any) *websocket.Conn {
+	t.Helper()
+
+	conn := ts.dialWS(t)
+	conn.WriteJSON(map[string]any{"type": "pair", "deviceToken": trusted["deviceToken"], "to": to})
+	return conn
+}
+
+// listDevices calls GET /api/devices with a device credential
+func (ts *testServer) listDevices(t *testing.T, token any) (int, *models.DevicesResponse) {
+	t.Helper()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/devices", nil)
+	req.Header.Set("Authorization", "Bearer "+token.(string))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to list devices: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var res models.DevicesResponse
+	json.NewDecoder(resp.Body).Decode(&res)
+	return resp.StatusCode, &res
+}
+
+// =============================================================================
+// Trusted devices
+// =============================================================================
+
+// TestTrustIssuesDeviceCredentials verifies both peers must ask, and then
+// each gets its own credential and learns the other's device
+func TestTrustIssuesDeviceCredentials(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, trusted := ts.trustPair(t)
+	defer conns[0].Close()
+	defer conns[1].Close()
+
+	laptop, phone := trusted[0], trusted[1]
+	if laptop["deviceToken"] == "" || laptop["deviceToken"] == phone["deviceToken"] {
+		t.Fatalf("Expected a credential per device, got %v and %v", laptop, phone)
+	}
+	if got := laptop["device"].(map[string]any); got["id"] != phone["deviceId"] || got["name"] != "Phone" {
+		t.Errorf("Expected the laptop to learn the phone's device, got %v", got)
+	}
+	if got := phone["device"].(map[string]any); got["id"] != laptop["deviceId"] || got["name"] != "Laptop" {
+		t.Errorf("Expected the phone to learn the laptop's device, got %v", got)
+	}
+
+	t.Log("Devices trusted each other!")
+}
+
+// TestPairTrustedDevices verifies two trusted devices meet again with one
+// message each and no room code
+func TestPairTrustedDevices(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, trusted := ts.trustPair(t)
+	conns[0].Close()
+	conns[1].Close()
+
+	laptop := ts.pairDevice(t, trusted[0], trusted[1]["deviceId"])
+	defer laptop.Close()
+	code := readType(t, laptop, "routed")["code"]
+
+	// whoever learns the code while the laptop waits is not let in
+	intruder := ts.dialWS(t)
+	defer intruder.Close()
+	intruder.WriteJSON(map[string]any{"type": "join", "code": code})
+	if msg := readType(t, intruder, "failed"); msg["error"] != room.ErrRoomFull.Error() {
+		t.Errorf("Expected %q, got %v", room.ErrRoomFull, msg["error"])
+	}
+
+	phone := ts.pairDevice(t, trusted[1], trusted[0]["deviceId"])
+	defer phone.Close()
+	if routed := readType(t, phone, "routed"); routed["code"] != code {
+		t.Errorf("Expected the phone in the laptop's room %v, got %v", code, routed["code"])
+	}
+
+	readType(t, laptop, "connected")
+	readType(t, phone, "connected")
+
+	stranger := ts.pairDevice(t, map[string]any{"deviceToken": "nope.nope"}, trusted[0]["deviceId"])
+	defer stranger.Close()
+	if msg := readType(t, stranger, "failed"); msg["error"] != device.ErrBadCredential.Error() {
+		t.Errorf("Expected %q, got %v", device.ErrBadCredential, msg["error"])
+	}
+
+	t.Log("Trusted devices paired without a code!")
+}
+
+// TestListAndRevokeDevices verifies either side can list its trusted
+// devices and revoke the pairing for both
+func TestListAndRevokeDevices(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	conns, trusted := ts.trustPair(t)
+	conns[0].Close()
+	conns[1].Close()
+	laptop, phone := trusted[0], trusted[1]
+
+	status, list := ts.listDevices(t, laptop["deviceToken"])
+	if status != http.StatusOK || list.ID != laptop["deviceId"] || len(list.Trusted) != 1 || list.Trusted[0].Name != "Phone" {
+		t.Fatalf("Expected the laptop to list the phone, got %d %+v", status, list)
+	}
+	if status, _ := ts.listDevices(t, "nope.nope"); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a bad credential, got %d", status)
+	}
+
+	revoke := func(token, id any) int {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/api/devices/"+id.(string), nil)
+		req.Header.Set("Authorization", "Bearer "+token.(string))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to revoke: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := revoke(phone["deviceToken"], laptop["deviceId"]); status != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", status)
+	}
+	if status := revoke(phone["deviceToken"], laptop["deviceId"]); status != http.StatusNotFound {
+		t.Errorf("Expected 404 once revoked, got %d", status)
+	}
+
+	if _, list := ts.listDevices(t, laptop["deviceToken"]); len(list.Trusted) != 0 {
+		t.Errorf("Expected the revocation to reach the laptop, got %+v", list.Trusted)
+	}
+	conn := ts.pairDevice(t, laptop, phone["deviceId"])
+	defer conn.Close()
+	if msg := readType(t, conn, "failed"); msg["error"] != device.ErrNotTrusted.Error() {
+		t.Errorf("Expected %q, got %v", device.ErrNotTrusted, msg["error"])
+	}
+
+	t.Log("Trusted device revoked on both sides!")
+}
@@ -0,0 +1,142 @@
+package main
+
+// Lifetime tests - rooms created with a TTL, extending sessions, and the
+// expiry warning.
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"frop/internal/janitor"
+	"frop/internal/room"
+	"frop/internal/session"
+	"frop/models"
+)
+
+// createRoomWithTTL creates a room asking for ttl seconds of lifetime
+func (ts *testServer) createRoomWithTTL(t *testing.T, ttl int) (*http.Response, models.RoomResponse) {
+	t.Helper()
+
+	body, _ := json.Marshal(models.CreateRoomRequest{TTL: ttl})
+	resp, err := http.Post(ts.URL+"/api/room", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create room: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result models.RoomResponse
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp, result
+}
+
+// TestRoomTTL verifies a requested lifetime outlasts the default, and is
+// capped by the server maximum
+func TestRoomTTL(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	_, res := ts.createRoomWithTTL(t, 3600)
+	if res.ExpiresAt == nil || time.Until(*res.ExpiresAt) < 59*time.Minute {
+		t.Fatalf("Expected expiry about an hour out, got %v", res.ExpiresAt)
+	}
+
+	r, _ := room.GetRoom(res.Code)
+	r.SetCreatedAt(time.Now().Add(-31 * time.Minute))
+	if _, err := room.GetRoom(res.Code); err != nil {
+		t.Errorf("Room with a 1h TTL should outlive the default, got: %v", err)
+	}
+
+	_, res = ts.createRoomWithTTL(t, 7*24*3600)
+	if res.ExpiresAt == nil || time.Until(*res.ExpiresAt) > 24*time.Hour {
+		t.Errorf("Expected TTL capped at 24h, got expiry %v", res.ExpiresAt)
+	}
+
+	// would overflow a Duration if converted before being capped
+	_, res = ts.createRoomWithTTL(t, math.MaxInt64)
+	if res.ExpiresAt == nil || time.Until(*res.ExpiresAt) < 23*time.Hour {
+		t.Errorf("Expected a huge TTL capped at 24h, got expiry %v", res.ExpiresAt)
+	}
+
+	if resp, res := ts.createRoomWithTTL(t, -1); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative TTL, got %d %+v", resp.StatusCode, res)
+	}
+
+	t.Log("Room TTL honored and capped!")
+}
+
+// TestExtendSession verifies "extend" pushes the session's expiry back and
+// tells both peers
+func TestExtendSession(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createRoom(t)
+	peers := ts.joinGroup(t, code, 2)
+	defer peers[0].Close()
+	defer peers[1].Close()
+
+	s, _ := session.ForRoom(code)
+	s.SetLastSeen(time.Now().Add(-14 * time.Minute))
+
+	peers[1].WriteJSON(map[string]any{"type": "extend", "ttl": 3600})
+	for _, conn := range peers {
+		msg := readType(t, conn, "extended")
+		expiresAt, _ := time.Parse(time.RFC3339Nano, msg["expiresAt"].(string))
+		if time.Until(expiresAt) < 59*time.Minute {
+			t.Errorf("Expected expiry about an hour out, got %v", msg["expiresAt"])
+		}
+	}
+
+	if s.Expired(time.Now().Add(30 * time.Minute)) {
+		t.Error("Extended session should outlive the default lifespan")
+	}
+
+	peers[0].WriteJSON(map[string]any{"type": "extend", "ttl": math.MaxInt64})
+	for _, conn := range peers {
+		msg := readType(t, conn, "extended")
+		expiresAt, _ := time.Parse(time.RFC3339Nano, msg["expiresAt"].(string))
+		if time.Until(expiresAt) < 23*time.Hour {
+			t.Errorf("Expected a huge TTL capped at 24h, got %v", msg["expiresAt"])
+		}
+	}
+
+	t.Log("Session extended for both peers!")
+}
+
+// TestExpiringSoonWarning verifies a sweep warns peers of a session close to
+// expiry, once per expiry
+func TestExpiringSoonWarning(t *testing.T) {
+	defer cleanup()
+
+	ts := newTestServer()
+	defer ts.Close()
+
+	code := ts.createRoom(t)
+	peers := ts.joinGroup(t, code, 2)
+	defer peers[0].Close()
+	defer peers[1].Close()
+
+	s, _ := session.ForRoom(code)
+	s.SetLastSeen(time.Now().Add(-14 * time.Minute))
+
+	if report := janitor.Sweep(time.Now()); report.Warned != 1 {
+		t.Fatalf("Expected one session warned, got %+v", report)
+	}
+	for _, conn := range peers {
+		readType(t, conn, "expiring_soon")
+	}
+
+	if report := janitor.Sweep(time.Now()); report.Warned != 0 {
+		t.Errorf("Expected no repeat warning for the same expiry, got %+v", report)
+	}
+
+	t.Log("Peers warned ahead of session expiry!")
+}
@@ -1,3 +1,5 @@
+import { Sha256 } from "./sha256";
+
 // =============================================================================
 // Types
 // =============================================================================
@@ -19,42 +21,133 @@ interface WsMessage {
     | "connected"
     | "failed"
     | "peer_disconnected"
+    | "peer_reconnecting"
+    | "credential_reused"
+    | "routed"
+    | "pending"
+    | "join_request"
+    | "approve"
+    | "deny"
+    | "kicked"
+    | "room_closed"
+    | "leave"
+    | "session_ended"
+    | "trust"
+    | "trust_request"
+    | "trusted"
+    | "pair"
+    | "extend"
+    | "extended"
+    | "expiring_soon"
+    | "rate_limited"
+    | "file_offer"
+    | "file_accept"
+    | "file_reject"
     | "file_start"
     | "file_end"
     | "file_cancel"
+    | "file_complete"
+    | "file_error"
+    | "file_verified"
+    | "file_corrupt"
+    | "file_interrupted"
+    | "file_resumable"
+    | "file_resume"
+    | "credit"
+    | "pause"
+    | "resume"
     | "clipboard";
   code?: string;
   sessionToken?: string;
+  peerId?: string; // for "peer_reconnecting", "credential_reused" and "session_ended"
+  to?: string; // device ID for "pair", sender's peer ID for "file_accept" and "file_reject"
+  from?: string; // sender's peer ID on relayed messages
+  deviceToken?: string; // for "trust", "trusted" and "pair"
+  deviceId?: string; // own device ID, in "trusted"
+  device?: TrustedDevice; // the newly trusted device, in "trusted"
+  transferId?: number; // for "file_*"; absent from peers that send one file at a time
   name?: string;
   size?: number;
+  offset?: number; // bytes delivered before a drop, for "file_resumable", "file_start" and "file_resume"
+  relayed?: number; // bytes the server relayed, in "file_complete" and "file_error"
+  sha256?: string; // hex digest of the file, in "file_end", "file_verified" and "file_corrupt"
+  flow?: boolean; // in "file_offer" and "file_start": we send only as far as granted "credit"
+  credit?: number; // bytes granted, in "credit"
   reason?: string;
   content?: string; // for "clipboard"
+  retryAfter?: number; // seconds, for "rate_limited"
+  requestId?: string; // for "pending", "join_request", "approve" and "deny"
+  expiresAt?: string; // for "connected", "extended" and "expiring_soon"
   error?: string; // error code: "room full", "room not found", etc.
   message?: string; // human-readable message from server
 }
 
+// A device this one trusts (matches backend models.Device)
+interface TrustedDevice {
+  id: string;
+  name?: string;
+}
+
+// This device's credential, kept once it has trusted another device
+interface DeviceCredential {
+  id: string;
+  token: string;
+}
+
 interface IncomingTransfer {
+  id: number;
   name: string;
   size: number;
   received: number;
   chunks: Uint8Array[];
+  hash: Sha256; // of what arrived, checked against file_end's digest
   element: HTMLElement;
   // For streaming large files
   writable?: FileSystemWritableFileStream;
 }
 
+interface OutgoingTransfer {
+  id: number;
+  name: string;
+  file: File; // kept so an interrupted transfer can be resumed
+  element: HTMLElement;
+  cancelled: boolean;
+  interrupted: boolean; // stopped by a drop, until file_resumable
+  answer?: (accepted: boolean) => void; // set while the offer awaits file_accept or file_reject
+  credit: number; // bytes the server granted that we have not sent yet
+  paused: boolean; // the peer is behind, until "resume"
+}
+
 // =============================================================================
 // Constants
 // =============================================================================
 
-const CHUNK_SIZE = 4 * 1024 * 1024; // 4 MB - efficient for all file sizes
+const CHUNK_SIZE = 4 * 1024 * 1024; // 4 MB - efficient for all file sizes, within the server's FROP_MAX_FRAME (8 MiB)
 const MAX_BUFFER_SIZE = 8 * 1024 * 1024; // 8 MB - pause sending when buffer exceeds this (2x chunk size)
 const LARGE_FILE_THRESHOLD = 100 * 1024 * 1024; // 100 MB - use streaming for files larger than this
 const MAX_CLIPBOARD_SIZE = 1024 * 1024; // 1 MB - max clipboard text size
+const PARALLEL_SENDS = 3; // files sent side by side, told apart by frame header
+const FRAME_VERSION = 1;
+const HEADER_SIZE = 9; // version, transfer ID, sequence number (matches backend transfer.Frame)
+const MAX_RECONNECTS = 5; // attempts to get a dropped connection back, 1s apart and growing
 
 // Error code to user-friendly message mapping
 const ERROR_MESSAGES: Record<string, string> = {
   "room not found": "Room not found. Check the code and try again.",
+  "invalid room code": "That code has a typo. Check it and try again.",
+  "secret required": "This room is protected. Ask for its PIN or passphrase.",
+  "wrong secret": "Wrong PIN or passphrase.",
+  "room locked": "Room is locked. Ask for a new code.",
+  "join denied": "The room's creator didn't let you in.",
+  kicked: "You were removed from the room.",
+  room_closed: "The room was closed by its creator.",
+  session_ended: "Your peer ended the session.",
+  "session ended": "That session has ended. Start a new one.",
+  "owner not connected": "Nobody is listening on that name right now.",
+  "stale session credential": "That link has already been used. Ask your peer to share again.",
+  "peer already connected": "Someone is already connected with that link.",
+  "device not trusted": "That device is no longer paired with this one.",
+  "invalid device credential": "This device is no longer remembered.",
   "room full": "Room is full. Only 2 people can connect.",
   "session expired": "Session expired. Please start over.",
   "invalid request": "Something went wrong. Please try again.",
@@ -71,14 +164,24 @@ const state: AppState = {
   ws: null,
 };
 
-// Transfer state
+// Transfer state, by transfer ID
 let sendQueue: File[] = [];
-let isSending = false;
-let incomingTransfer: IncomingTransfer | null = null;
+let activeSends = 0;
+const incoming = new Map<number, IncomingTransfer>();
+const outgoing = new Map<number, OutgoingTransfer>();
+const offers = new Map<number, HTMLElement>(); // the peer's, awaiting our answer
+
+// Start at a random ID so ours are unlikely to match the peer's
+let nextTransferId = Math.floor(Math.random() * 0x7fffffff) + 1;
 
-// Cancel state
-const cancelledOutgoing = new Set<string>(); // Files cancelled by sender (us)
-let currentOutgoingSend: { name: string; element: HTMLElement } | null = null;
+// Set while our own "leave" is in flight, so its session_ended is not an error
+let leaving = false;
+
+// Attempts made since the connection dropped mid-session
+let reconnectAttempts = 0;
+
+const DEVICE_KEY = "frop.device";
+const AUTO_ACCEPT_KEY = "frop.autoAccept";
 
 // =============================================================================
 // DOM Elements
@@ -101,15 +204,22 @@ const elements = {
 
   // Waiting
   roomCodeDisplay: document.getElementById("roomCode")!,
+  roomQr: document.getElementById("roomQr") as HTMLImageElement,
   cancelRoomBtn: document.getElementById("cancelRoom")!,
 
+  trustedDevices: document.getElementById("trustedDevices")!,
+  trustedList: document.getElementById("trustedList")!,
+
   // Connected
+  trustDeviceBtn: document.getElementById("trustDevice")!,
+  leaveSessionBtn: document.getElementById("leaveSession")!,
   dropzone: document.getElementById("dropzone")!,
   fileInput: document.getElementById("fileInput") as HTMLInputElement,
   folderInput: document.getElementById("folderInput") as HTMLInputElement,
   selectFilesBtn: document.getElementById("selectFiles")!,
   selectFolderBtn: document.getElementById("selectFolder")!,
   sendClipboardBtn: document.getElementById("sendClipboard")!,
+  autoAccept: document.getElementById("autoAccept") as HTMLInputElement,
   transferList: document.getElementById("transferList")!,
   clipboardList: document.getElementById("clipboardList")!,
 
@@ -199,6 +309,19 @@ function connectWebSocket(): WebSocket {
   ws.onclose = () => {
     console.log("[WS] Disconnected");
     state.ws = null;
+    for (const transfer of outgoing.values()) {
+      // The server drops offers nobody answered; sends in flight can resume
+      if (transfer.answer) transfer.answer(false);
+      else transfer.interrupted = true;
+    }
+
+    // A connection lost mid-session is retried, so transfers can resume
+    if (state.view === "connected" && state.sessionToken && !leaving && reconnectAttempts < MAX_RECONNECTS) {
+      reconnectAttempts++;
+      console.log(`[WS] Reconnecting, attempt ${reconnectAttempts}...`);
+      setTimeout(reconnectSession, 1000 * reconnectAttempts);
+      return;
+    }
 
     // If we were connected, show disconnected view
     if (state.view === "connected" || state.view === "waiting") {
@@ -210,6 +333,14 @@ function connectWebSocket(): WebSocket {
   return ws;
 }
 
+function reconnectSession(): void {
+  if (!state.sessionToken) return;
+  const ws = connectWebSocket();
+  ws.onopen = () => {
+    sendMessage({ type: "reconnect", sessionToken: state.sessionToken! });
+  };
+}
+
 function sendMessage(msg: WsMessage): void {
   if (!state.ws || state.ws.readyState !== WebSocket.OPEN) {
     console.error("[WS] Cannot send - not connected");
@@ -219,28 +350,43 @@ function sendMessage(msg: WsMessage): void {
   state.ws.send(JSON.stringify(msg));
 }
 
+// Keep the token we reconnect with, and put it in the browser URL for easy
+// reconnection
+function setSessionToken(token: string | undefined): void {
+  state.sessionToken = token ?? null;
+  if (state.sessionToken) {
+    const newUrl = new URL(window.location.href);
+    newUrl.searchParams.set("s", state.sessionToken);
+    window.history.replaceState({}, "", newUrl.toString());
+    console.log("[URL] Updated with session token");
+  }
+}
+
 async function handleWsMessage(msg: WsMessage): Promise<void> {
   switch (msg.type) {
     case "connected":
       console.log("[WS] Paired with peer! Token:", msg.sessionToken);
-      state.sessionToken = msg.sessionToken ?? null;
-
-      // Update browser URL with session token for easy reconnection
-      if (state.sessionToken) {
-        const newUrl = new URL(window.location.href);
-        newUrl.searchParams.set("s", state.sessionToken);
-        window.history.replaceState({}, "", newUrl.toString());
-        console.log("[URL] Updated with session token");
-      }
+      setSessionToken(msg.sessionToken);
+      reconnectAttempts = 0;
 
+      elements.trustDeviceBtn.hidden = false;
       showView("connected");
+      queueFiles([]); // pick up whatever waited out a reconnect
       break;
 
+    case "kicked":
+    case "room_closed":
+    case "session_ended":
+      msg.error = msg.type;
+    // falls through
     case "failed":
       console.error("[WS] Operation failed:", msg.error);
 
-      // Show user-friendly error message
-      showError(getErrorMessage(msg.error ?? ""));
+      // Show user-friendly error message, unless we left ourselves
+      if (!(msg.type === "session_ended" && leaving)) {
+        showError(getErrorMessage(msg.error ?? ""));
+      }
+      leaving = false;
 
       // Clear session token from state and URL
       state.sessionToken = null;
@@ -251,23 +397,120 @@ async function handleWsMessage(msg: WsMessage): Promise<void> {
       showView("landing");
       break;
 
+    case "peer_reconnecting":
+      // The peer dropped; it has a grace window to come back before
+      // peer_disconnected, and clipboard messages are held for it
+      console.log("[WS] Peer reconnecting:", msg.peerId);
+      break;
+
     case "peer_disconnected":
       console.log("[WS] Peer disconnected");
       showView("disconnected");
       break;
 
+    case "routed":
+      // Joined a drop name; the owner's device will join this room
+      console.log("[WS] Routed to room", msg.code);
+      state.roomCode = msg.code ?? null;
+      break;
+
+    case "pending":
+      // Someone is already here; we wait until the room's creator lets us in
+      console.log("[WS] Waiting for approval:", msg.requestId);
+      showView("waiting");
+      break;
+
+    case "join_request":
+      // We created the room, so every later joiner asks us first
+      sendMessage({
+        type: window.confirm("Someone wants to join your room. Let them in?") ? "approve" : "deny",
+        requestId: msg.requestId,
+      });
+      break;
+
+    case "rate_limited":
+      // Not fatal: stay where we are and let the user retry later
+      showError(`Too many attempts. Try again in ${msg.retryAfter ?? 60}s.`);
+      break;
+
+    case "trust_request":
+      // The peer asked to remember this pairing; it takes effect once we agree
+      if (window.confirm(`Remember ${msg.name || "this device"} for next time?`)) {
+        trustPeer();
+      }
+      break;
+
+    case "trusted":
+      saveDeviceCredential({ id: msg.deviceId!, token: msg.deviceToken! });
+      console.log("[Devices] Now trusting", msg.device);
+      elements.trustDeviceBtn.hidden = true;
+      break;
+
+    case "credential_reused":
+      // Someone presented an old token, perhaps copied from a screenshot
+      showError(`Someone tried to rejoin as ${msg.peerId} with an old link.`);
+      break;
+
+    case "extended":
+      // The old token still names the old expiry; reconnect with this one
+      setSessionToken(msg.sessionToken);
+    // falls through
+    case "expiring_soon":
+      console.log("[WS] Session expires at", msg.expiresAt);
+      break;
+
+    case "file_offer":
+      await handleFileOffer(msg);
+      break;
+
+    case "file_accept":
+    case "file_reject":
+      handleFileAnswer(msg);
+      break;
+
     case "file_start":
       await handleFileStart(msg);
       break;
 
     case "file_end":
-      await handleFileEnd();
+      await handleFileEnd(msg);
       break;
 
     case "file_cancel":
       await handleFileCancel(msg);
       break;
 
+    case "file_complete":
+      console.log(`[Transfer] Server relayed ${msg.relayed} of ${msg.size} bytes: ${msg.name}`);
+      break;
+
+    case "file_interrupted":
+      handleFileInterrupted(msg);
+      break;
+
+    case "file_resumable":
+      await handleFileResumable(msg);
+      break;
+
+    case "file_resume":
+      handleFileResume(msg);
+      break;
+
+    case "credit":
+    case "pause":
+    case "resume":
+      handleFlow(msg);
+      break;
+
+    case "file_verified":
+      console.log(`[Transfer] Server verified ${msg.name}: sha256 ${msg.sha256}`);
+      break;
+
+    case "file_error":
+    case "file_corrupt":
+      await handleFileError(msg);
+      break;
+
     case "clipboard":
       handleClipboardReceived(msg);
       break;
@@ -295,6 +538,8 @@ async function createRoom(): Promise<void> {
 
     // Display code and switch view
     elements.roomCodeDisplay.textContent = state.roomCode;
+    elements.roomQr.src = `/api/room/${encodeURIComponent(data.code)}/qr?format=svg`;
+    elements.roomQr.hidden = false;
     showView("waiting");
 
     // Connect WebSocket and join room
@@ -309,9 +554,12 @@ async function createRoom(): Promise<void> {
 }
 
 function joinRoom(code: string): void {
-  if (!code || code.length !== 6) {
+  // Code format is server-configurable (ABC123, digits, word codes), so the
+  // server does the real validation
+  code = code.trim();
+  if (!code) {
     console.error("[Room] Invalid code:", code);
-    showError("Please enter a 6-character room code.");
+    showError("Please enter a room code.");
     elements.codeInput.focus();
     return;
   }
@@ -336,6 +584,90 @@ function cancelRoom(): void {
   showView("landing");
 }
 
+// =============================================================================
+// Trusted Devices
+// =============================================================================
+
+function loadDeviceCredential(): DeviceCredential | null {
+  const saved = localStorage.getItem(DEVICE_KEY);
+  return saved ? JSON.parse(saved) : null;
+}
+
+function saveDeviceCredential(credential: DeviceCredential): void {
+  localStorage.setItem(DEVICE_KEY, JSON.stringify(credential));
+}
+
+// A rough label for this device, shown in the other device's list
+function deviceName(): string {
+  return /Mobi|Android/i.test(navigator.userAgent) ? "Phone" : "Computer";
+}
+
+function trustPeer(): void {
+  sendMessage({
+    type: "trust",
+    name: deviceName(),
+    deviceToken: loadDeviceCredential()?.token,
+  });
+}
+
+async function deviceRequest(path: string, method = "GET"): Promise<Response | null> {
+  const credential = loadDeviceCredential();
+  if (!credential) {
+    return null;
+  }
+  const response = await fetch(path, {
+    method,
+    headers: { Authorization: `Bearer ${credential.token}` },
+  });
+  if (response.status === 401) {
+    // The server no longer knows this device
+    localStorage.removeItem(DEVICE_KEY);
+    return null;
+  }
+  return response;
+}
+
+async function showTrustedDevices(): Promise<void> {
+  const response = await deviceRequest("/api/devices");
+  const data = response?.ok ? await response.json() : null;
+  const devices: TrustedDevice[] = data?.trusted ?? [];
+
+  elements.trustedList.innerHTML = "";
+  for (const device of devices) {
+    const item = document.createElement("li");
+    item.innerHTML = `
+      <button class="btn">${escapeHtml(device.name || "Unnamed device")}</button>
+      <button class="btn secondary" title="Forget this device">Forget</button>
+    `;
+    const [pair, forget] = item.querySelectorAll("button");
+    pair.addEventListener("click", () => pairWithDevice(device));
+    forget.addEventListener("click", async () => {
+      await deviceRequest(`/api/devices/${encodeURIComponent(device.id)}`, "DELETE");
+      showTrustedDevices();
+    });
+    elements.trustedList.appendChild(item);
+  }
+  elements.trustedDevices.hidden = devices.length === 0;
+}
+
+function pairWithDevice(device: TrustedDevice): void {
+  console.log("[Devices] Pairing with", device.id);
+  elements.roomCodeDisplay.textContent = device.name || "your device";
+  elements.roomQr.hidden = true;
+  showView("waiting");
+
+  const ws = connectWebSocket();
+  ws.onopen = () => {
+    sendMessage({ type: "pair", to: device.id, deviceToken: loadDeviceCredential()!.token });
+  };
+}
+
+function leaveSession(): void {
+  console.log("[Room] Leaving...");
+  leaving = true;
+  sendMessage({ type: "leave" });
+}
+
 function backToLanding(): void {
   state.roomCode = null;
   state.sessionToken = null;
@@ -372,13 +704,47 @@ function waitForBuffer(ws: WebSocket): Promise<void> {
   });
 }
 
+/**
+ * Wait until the server has granted credit for more of this transfer and
+ * the peer is not behind, or the transfer stopped.
+ */
+function waitForCredit(transfer: OutgoingTransfer): Promise<void> {
+  return new Promise((resolve) => {
+    // Poll every 10ms, like waitForBuffer
+    const checkCredit = () => {
+      const stopped = transfer.cancelled || transfer.interrupted || !state.ws;
+      if (stopped || (transfer.credit > 0 && !transfer.paused)) {
+        resolve();
+      } else {
+        setTimeout(checkCredit, 10);
+      }
+    };
+    checkCredit();
+  });
+}
+
 function queueFiles(files: FileList | File[]): void {
   sendQueue.push(...Array.from(files));
-  if (!isSending) {
+  while (activeSends < PARALLEL_SENDS && activeSends < sendQueue.length) {
+    activeSends++;
     drainSendQueue();
   }
 }
 
+/**
+ * Prefix a chunk with the frame header: version, transfer ID and sequence
+ * number, big-endian.
+ */
+function frame(id: number, seq: number, chunk: ArrayBuffer): Uint8Array {
+  const out = new Uint8Array(HEADER_SIZE + chunk.byteLength);
+  const view = new DataView(out.buffer);
+  view.setUint8(0, FRAME_VERSION);
+  view.setUint32(1, id);
+  view.setUint32(5, seq);
+  out.set(new Uint8Array(chunk), HEADER_SIZE);
+  return out;
+}
+
 // =============================================================================
 // Drag-and-Drop Folder Support
 // =============================================================================
@@ -484,13 +850,14 @@ async function processDroppedItems(dataTransfer: DataTransfer): Promise<File[]>
   return files;
 }
 
+// One of up to PARALLEL_SENDS workers taking files off the queue, until it
+// is empty or the connection drops; "connected" starts them again
 async function drainSendQueue(): Promise<void> {
-  isSending = true;
-  while (sendQueue.length > 0) {
+  while (sendQueue.length > 0 && state.ws?.readyState === WebSocket.OPEN) {
     const file = sendQueue.shift()!;
     await sendFile(file);
   }
-  isSending = false;
+  activeSends--;
 }
 
 async function sendFile(file: File): Promise<void> {
@@ -498,40 +865,110 @@ async function sendFile(file: File): Promise<void> {
   const name = file.webkitRelativePath || (file as any)._relativePath || file.name;
   console.log(`[Transfer] Sending: ${name} (${file.size} bytes)`);
 
-  sendMessage({ type: "file_start", name, size: file.size });
-  const element = addTransferItem(name, file.size, "send");
-  currentOutgoingSend = { name, element };
+  const id = nextTransferId;
+  nextTransferId = (nextTransferId % 0x7fffffff) + 1;
+
+  const element = addTransferItem(name, file.size, "send", () => cancelOutgoingTransfer(id));
+  const transfer: OutgoingTransfer = {
+    id,
+    name,
+    file,
+    element,
+    cancelled: false,
+    interrupted: false,
+    credit: 0,
+    paused: false,
+  };
+  outgoing.set(id, transfer);
+
+  // Nothing is sent until the peer accepts
+  const answered = new Promise<boolean>((resolve) => (transfer.answer = resolve));
+  sendMessage({ type: "file_offer", transferId: id, name, size: file.size, flow: true });
+  markWaiting(element, "Waiting");
+  const accepted = await answered;
+  transfer.answer = undefined;
+  if (!accepted) {
+    outgoing.delete(id);
+    markCancelled(element);
+    return;
+  }
+
+  await streamFile(transfer, 0);
+}
 
-  let offset = 0;
-  let cancelled = false;
+// A peer answered our offer of msg.transferId. In a group we hear each
+// acceptance, and of a rejection only once everyone has declined.
+function handleFileAnswer(msg: WsMessage): void {
+  const transfer = outgoing.get(msg.transferId ?? 0);
+  if (!transfer) {
+    console.warn(`[Transfer] Received ${msg.type} with no pending offer`);
+    return;
+  }
+  if (!transfer.answer) {
+    console.log(`[Transfer] ${msg.from} also accepted ${transfer.name}`);
+    return;
+  }
+  const accepted = msg.type === "file_accept";
+  console.log(`[Transfer] Peer ${accepted ? "accepted" : "declined"}: ${transfer.name}`);
+  if (!accepted) showError(`Your peer declined ${transfer.name}.`);
+  transfer.answer(accepted);
+}
 
+/**
+ * Send a transfer's file from offset, then file_end, or file_cancel if it
+ * was cancelled. An interrupted transfer is kept to be resumed.
+ */
+async function streamFile(transfer: OutgoingTransfer, offset: number): Promise<void> {
+  const { id, name, file, element } = transfer;
+  transfer.interrupted = false;
+
+  // The digest covers the whole file, resumed or not
+  const hash = new Sha256();
+  for (let pos = 0; pos < offset; pos += CHUNK_SIZE) {
+    const end = Math.min(pos + CHUNK_SIZE, offset);
+    hash.update(new Uint8Array(await file.slice(pos, end).arrayBuffer()));
+  }
+
+  let seq = 0;
   while (offset < file.size) {
-    // Check if this transfer was cancelled
-    if (cancelledOutgoing.has(name)) {
-      console.log(`[Transfer] Cancelled by sender: ${name}`);
-      cancelledOutgoing.delete(name);
-      cancelled = true;
+    // Check if this transfer was cancelled or cut off
+    if (transfer.cancelled || transfer.interrupted || !state.ws) {
       break;
     }
 
-    // Wait for buffer to drain before sending next chunk (backpressure)
-    await waitForBuffer(state.ws!);
+    // Wait for buffer to drain before sending next chunk (backpressure),
+    // and for credit as the peer takes what we sent
+    await waitForBuffer(state.ws);
+    await waitForCredit(transfer);
+    if (transfer.cancelled || transfer.interrupted || !state.ws) {
+      break;
+    }
 
-    const end = Math.min(offset + CHUNK_SIZE, file.size);
+    const end = Math.min(offset + CHUNK_SIZE, offset + transfer.credit, file.size);
+    transfer.credit -= end - offset;
     const slice = file.slice(offset, end);
     const buffer = await slice.arrayBuffer();
-    state.ws!.send(buffer);
+    hash.update(new Uint8Array(buffer));
+    state.ws?.send(frame(id, seq++, buffer));
     offset = end;
     updateProgress(element, offset, file.size);
   }
 
-  currentOutgoingSend = null;
+  if (!transfer.cancelled && (transfer.interrupted || !state.ws)) {
+    console.log(`[Transfer] Interrupted: ${name}`);
+    transfer.interrupted = true;
+    markPaused(element);
+    return;
+  }
+
+  outgoing.delete(id);
 
-  if (cancelled) {
-    sendMessage({ type: "file_cancel", name, reason: "user_cancelled" });
+  if (transfer.cancelled) {
+    console.log(`[Transfer] Cancelled: ${name}`);
+    sendMessage({ type: "file_cancel", transferId: id, name, reason: "user_cancelled" });
     markCancelled(element);
   } else {
-    sendMessage({ type: "file_end", name });
+    sendMessage({ type: "file_end", transferId: id, name, sha256: hash.hex() });
     markComplete(element);
     console.log(`[Transfer] Sent: ${name}`);
   }
@@ -541,9 +978,53 @@ async function sendFile(file: File): Promise<void> {
 // File Transfer - Receiving
 // =============================================================================
 
-async function handleFileStart(msg: WsMessage): Promise<void> {
+/**
+ * The peer offers a file: accept it straight away if this device accepts
+ * files automatically, otherwise ask.
+ */
+async function handleFileOffer(msg: WsMessage): Promise<void> {
+  const id = msg.transferId ?? 0;
+  if (elements.autoAccept.checked) {
+    sendMessage({ type: "file_accept", transferId: id, name: msg.name, to: msg.from });
+    await handleFileStart(msg);
+    return;
+  }
+
+  console.log(`[Transfer] Offered: ${msg.name} (${msg.size} bytes)`);
+  const element = addTransferItem(msg.name!, msg.size!, "receive", () =>
+    incoming.has(id) ? cancelIncomingTransfer(id) : answerOffer(msg, false),
+  );
+  const acceptBtn = document.createElement("button");
+  acceptBtn.className = "accept-btn";
+  acceptBtn.title = "Accept file";
+  acceptBtn.textContent = "✓";
+  acceptBtn.addEventListener("click", () => answerOffer(msg, true));
+  element.querySelector(".cancel-btn")!.before(acceptBtn);
+  markWaiting(element, "Accept?");
+  offers.set(id, element);
+}
+
+async function answerOffer(msg: WsMessage, accept: boolean): Promise<void> {
+  const id = msg.transferId ?? 0;
+  const element = offers.get(id);
+  if (!element) return;
+  offers.delete(id);
+  element.querySelector(".accept-btn")?.remove();
+
+  if (!accept) {
+    sendMessage({ type: "file_reject", transferId: id, name: msg.name, to: msg.from, reason: "user_rejected" });
+    markCancelled(element);
+    return;
+  }
+  sendMessage({ type: "file_accept", transferId: id, name: msg.name, to: msg.from });
+  markWaiting(element, "0%");
+  await handleFileStart(msg, element);
+}
+
+async function handleFileStart(msg: WsMessage, element?: HTMLElement): Promise<void> {
   console.log(`[Transfer] Receiving: ${msg.name} (${msg.size} bytes)`);
-  const element = addTransferItem(msg.name!, msg.size!, "receive");
+  const id = msg.transferId ?? 0;
+  element ??= addTransferItem(msg.name!, msg.size!, "receive", () => cancelIncomingTransfer(id));
 
   // For large files, try to use streaming with File System Access API
   let writable: FileSystemWritableFileStream | undefined;
@@ -563,70 +1044,94 @@ async function handleFileStart(msg: WsMessage): Promise<void> {
     }
   }
 
-  incomingTransfer = {
+  incoming.set(id, {
+    id,
     name: msg.name!,
     size: msg.size!,
     received: 0,
     chunks: writable ? [] : [], // Still need chunks array for non-streaming
+    hash: new Sha256(),
     element,
     writable,
-  };
+  });
 }
 
+/**
+ * Route a binary frame to its transfer by header. A peer sending one file at
+ * a time, without transfer IDs, sends bare data under ID 0.
+ */
 async function handleBinaryChunk(data: ArrayBuffer): Promise<void> {
-  if (!incomingTransfer) {
+  let transfer = incoming.get(0);
+  let chunk = data;
+  if (!transfer && data.byteLength >= HEADER_SIZE) {
+    const view = new DataView(data);
+    transfer = incoming.get(view.getUint32(1));
+    chunk = data.slice(HEADER_SIZE);
+  }
+  if (!transfer) {
     console.warn("[Transfer] Received binary chunk with no active transfer");
     return;
   }
+  // Hash before any await, while frames are still in order
+  transfer.hash.update(new Uint8Array(chunk));
 
   // If we have a writable stream, write directly to disk
-  if (incomingTransfer.writable) {
+  if (transfer.writable) {
     try {
-      await incomingTransfer.writable.write(data);
+      await transfer.writable.write(chunk);
     } catch (err) {
       console.error(`[Transfer] Failed to write chunk to disk:`, err);
       // Fall back to memory accumulation
-      incomingTransfer.chunks.push(new Uint8Array(data));
+      transfer.chunks.push(new Uint8Array(chunk));
     }
   } else {
     // Accumulate in memory for smaller files or when streaming not available
-    incomingTransfer.chunks.push(new Uint8Array(data));
+    transfer.chunks.push(new Uint8Array(chunk));
   }
 
-  incomingTransfer.received += data.byteLength;
-  updateProgress(
-    incomingTransfer.element,
-    incomingTransfer.received,
-    incomingTransfer.size,
-  );
+  transfer.received += chunk.byteLength;
+  updateProgress(transfer.element, transfer.received, transfer.size);
 }
 
-async function handleFileEnd(): Promise<void> {
-  if (!incomingTransfer) {
+async function handleFileEnd(msg: WsMessage): Promise<void> {
+  const transfer = incoming.get(msg.transferId ?? 0);
+  if (!transfer) {
     console.warn("[Transfer] Received file_end with no active transfer");
     return;
   }
+  incoming.delete(transfer.id);
 
   console.log(
-    `[Transfer] Complete: ${incomingTransfer.name} (${incomingTransfer.received} bytes)`,
+    `[Transfer] Complete: ${transfer.name} (${transfer.received} bytes)`,
   );
 
+  // The server checked the sender's digest; check it reached us intact too
+  const digest = transfer.hash.hex();
+  if (msg.sha256 && msg.sha256.toLowerCase() !== digest) {
+    console.error(`[Transfer] Digest mismatch for ${transfer.name}: expected ${msg.sha256}, got ${digest}`);
+    showError(`${transfer.name} arrived corrupted. Ask your peer to send it again.`);
+    if (transfer.writable) {
+      await transfer.writable.abort().catch(() => {});
+    }
+    markCancelled(transfer.element);
+    return;
+  }
+
   // If we were streaming to disk, close the stream
-  if (incomingTransfer.writable) {
+  if (transfer.writable) {
     try {
-      await incomingTransfer.writable.close();
+      await transfer.writable.close();
       console.log(`[Transfer] Streaming download complete`);
     } catch (err) {
       console.error(`[Transfer] Failed to close writable stream:`, err);
     }
   } else {
     // Traditional blob download for smaller files
-    const blob = new Blob(incomingTransfer.chunks);
-    downloadBlob(blob, incomingTransfer.name);
+    const blob = new Blob(transfer.chunks);
+    downloadBlob(blob, transfer.name);
   }
 
-  markComplete(incomingTransfer.element);
-  incomingTransfer = null;
+  markComplete(transfer.element);
 }
 
 function downloadBlob(blob: Blob, name: string): void {
@@ -646,56 +1151,178 @@ function downloadBlob(blob: Blob, name: string): void {
 
 async function handleFileCancel(msg: WsMessage): Promise<void> {
   console.log(`[Transfer] Peer cancelled: ${msg.name} (${msg.reason})`);
+  const id = msg.transferId ?? 0;
 
   // Check if this cancels our outgoing send (peer rejected it)
-  if (currentOutgoingSend && currentOutgoingSend.name === msg.name) {
-    cancelledOutgoing.add(msg.name!);
-    return; // The send loop will handle cleanup
+  const sending = outgoing.get(id);
+  if (sending) {
+    stopOutgoing(sending);
+    return;
   }
 
   // Otherwise it cancels our incoming transfer (peer stopped sending)
-  if (incomingTransfer && incomingTransfer.name === msg.name) {
-    // Close writable stream if open
-    if (incomingTransfer.writable) {
-      try {
-        await incomingTransfer.writable.abort();
-      } catch (err) {
-        console.warn(`[Transfer] Failed to abort writable stream:`, err);
-      }
-    }
+  await dropIncoming(id);
+}
+
+// The server stopped or refused a transfer; it relayed msg.relayed bytes
+async function handleFileError(msg: WsMessage): Promise<void> {
+  console.error(`[Transfer] Server error for ${msg.name}: ${msg.error} (${msg.relayed ?? 0} bytes relayed)`);
+  showError(`Transfer of ${msg.name || "file"} failed: ${msg.error}`);
+  const id = msg.transferId ?? 0;
+
+  const sending = outgoing.get(id);
+  if (sending) {
+    stopOutgoing(sending);
+    return;
+  }
+  await dropIncoming(id);
+}
 
-    markCancelled(incomingTransfer.element);
-    incomingTransfer = null;
+// Stop receiving transfer id, discarding what arrived so far, or withdraw
+// its offer if we never answered
+async function dropIncoming(id: number): Promise<void> {
+  const offer = offers.get(id);
+  if (offer) {
+    offers.delete(id);
+    offer.querySelector(".accept-btn")?.remove();
+    markCancelled(offer);
+    return;
+  }
+
+  const transfer = incoming.get(id);
+  if (!transfer) return;
+  incoming.delete(id);
+
+  // Close writable stream if open
+  if (transfer.writable) {
+    try {
+      await transfer.writable.abort();
+    } catch (err) {
+      console.warn(`[Transfer] Failed to abort writable stream:`, err);
+    }
   }
+  markCancelled(transfer.element);
 }
 
-function cancelOutgoingTransfer(): void {
-  if (!currentOutgoingSend) {
+function cancelOutgoingTransfer(id: number): void {
+  const transfer = outgoing.get(id);
+  if (!transfer) {
     console.warn("[Transfer] No outgoing transfer to cancel");
     return;
   }
-  console.log(`[Transfer] Cancelling outgoing: ${currentOutgoingSend.name}`);
-  cancelledOutgoing.add(currentOutgoingSend.name);
+  console.log(`[Transfer] Cancelling outgoing: ${transfer.name}`);
+  if (transfer.answer) {
+    sendMessage({ type: "file_cancel", transferId: id, name: transfer.name, reason: "user_cancelled" });
+  }
+  stopOutgoing(transfer);
 }
 
-function cancelIncomingTransfer(): void {
-  if (!incomingTransfer) {
+// Cancel an outgoing transfer: the send loop cleans up a running one, an
+// offer still waiting or an interrupted one has no loop and is cancelled here
+function stopOutgoing(transfer: OutgoingTransfer): void {
+  transfer.cancelled = true;
+  if (transfer.answer) {
+    transfer.answer(false);
+    return;
+  }
+  if (!transfer.interrupted) return;
+
+  outgoing.delete(transfer.id);
+  sendMessage({ type: "file_cancel", transferId: transfer.id, name: transfer.name, reason: "user_cancelled" });
+  markCancelled(transfer.element);
+}
+
+function cancelIncomingTransfer(id: number): void {
+  const transfer = incoming.get(id);
+  if (!transfer) {
     console.warn("[Transfer] No incoming transfer to cancel");
     return;
   }
-  const name = incomingTransfer.name;
-  console.log(`[Transfer] Rejecting incoming: ${name}`);
+  console.log(`[Transfer] Rejecting incoming: ${transfer.name}`);
 
   // Send cancel to peer so they stop sending
-  sendMessage({ type: "file_cancel", name, reason: "user_rejected" });
+  sendMessage({ type: "file_cancel", transferId: id || undefined, name: transfer.name, reason: "user_rejected" });
+  dropIncoming(id);
+}
 
-  // Close writable stream if open
-  if (incomingTransfer.writable) {
-    incomingTransfer.writable.abort().catch(() => {});
+// =============================================================================
+// File Transfer - Resume
+// =============================================================================
+
+// A peer dropped mid-transfer; the server kept count of what was delivered
+function handleFileInterrupted(msg: WsMessage): void {
+  const id = msg.transferId ?? 0;
+  console.log(`[Transfer] Interrupted: ${msg.name} after ${msg.relayed} bytes`);
+
+  const sending = outgoing.get(id);
+  if (sending) {
+    sending.interrupted = true; // The send loop stops and keeps it
+    return;
+  }
+  const receiving = incoming.get(id);
+  if (receiving) markPaused(receiving.element);
+}
+
+/**
+ * Both sides are back: the sender picks up from msg.offset, the receiver
+ * waits for file_resume. A side that lost its part of the transfer, say to
+ * a page reload, cancels it instead.
+ */
+async function handleFileResumable(msg: WsMessage): Promise<void> {
+  const id = msg.transferId ?? 0;
+  const offset = msg.offset ?? 0;
+
+  const sending = outgoing.get(id);
+  if (sending && sending.interrupted) {
+    console.log(`[Transfer] Resuming ${sending.name} from ${offset} bytes`);
+    sending.credit = 0; // granted afresh for the new leg
+    sending.paused = false;
+    sendMessage({ type: "file_start", transferId: id, name: sending.name, size: sending.file.size, offset, flow: true });
+    await streamFile(sending, offset);
+    return;
   }
 
-  markCancelled(incomingTransfer.element);
-  incomingTransfer = null;
+  const receiving = incoming.get(id);
+  if (!sending && (!receiving || receiving.received !== offset)) {
+    console.warn(`[Transfer] Cannot resume ${msg.name} from ${offset} bytes`);
+    sendMessage({ type: "file_cancel", transferId: id || undefined, name: msg.name, reason: "cannot_resume" });
+    await dropIncoming(id);
+  }
+}
+
+// The sender resumed a transfer we kept, from msg.offset
+function handleFileResume(msg: WsMessage): void {
+  const transfer = incoming.get(msg.transferId ?? 0);
+  if (!transfer) {
+    console.warn("[Transfer] Received file_resume with no interrupted transfer");
+    return;
+  }
+  console.log(`[Transfer] Resumed: ${transfer.name} from ${msg.offset} bytes`);
+  updateProgress(transfer.element, transfer.received, transfer.size);
+}
+
+// =============================================================================
+// File Transfer - Flow Control
+// =============================================================================
+
+// The server grants credit as the peer takes our data, and pauses us while
+// it falls behind
+function handleFlow(msg: WsMessage): void {
+  const transfer = outgoing.get(msg.transferId ?? 0);
+  if (!transfer) return;
+
+  switch (msg.type) {
+    case "credit":
+      transfer.credit += msg.credit ?? 0;
+      break;
+    case "pause":
+      console.log(`[Transfer] Peer is behind, pausing: ${transfer.name}`);
+      transfer.paused = true;
+      break;
+    case "resume":
+      transfer.paused = false;
+      break;
+  }
 }
 
 // =============================================================================
@@ -818,6 +1445,7 @@ function addTransferItem(
   name: string,
   size: number,
   direction: "send" | "receive",
+  onCancel: () => void,
 ): HTMLElement {
   const item = document.createElement("div");
   item.className = "transfer-item";
@@ -837,13 +1465,7 @@ function addTransferItem(
 
   // Wire up cancel button
   const cancelBtn = item.querySelector<HTMLButtonElement>(".cancel-btn")!;
-  cancelBtn.addEventListener("click", () => {
-    if (direction === "send") {
-      cancelOutgoingTransfer();
-    } else {
-      cancelIncomingTransfer();
-    }
-  });
+  cancelBtn.addEventListener("click", onCancel);
 
   elements.transferList.appendChild(item);
   return item;
@@ -868,6 +1490,14 @@ function markComplete(element: HTMLElement): void {
   if (cancelBtn) cancelBtn.style.display = "none";
 }
 
+function markPaused(element: HTMLElement): void {
+  element.querySelector(".percent")!.textContent = "Paused";
+}
+
+function markWaiting(element: HTMLElement, text: string): void {
+  element.querySelector(".percent")!.textContent = text;
+}
+
 function markCancelled(element: HTMLElement): void {
   element.classList.add("cancelled");
   element.querySelector(".percent")!.textContent = "Cancelled";
@@ -913,6 +1543,8 @@ function setupEventListeners(): void {
 
   // Waiting view
   elements.cancelRoomBtn.addEventListener("click", cancelRoom);
+  elements.leaveSessionBtn.addEventListener("click", leaveSession);
+  elements.trustDeviceBtn.addEventListener("click", trustPeer);
 
   // Disconnected view
   elements.backToLandingBtn.addEventListener("click", backToLanding);
@@ -940,6 +1572,12 @@ function setupEventListeners(): void {
     }
   });
 
+  // Offers from the peer are accepted without asking once this is ticked
+  elements.autoAccept.checked = localStorage.getItem(AUTO_ACCEPT_KEY) === "1";
+  elements.autoAccept.addEventListener("change", () => {
+    localStorage.setItem(AUTO_ACCEPT_KEY, elements.autoAccept.checked ? "1" : "0");
+  });
+
   // Clipboard
   elements.sendClipboardBtn.addEventListener("click", sendClipboard);
 
@@ -993,6 +1631,7 @@ function init(): void {
   // Check for session token in URL parameter
   const urlParams = new URLSearchParams(window.location.search);
   const sessionToken = urlParams.get("s");
+  const joinCode = urlParams.get("c"); // set by /j/{code} join links
 
   if (sessionToken && sessionToken.trim()) {
     // Auto-reconnect with session token from URL
@@ -1006,8 +1645,17 @@ function init(): void {
       sendMessage({ type: "reconnect", sessionToken: state.sessionToken! });
     };
   } else {
-    // Normal flow: show landing page
+    // Normal flow: show landing page, with the code filled in if we came
+    // from a join link
     showView("landing");
+    showTrustedDevices();
+    if (joinCode && joinCode.trim()) {
+      elements.codeInput.value = joinCode.trim();
+      elements.codeInput.focus();
+      const cleanUrl = new URL(window.location.href);
+      cleanUrl.searchParams.delete("c");
+      window.history.replaceState({}, "", cleanUrl.toString());
+    }
   }
 
   console.log("[Frop] Ready!");
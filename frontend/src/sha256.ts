@@ -0,0 +1,103 @@
+// =============================================================================
+// Incremental SHA-256
+// =============================================================================
+//
+// crypto.subtle can only hash a whole buffer at once, which would mean
+// holding large files in memory. This hashes chunk by chunk as they are
+// sent or received (FIPS 180-4).
+
+const K = new Uint32Array([
+  0x428a2f98, 0x71374491, 0xb5c0fbcf, 0xe9b5dba5, 0x3956c25b, 0x59f111f1, 0x923f82a4, 0xab1c5ed5,
+  0xd807aa98, 0x12835b01, 0x243185be, 0x550c7dc3, 0x72be5d74, 0x80deb1fe, 0x9bdc06a7, 0xc19bf174,
+  0xe49b69c1, 0xefbe4786, 0x0fc19dc6, 0x240ca1cc, 0x2de92c6f, 0x4a7484aa, 0x5cb0a9dc, 0x76f988da,
+  0x983e5152, 0xa831c66d, 0xb00327c8, 0xbf597fc7, 0xc6e00bf3, 0xd5a79147, 0x06ca6351, 0x14292967,
+  0x27b70a85, 0x2e1b2138, 0x4d2c6dfc, 0x53380d13, 0x650a7354, 0x766a0abb, 0x81c2c92e, 0x92722c85,
+  0xa2bfe8a1, 0xa81a664b, 0xc24b8b70, 0xc76c51a3, 0xd192e819, 0xd6990624, 0xf40e3585, 0x106aa070,
+  0x19a4c116, 0x1e376c08, 0x2748774c, 0x34b0bcb5, 0x391c0cb3, 0x4ed8aa4a, 0x5b9cca4f, 0x682e6ff3,
+  0x748f82ee, 0x78a5636f, 0x84c87814, 0x8cc70208, 0x90befffa, 0xa4506ceb, 0xbef9a3f7, 0xc67178f2,
+]);
+
+export class Sha256 {
+  private h = new Uint32Array([
+    0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a, 0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+  ]);
+  private w = new Uint32Array(64);
+  private block = new Uint8Array(64);
+  private used = 0; // bytes waiting in block
+  private length = 0; // total bytes hashed
+
+  update(data: Uint8Array): void {
+    this.length += data.length;
+    let i = 0;
+    // fill a partial block first, then hash whole blocks straight from data
+    if (this.used > 0) {
+      const n = Math.min(64 - this.used, data.length);
+      this.block.set(data.subarray(0, n), this.used);
+      this.used += n;
+      i = n;
+      if (this.used < 64) return;
+      this.compress(this.block, 0);
+      this.used = 0;
+    }
+    for (; i + 64 <= data.length; i += 64) {
+      this.compress(data, i);
+    }
+    this.block.set(data.subarray(i));
+    this.used = data.length - i;
+  }
+
+  /** Finish and return the digest as lowercase hex */
+  hex(): string {
+    const bits = this.length * 8;
+    const pad = new Uint8Array((this.used < 56 ? 64 : 128) - this.used);
+    pad[0] = 0x80;
+    const view = new DataView(pad.buffer);
+    view.setUint32(pad.length - 8, Math.floor(bits / 0x100000000));
+    view.setUint32(pad.length - 4, bits >>> 0);
+    this.update(pad);
+
+    return Array.from(this.h, (x) => x.toString(16).padStart(8, "0")).join("");
+  }
+
+  private compress(data: Uint8Array, offset: number): void {
+    const w = this.w;
+    for (let t = 0; t < 16; t++) {
+      const j = offset + t * 4;
+      w[t] = (data[j] << 24) | (data[j + 1] << 16) | (data[j + 2] << 8) | data[j + 3];
+    }
+    for (let t = 16; t < 64; t++) {
+      const a = w[t - 15];
+      const b = w[t - 2];
+      const s0 = rotr(a, 7) ^ rotr(a, 18) ^ (a >>> 3);
+      const s1 = rotr(b, 17) ^ rotr(b, 19) ^ (b >>> 10);
+      w[t] = w[t - 16] + s0 + w[t - 7] + s1;
+    }
+
+    let [a, b, c, d, e, f, g, h] = this.h;
+    for (let t = 0; t < 64; t++) {
+      const t1 = (h + (rotr(e, 6) ^ rotr(e, 11) ^ rotr(e, 25)) + ((e & f) ^ (~e & g)) + K[t] + w[t]) | 0;
+      const t2 = ((rotr(a, 2) ^ rotr(a, 13) ^ rotr(a, 22)) + ((a & b) ^ (a & c) ^ (b & c))) | 0;
+      h = g;
+      g = f;
+      f = e;
+      e = (d + t1) | 0;
+      d = c;
+      c = b;
+      b = a;
+      a = (t1 + t2) | 0;
+    }
+
+    this.h[0] += a;
+    this.h[1] += b;
+    this.h[2] += c;
+    this.h[3] += d;
+    this.h[4] += e;
+    this.h[5] += f;
+    this.h[6] += g;
+    this.h[7] += h;
+  }
+}
+
+function rotr(x: number, n: number): number {
+  return (x >>> n) | (x << (32 - n));
+}